@@ -1,5 +1,73 @@
 package config
 
+import (
+	"runtime"
+	"time"
+)
+
 var Protocol = "tcp"
 var Port = ":3000"
 var MaxConnection = 20000
+
+// MaxQueryBufferSize caps the bytes buffered for a client that has not yet
+// sent a complete command. Past it the connection is closed.
+var MaxQueryBufferSize = 1024 * 1024 * 1024
+
+// NumShards is the number of worker goroutines the keyspace is partitioned
+// across. Each worker owns the keys that hash to it.
+var NumShards = runtime.NumCPU()
+
+// NumReactors is the number of event loops accepting and serving clients.
+// Each one binds its own SO_REUSEPORT socket on Port and runs on its own
+// goroutine; all of them share the same shards.
+var NumReactors = 1
+
+// ClientIdleTimeout closes client connections that have sent nothing for this
+// long. Zero disables the check.
+var ClientIdleTimeout time.Duration = 0
+
+// Dir is the working directory for persistence files.
+var Dir = "."
+
+// DbFilename is the snapshot file inside Dir, loaded at startup and written
+// by SAVE, BGSAVE and the save rules.
+var DbFilename = "dump.rdb"
+
+// SaveRule triggers a background save once at least Changes writes happened
+// and at least Seconds passed since the last save.
+type SaveRule struct {
+	Seconds int
+	Changes int
+}
+
+// SaveRules are checked once a second; an empty list disables automatic
+// snapshots.
+var SaveRules = []SaveRule{
+	{Seconds: 3600, Changes: 1},
+	{Seconds: 300, Changes: 100},
+	{Seconds: 60, Changes: 10000},
+}
+
+// AppendOnly turns on the append-only file. When it is on, the AOF rather
+// than the snapshot is loaded at startup.
+var AppendOnly = false
+
+// AppendFilename is the append-only file inside Dir.
+var AppendFilename = "appendonly.aof"
+
+// AppendFsync is when the AOF is synced to disk: "always" after every write
+// command, "everysec" once a second in the background or "no" to leave it to
+// the operating system.
+var AppendFsync = "everysec"
+
+// AofLoadTruncated lets the server start from an AOF whose last command was
+// cut short, e.g. by a crash mid-write. The partial command is dropped and
+// the file truncated. When false the server refuses to start instead.
+var AofLoadTruncated = true
+
+// AutoAofRewritePercentage starts a background AOF rewrite once the file has
+// grown by this percentage since the last rewrite. Zero disables it.
+var AutoAofRewritePercentage = 100
+
+// AutoAofRewriteMinSize keeps small files from being rewritten over and over.
+var AutoAofRewriteMinSize int64 = 64 * 1024 * 1024
@@ -3,15 +3,37 @@ package constant
 import "time"
 
 var RespNil = []byte("$-1\r\n")
+var RespNilArray = []byte("*-1\r\n")
 var RespOk = []byte("+OK\r\n")
 var RespZero = []byte(":0\r\n")
 var RespOne = []byte(":1\r\n")
 var TtlKeyNotExist = []byte(":-2\r\n")
 var TtlKeyExistNoExpire = []byte(":-1\r\n")
 var ActiveExpireFrequency = 100 * time.Millisecond
+var StatsSampleFrequency = 100 * time.Millisecond
+var ClientsCronFrequency = time.Second
+var SaveCronFrequency = time.Second
+var SaveRetryDelay = 5 * time.Second
 var ActiveExpireSampleSize = 20
 var ActiveExpireThreshold = 0.1
 var DefaultBPlusTreeDegree = 4
 
 const BfDefaultInitCapacity = 100
 const BfDefaultErrRate = 0.01
+
+// MaxBulkLength is the largest bulk string length the decoder accepts.
+const MaxBulkLength = 512 * 1024 * 1024
+
+// MaxInlineLength is the longest header line the decoder waits for the end
+// of, like PROTO_INLINE_MAX_SIZE in Redis.
+const MaxInlineLength = 64 * 1024
+
+// MaxMultiBulkLength is the largest array length the decoder accepts, the
+// limit Redis puts on the number of arguments of a command.
+const MaxMultiBulkLength = 1024 * 1024
+
+const AppendFsyncAlways = "always"
+const AppendFsyncEverySec = "everysec"
+const AppendFsyncNo = "no"
+
+var AofCronFrequency = time.Second
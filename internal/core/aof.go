@@ -0,0 +1,364 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+var errAofTruncated = errors.New("aof: unexpected end of file")
+
+// appendOnlyFile logs every write command in RESP form. All shards append to
+// the same file, so writes are serialized by mu; commands of one shard still
+// appear in the order they ran, which is all replay needs since shards never
+// share keys.
+type appendOnlyFile struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	fsync string
+	// unsynced is set when data was written since the last fsync that
+	// succeeded.
+	unsynced bool
+	// writeErr is the error of the last write or fsync that failed, until a
+	// write succeeds again.
+	writeErr error
+	// fsyncDone is closed when the last fsync started by cron returns.
+	fsyncDone chan struct{}
+	// rewriteBuf collects the commands fed while a rewrite is in progress;
+	// they are appended to the rewritten file before it replaces this one.
+	rewriteBuf *bytes.Buffer
+
+	size     atomic.Int64
+	baseSize atomic.Int64 // size after the last rewrite, or at startup
+
+	fsyncInFlight   atomic.Bool
+	rewriteInFlight atomic.Bool
+	lastWriteOK     atomic.Bool
+	lastRewriteOK   atomic.Bool
+}
+
+func aofPath() string {
+	return filepath.Join(config.Dir, config.AppendFilename)
+}
+
+func openAppendOnlyFile(path string, fsync string) (*appendOnlyFile, error) {
+	switch fsync {
+	case constant.AppendFsyncAlways, constant.AppendFsyncEverySec, constant.AppendFsyncNo:
+	default:
+		return nil, fmt.Errorf("aof: invalid appendfsync policy %q", fsync)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	aof := &appendOnlyFile{path: path, file: f, fsync: fsync}
+	aof.size.Store(info.Size())
+	aof.baseSize.Store(info.Size())
+	aof.lastWriteOK.Store(true)
+	aof.lastRewriteOK.Store(true)
+	return aof, nil
+}
+
+// feed appends cmds to the file. With appendfsync always the data is on disk
+// by the time it returns, i.e. before the client gets its reply.
+func (aof *appendOnlyFile) feed(cmds []*Command) {
+	var buf []byte
+	for _, cmd := range cmds {
+		buf = append(buf, encodeCommand(cmd)...)
+	}
+
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	if aof.rewriteBuf != nil {
+		aof.rewriteBuf.Write(buf)
+	}
+	n, err := aof.file.Write(buf)
+	aof.size.Add(int64(n))
+	if err == nil && aof.fsync == constant.AppendFsyncAlways {
+		err = aof.file.Sync()
+	}
+	// Even a failed write may have left some of buf in the file, so it
+	// still needs the sync.
+	if aof.fsync == constant.AppendFsyncEverySec {
+		aof.unsynced = true
+	}
+	aof.setWriteErr(err)
+}
+
+// setWriteErr records the outcome of a write, which INFO reports as
+// aof_last_write_status. aof.mu must be held.
+func (aof *appendOnlyFile) setWriteErr(err error) {
+	switch {
+	case err != nil:
+		log.Println("error writing to the AOF:", err)
+	case aof.writeErr != nil:
+		log.Println("AOF write error looks solved")
+	}
+	aof.writeErr = err
+	aof.lastWriteOK.Store(err == nil)
+}
+
+// cron syncs the file once a second under appendfsync everysec. The sync runs
+// in the background so a slow disk doesn't stall the event loop. While the
+// previous sync is still running, the writes stay pending for the next tick,
+// and so do they when the sync fails, so it is retried.
+func (aof *appendOnlyFile) cron() {
+	aof.mu.Lock()
+	if !aof.unsynced || !aof.fsyncInFlight.CompareAndSwap(false, true) {
+		aof.mu.Unlock()
+		return
+	}
+	f := aof.file
+	aof.unsynced = false
+	done := make(chan struct{})
+	aof.fsyncDone = done
+	aof.mu.Unlock()
+	go func() {
+		defer close(done)
+		defer aof.fsyncInFlight.Store(false)
+		if err := f.Sync(); err != nil {
+			aof.mu.Lock()
+			aof.unsynced = true
+			aof.setWriteErr(err)
+			aof.mu.Unlock()
+		}
+	}()
+}
+
+func encodeCommand(cmd *Command) []byte {
+	return Encode(append([]string{cmd.Cmd}, cmd.Args...), false)
+}
+
+// aofCommands returns what to log for cmd once it has run on s and changed
+// something. Commands setting a relative TTL are rewritten to an absolute
+// PEXPIREAT, otherwise a replay would restart the countdown from the time of
+// loading.
+func (s *Storage) aofCommands(cmd *Command) []*Command {
+	switch cmd.Cmd {
+	case "SET":
+		// Only a SET that took place is logged, so its conditions and GET
+		// can go; the expiry it left, if any, follows as a PEXPIREAT.
+		key := cmd.Args[0]
+		cmds := []*Command{{Cmd: "SET", Args: cmd.Args[:2]}}
+		return append(cmds, s.aofExpireAt(key)...)
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		// The flags were already checked; log the outcome.
+		key := cmd.Args[0]
+		if !s.keyExists(key) {
+			return []*Command{{Cmd: "DEL", Args: []string{key}}}
+		}
+		return s.aofExpireAt(key)
+	case "GETEX":
+		// Like the EXPIRE family, logged as the TTL it left behind.
+		key := cmd.Args[0]
+		if !s.keyExists(key) {
+			return []*Command{{Cmd: "DEL", Args: []string{key}}}
+		}
+		if cmds := s.aofExpireAt(key); len(cmds) > 0 {
+			return cmds
+		}
+		return []*Command{{Cmd: "PERSIST", Args: []string{key}}}
+	case "INCRBYFLOAT":
+		// Replaying the addition could round differently; log the result.
+		key := cmd.Args[0]
+		value, _, _ := s.lookupString(key)
+		return []*Command{{Cmd: "SET", Args: []string{key, value, "KEEPTTL"}}}
+	case "BLPOP", "BRPOP", "BLMOVE":
+		// Logged as the pop they did when they were served.
+		return nil
+	case "HINCRBYFLOAT":
+		// Logged as its result too, which HSET would strip of its TTL.
+		key, field := cmd.Args[0], cmd.Args[1]
+		hash, _ := s.lookupHash(key)
+		value, _ := hash.Get(field)
+		cmds := []*Command{{Cmd: "HSET", Args: []string{key, field, value}}}
+		return append(cmds, aofHashFieldExpireAt(key, hash, []string{field})...)
+	case "HEXPIRE", "HPEXPIRE", "HEXPIREAT", "HPEXPIREAT":
+		// Like the EXPIRE family, logged as the outcome: fields set to expire
+		// in the past were deleted.
+		key := cmd.Args[0]
+		hash, _ := s.lookupHash(key)
+		if hash == nil {
+			return []*Command{{Cmd: "DEL", Args: []string{key}}}
+		}
+		// The key comes first and the time second, so FIELDS is the
+		// first of the others spelling it.
+		at := 2 + slices.IndexFunc(cmd.Args[2:], func(arg string) bool { return strings.EqualFold(arg, "FIELDS") })
+		fields := cmd.Args[at+2:]
+		var deleted []string
+		for _, field := range fields {
+			if _, ok := hash.Get(field); !ok {
+				deleted = append(deleted, field)
+			}
+		}
+		var cmds []*Command
+		if len(deleted) > 0 {
+			cmds = append(cmds, &Command{Cmd: "HDEL", Args: append([]string{key}, deleted...)})
+		}
+		return append(cmds, aofHashFieldExpireAt(key, hash, fields)...)
+	case "RESTORE":
+		key := cmd.Args[0]
+		cmds := []*Command{{Cmd: "RESTORE", Args: []string{key, "0", cmd.Args[2], "REPLACE"}}}
+		return append(cmds, s.aofExpireAt(key)...)
+	}
+	return []*Command{cmd}
+}
+
+// aofHashFieldExpireAt is the HPEXPIREAT commands restoring the current
+// expiry of those of fields that have one, fields sharing a deadline going
+// together.
+func aofHashFieldExpireAt(key string, hash *data_structure.Hash, fields []string) []*Command {
+	var deadlines []uint64
+	byDeadline := make(map[uint64][]string)
+	for _, field := range fields {
+		at, ok := hash.Expiry(field)
+		if !ok {
+			continue
+		}
+		if _, seen := byDeadline[at]; !seen {
+			deadlines = append(deadlines, at)
+		}
+		byDeadline[at] = append(byDeadline[at], field)
+	}
+	cmds := make([]*Command, 0, len(deadlines))
+	for _, at := range deadlines {
+		fields := byDeadline[at]
+		args := append([]string{key, strconv.FormatUint(at, 10), "FIELDS", strconv.Itoa(len(fields))}, fields...)
+		cmds = append(cmds, &Command{Cmd: "HPEXPIREAT", Args: args})
+	}
+	return cmds
+}
+
+// aofExpireAt is a PEXPIREAT restoring the current expiry of key, if any.
+func (s *Storage) aofExpireAt(key string) []*Command {
+	exp, ok := s.dictStore.GetExpiry(key)
+	if !ok {
+		return nil
+	}
+	return []*Command{{Cmd: "PEXPIREAT", Args: []string{key, strconv.FormatUint(exp, 10)}}}
+}
+
+// parseAof splits the contents of an AOF into commands. It returns the byte
+// length of the complete commands, which is less than len(data) only together
+// with errAofTruncated.
+func parseAof(data []byte) ([]*Command, int, error) {
+	var cmds []*Command
+	pos := 0
+	for pos < len(data) {
+		value, n, err := DecodeOne(data[pos:])
+		if errors.Is(err, ErrIncompleteFrame) {
+			return cmds, pos, errAofTruncated
+		}
+		if err != nil {
+			return cmds, pos, fmt.Errorf("aof: bad file format at offset %d: %w", pos, err)
+		}
+		cmd, err := NewCommand(value)
+		if err != nil {
+			return cmds, pos, fmt.Errorf("aof: bad command at offset %d: %w", pos, err)
+		}
+		cmds = append(cmds, cmd)
+		pos += n
+	}
+	return cmds, pos, nil
+}
+
+// LoadAppendOnly replays the AOF through the dispatcher, if there is one. A
+// command cut short at the end of the file is dropped and the file truncated
+// to the last complete command when config.AofLoadTruncated allows it.
+func (d *Dispatcher) LoadAppendOnly() error {
+	path := aofPath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	loaded := 0
+	cmds, valid, err := parseAof(data)
+	if errors.Is(err, errAofTruncated) {
+		if !config.AofLoadTruncated {
+			return fmt.Errorf("%w: %d trailing bytes after offset %d, "+
+				"enable AofLoadTruncated to drop them", err, len(data)-valid, valid)
+		}
+		log.Printf("!!! Warning: short read while loading the AOF, truncating it to %d bytes", valid)
+		if err = os.Truncate(path, int64(valid)); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// Submit in batches so the shards replay in parallel without holding a
+	// reply for every command of a large file.
+	for len(cmds) > 0 {
+		batch := cmds[:min(len(cmds), shardQueueSize)]
+		cmds = cmds[len(batch):]
+		pending := make([]*PendingReply, len(batch))
+		for i, cmd := range batch {
+			pending[i] = d.Submit(cmd)
+		}
+		for i, p := range pending {
+			if reply := p.Wait(); len(reply) > 0 && reply[0] == '-' {
+				log.Printf("AOF command %s failed on replay: %s", batch[i].Cmd, reply)
+			}
+		}
+		loaded += len(batch)
+	}
+	// What was just loaded is already on disk.
+	d.snapshots.dirtyAtSave.Store(d.dirty())
+	log.Printf("DB loaded from append only file: %d commands in %v", loaded, time.Since(start))
+	return nil
+}
+
+// OpenAppendOnly starts logging write commands to the AOF. It must be called
+// after loading, or the replayed commands would be appended again.
+func (d *Dispatcher) OpenAppendOnly() error {
+	aof, err := openAppendOnlyFile(aofPath(), config.AppendFsync)
+	if err != nil {
+		return err
+	}
+	unlock := d.lockShards(d.shards)
+	for _, sh := range d.shards {
+		sh.storage.aof = aof
+	}
+	unlock()
+	d.aof = aof
+	return nil
+}
+
+// AofCron syncs the AOF under appendfsync everysec and starts a rewrite once
+// the file has grown by config.AutoAofRewritePercentage. The event loop calls
+// it on a timer.
+func (d *Dispatcher) AofCron() {
+	if d.aof == nil {
+		return
+	}
+	if d.aof.fsync == constant.AppendFsyncEverySec {
+		d.aof.cron()
+	}
+	if growth, due := d.aof.rewriteDue(); due {
+		log.Printf("Starting automatic rewriting of AOF on %d%% growth", growth)
+		_ = d.BgRewriteAof()
+	}
+}
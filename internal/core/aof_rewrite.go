@@ -0,0 +1,224 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+// aofRewriteItemsPerCmd caps the elements of a single RPUSH, SADD, HSET or ZADD
+// in a rewritten AOF, so loading a large set doesn't need one huge command.
+const aofRewriteItemsPerCmd = 64
+
+var errAofDisabled = errors.New("ERR Append only file is disabled")
+var errAofRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+
+// rewriteAof appends to buf the shortest command stream we know of that
+// rebuilds s from an empty keyspace. Like encodeRdbEntries it must run while
+// the storage can't change.
+func (s *Storage) rewriteAof(buf *bytes.Buffer) error {
+	for key, obj := range s.dictStore.GetDictStore() {
+		if s.dictStore.HasExpired(key) {
+			continue
+		}
+		switch v := obj.Value.(type) {
+		case string, int64, []byte:
+			buf.Write(encodeCommand(&Command{Cmd: "SET", Args: []string{key, stringOf(obj)}}))
+		case *data_structure.Quicklist:
+			values := v.Values()
+			for start := 0; start < len(values); start += aofRewriteItemsPerCmd {
+				batch := values[start:min(start+aofRewriteItemsPerCmd, len(values))]
+				buf.Write(encodeCommand(&Command{Cmd: "RPUSH", Args: append([]string{key}, batch...)}))
+			}
+		case *data_structure.SimpleSet:
+			members := v.Members()
+			for start := 0; start < len(members); start += aofRewriteItemsPerCmd {
+				batch := members[start:min(start+aofRewriteItemsPerCmd, len(members))]
+				buf.Write(encodeCommand(&Command{Cmd: "SADD", Args: append([]string{key}, batch...)}))
+			}
+		case *data_structure.Hash:
+			pairs := v.Pairs()
+			for start := 0; start < len(pairs); start += 2 * aofRewriteItemsPerCmd {
+				batch := pairs[start:min(start+2*aofRewriteItemsPerCmd, len(pairs))]
+				buf.Write(encodeCommand(&Command{Cmd: "HSET", Args: append([]string{key}, batch...)}))
+			}
+			if v.HasExpiries() {
+				fields := make([]string, 0, len(pairs)/2)
+				for i := 0; i < len(pairs); i += 2 {
+					fields = append(fields, pairs[i])
+				}
+				for _, cmd := range aofHashFieldExpireAt(key, v, fields) {
+					buf.Write(encodeCommand(cmd))
+				}
+			}
+		case *data_structure.SortedSet:
+			args := []string{key}
+			for member, score := range v.MemberScores {
+				args = append(args, strconv.FormatFloat(score, 'g', -1, 64), member)
+				if len(args) == 1+2*aofRewriteItemsPerCmd {
+					buf.Write(encodeCommand(&Command{Cmd: "ZADD", Args: args}))
+					args = []string{key}
+				}
+			}
+			if len(args) > 1 {
+				buf.Write(encodeCommand(&Command{Cmd: "ZADD", Args: args}))
+			}
+		default:
+			// Sketches have no command that rebuilds them from their
+			// counters, so they are dumped and restored whole.
+			payload, _, err := s.dumpPayload(key)
+			if err != nil {
+				return err
+			}
+			buf.Write(encodeCommand(&Command{Cmd: "RESTORE", Args: []string{key, "0", string(payload)}}))
+		}
+		for _, cmd := range s.aofExpireAt(key) {
+			buf.Write(encodeCommand(cmd))
+		}
+	}
+	return nil
+}
+
+// encodeAofRewrite builds a rewritten AOF from the given storages.
+func encodeAofRewrite(storages []*Storage) ([]byte, error) {
+	bodies := make([]bytes.Buffer, len(storages))
+	errs := make(chan error, len(storages))
+	for i, s := range storages {
+		go func() {
+			errs <- s.rewriteAof(&bodies[i])
+		}()
+	}
+	for range storages {
+		if err := <-errs; err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	for i := range bodies {
+		buf.Write(bodies[i].Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// BgRewriteAof replaces the AOF with the commands that rebuild the current
+// keyspace. The shards are paused only while that state is encoded; the file
+// is written in the background, and the writes arriving meanwhile are kept
+// aside and appended to it before it takes the old file's place.
+func (d *Dispatcher) BgRewriteAof() error {
+	aof := d.aof
+	if aof == nil {
+		return errAofDisabled
+	}
+	if !aof.rewriteInFlight.CompareAndSwap(false, true) {
+		return errAofRewriteInProgress
+	}
+	unlock := d.lockShards(d.shards)
+	data, err := encodeAofRewrite(d.storages())
+	if err == nil {
+		aof.mu.Lock()
+		aof.rewriteBuf = &bytes.Buffer{}
+		aof.mu.Unlock()
+	}
+	unlock()
+	if err != nil {
+		aof.lastRewriteOK.Store(false)
+		aof.rewriteInFlight.Store(false)
+		return err
+	}
+	go func() {
+		defer aof.rewriteInFlight.Store(false)
+		err := aof.finishRewrite(data)
+		aof.lastRewriteOK.Store(err == nil)
+		if err != nil {
+			log.Println("AOF rewrite failed:", err)
+			return
+		}
+		log.Println("Background AOF rewrite finished successfully")
+	}()
+	return nil
+}
+
+// finishRewrite writes data and the writes buffered since the rewrite started
+// to a temporary file, then renames it over the AOF.
+func (aof *appendOnlyFile) finishRewrite(data []byte) (err error) {
+	tmp := filepath.Join(filepath.Dir(aof.path), fmt.Sprintf("temp-rewriteaof-bg-%d.aof", os.Getpid()))
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		aof.mu.Lock()
+		aof.rewriteBuf = nil
+		aof.mu.Unlock()
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	// The bulk of the file is written without blocking the shards.
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+
+	// The old file is closed once the lock is released, after the cron's
+	// fsync still using it, if any, has returned.
+	var old *os.File
+	var fsyncDone chan struct{}
+	defer func() {
+		if old == nil {
+			return
+		}
+		if fsyncDone != nil {
+			<-fsyncDone
+		}
+		if closeErr := old.Close(); closeErr != nil {
+			log.Println("error closing the old AOF:", closeErr)
+		}
+	}()
+
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	buffered := aof.rewriteBuf
+	aof.rewriteBuf = nil
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buffered.Bytes()); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, aof.path); err != nil {
+		return err
+	}
+	old, fsyncDone = aof.file, aof.fsyncDone
+	aof.file = f
+	aof.unsynced = false
+	size := int64(len(data) + buffered.Len())
+	aof.size.Store(size)
+	aof.baseSize.Store(size)
+	return nil
+}
+
+// rewriteDue reports whether the AOF has grown enough since the last rewrite
+// to be rewritten again, and by how much.
+func (aof *appendOnlyFile) rewriteDue() (int64, bool) {
+	if config.AutoAofRewritePercentage <= 0 || aof.rewriteInFlight.Load() {
+		return 0, false
+	}
+	size := aof.size.Load()
+	if size < config.AutoAofRewriteMinSize {
+		return 0, false
+	}
+	base := max(aof.baseSize.Load(), 1)
+	growth := (size - base) * 100 / base
+	return growth, growth >= int64(config.AutoAofRewritePercentage)
+}
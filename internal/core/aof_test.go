@@ -0,0 +1,443 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+)
+
+func useAppendOnly(t *testing.T, fsync string) {
+	useTempDir(t)
+	filename, policy := config.AppendFilename, config.AppendFsync
+	config.AppendFilename, config.AppendFsync = "appendonly.aof", fsync
+	t.Cleanup(func() { config.AppendFilename, config.AppendFsync = filename, policy })
+}
+
+func TestAof_replay(t *testing.T) {
+	for _, fsync := range []string{constant.AppendFsyncAlways, constant.AppendFsyncEverySec, constant.AppendFsyncNo} {
+		t.Run(fsync, func(t *testing.T) {
+			useAppendOnly(t, fsync)
+			d := NewDispatcher(4)
+			assert.NoError(t, d.OpenAppendOnly())
+			d.Execute(&Command{Cmd: "SET", Args: []string{"a", "1"}})
+			d.Execute(&Command{Cmd: "SET", Args: []string{"b", "2"}})
+			d.Execute(&Command{Cmd: "DEL", Args: []string{"a", "b", "missing"}})
+			d.Execute(&Command{Cmd: "SET", Args: []string{"b", "3"}})
+			d.Execute(&Command{Cmd: "SADD", Args: []string{"set", "x", "y"}})
+			d.Execute(&Command{Cmd: "ZADD", Args: []string{"zset", "1", "one"}})
+			d.Execute(&Command{Cmd: "CMS.INITBYDIM", Args: []string{"cms", "100", "5"}})
+			d.Execute(&Command{Cmd: "CMS.INCRBY", Args: []string{"cms", "x", "3"}})
+			d.Execute(&Command{Cmd: "BF.RESERVE", Args: []string{"bf", "0.01", "100"}})
+			d.Execute(&Command{Cmd: "BF.MADD", Args: []string{"bf", "item"}})
+			// Failed commands aren't logged.
+			d.Execute(&Command{Cmd: "CMS.INCRBY", Args: []string{"missing", "x", "1"}})
+			d.AofCron()
+			d.Close()
+
+			restarted := NewDispatcher(3)
+			defer restarted.Close()
+			assert.NoError(t, restarted.LoadAppendOnly())
+			assert.Equal(t, "$-1\r\n", string(restarted.Execute(&Command{Cmd: "GET", Args: []string{"a"}})))
+			assert.Equal(t, string(Encode("3", false)), string(restarted.Execute(&Command{Cmd: "GET", Args: []string{"b"}})))
+			assert.Equal(t, ":1\r\n", string(restarted.Execute(&Command{Cmd: "SISMEMBER", Args: []string{"set", "y"}})))
+			assert.Equal(t, ":0\r\n", string(restarted.Execute(&Command{Cmd: "ZRANK", Args: []string{"zset", "one"}})))
+			assert.Equal(t, "*1\r\n$1\r\n3\r\n", string(restarted.Execute(&Command{Cmd: "CMS.QUERY", Args: []string{"cms", "x"}})))
+			assert.Equal(t, ":1\r\n", string(restarted.Execute(&Command{Cmd: "BF.EXISTS", Args: []string{"bf", "item"}})))
+			assert.Equal(t, ":0\r\n", string(restarted.Execute(&Command{Cmd: "EXISTS", Args: []string{"missing"}})))
+		})
+	}
+}
+
+func TestAof_relativeTTLsAreLoggedAsAbsolute(t *testing.T) {
+	s := NewStorage()
+	s.cmdSET([]string{"k", "v", "EX", "100"})
+	exp, _ := s.dictStore.GetExpiry("k")
+	expireAt := &Command{Cmd: "PEXPIREAT", Args: []string{"k", strconv.FormatUint(exp, 10)}}
+
+	assert.Equal(t, []*Command{{Cmd: "SET", Args: []string{"k", "v"}}, expireAt},
+		s.aofCommands(&Command{Cmd: "SET", Args: []string{"k", "v", "EX", "100"}}))
+
+	s.cmdEXPIRE([]string{"k", "50"})
+	exp, _ = s.dictStore.GetExpiry("k")
+	expireAt = &Command{Cmd: "PEXPIREAT", Args: []string{"k", strconv.FormatUint(exp, 10)}}
+	assert.Equal(t, []*Command{expireAt}, s.aofCommands(&Command{Cmd: "EXPIRE", Args: []string{"k", "50"}}))
+
+	s.cmdPEXPIRE([]string{"k", "500000", "GT"})
+	exp, _ = s.dictStore.GetExpiry("k")
+	expireAt = &Command{Cmd: "PEXPIREAT", Args: []string{"k", strconv.FormatUint(exp, 10)}}
+	assert.Equal(t, []*Command{expireAt}, s.aofCommands(&Command{Cmd: "PEXPIRE", Args: []string{"k", "500000", "GT"}}))
+
+	// Expiring in the past deletes the key.
+	s.cmdEXPIREAT([]string{"k", "1"})
+	assert.Equal(t, []*Command{{Cmd: "DEL", Args: []string{"k"}}}, s.aofCommands(&Command{Cmd: "EXPIREAT", Args: []string{"k", "1"}}))
+}
+
+func TestAof_INCRBYFLOATIsLoggedAsSET(t *testing.T) {
+	s := NewStorage()
+	s.cmdINCRBYFLOAT([]string{"f", "0.1"})
+	s.cmdINCRBYFLOAT([]string{"f", "0.2"})
+	assert.Equal(t, []*Command{{Cmd: "SET", Args: []string{"f", "0.30000000000000004", "KEEPTTL"}}},
+		s.aofCommands(&Command{Cmd: "INCRBYFLOAT", Args: []string{"f", "0.2"}}))
+}
+
+func TestAof_HINCRBYFLOATIsLoggedAsHSET(t *testing.T) {
+	s := NewStorage()
+	s.cmdHINCRBYFLOAT([]string{"h", "f", "0.1"})
+	s.cmdHINCRBYFLOAT([]string{"h", "f", "0.2"})
+	assert.Equal(t, []*Command{{Cmd: "HSET", Args: []string{"h", "f", "0.30000000000000004"}}},
+		s.aofCommands(&Command{Cmd: "HINCRBYFLOAT", Args: []string{"h", "f", "0.2"}}))
+}
+
+func TestAof_hashFieldTTLsAreLoggedAsAbsolute(t *testing.T) {
+	s := NewStorage()
+	s.cmdHSET([]string{"h", "a", "1", "b", "2", "c", "3"})
+	hexpire := &Command{Cmd: "HEXPIRE", Args: []string{"h", "100", "FIELDS", "3", "a", "b", "missing"}}
+	s.cmdHEXPIRE(hexpire.Args)
+	hash, _ := s.lookupHash("h")
+	exp, _ := hash.Expiry("a")
+	at := strconv.FormatUint(exp, 10)
+	assert.Equal(t, []*Command{
+		{Cmd: "HDEL", Args: []string{"h", "missing"}},
+		{Cmd: "HPEXPIREAT", Args: []string{"h", at, "FIELDS", "2", "a", "b"}},
+	}, s.aofCommands(hexpire))
+
+	s.cmdHINCRBYFLOAT([]string{"h", "a", "0.5"})
+	assert.Equal(t, []*Command{
+		{Cmd: "HSET", Args: []string{"h", "a", "1.5"}},
+		{Cmd: "HPEXPIREAT", Args: []string{"h", at, "FIELDS", "1", "a"}},
+	}, s.aofCommands(&Command{Cmd: "HINCRBYFLOAT", Args: []string{"h", "a", "0.5"}}))
+
+	hexpire = &Command{Cmd: "HPEXPIREAT", Args: []string{"h", "1", "NX", "FIELDS", "1", "c"}}
+	s.cmdHPEXPIREAT(hexpire.Args)
+	assert.Equal(t, []*Command{{Cmd: "HDEL", Args: []string{"h", "c"}}}, s.aofCommands(hexpire))
+
+	hexpire = &Command{Cmd: "HEXPIRE", Args: []string{"h", "0", "FIELDS", "2", "a", "b"}}
+	s.cmdHEXPIRE(hexpire.Args)
+	assert.Equal(t, []*Command{{Cmd: "DEL", Args: []string{"h"}}}, s.aofCommands(hexpire))
+}
+
+func TestAof_GETEXIsLoggedAsItsTTL(t *testing.T) {
+	s := NewStorage()
+	s.cmdSET([]string{"k", "v"})
+	s.cmdGETEX([]string{"k", "EX", "100"})
+	exp, _ := s.dictStore.GetExpiry("k")
+	assert.Equal(t, []*Command{{Cmd: "PEXPIREAT", Args: []string{"k", strconv.FormatUint(exp, 10)}}},
+		s.aofCommands(&Command{Cmd: "GETEX", Args: []string{"k", "EX", "100"}}))
+
+	s.cmdGETEX([]string{"k", "PERSIST"})
+	assert.Equal(t, []*Command{{Cmd: "PERSIST", Args: []string{"k"}}}, s.aofCommands(&Command{Cmd: "GETEX", Args: []string{"k", "PERSIST"}}))
+
+	s.cmdGETEX([]string{"k", "PXAT", "1"})
+	assert.Equal(t, []*Command{{Cmd: "DEL", Args: []string{"k"}}}, s.aofCommands(&Command{Cmd: "GETEX", Args: []string{"k", "PXAT", "1"}}))
+}
+
+func TestAof_replayKeepsDeadline(t *testing.T) {
+	useAppendOnly(t, constant.AppendFsyncAlways)
+	d := NewDispatcher(2)
+	assert.NoError(t, d.OpenAppendOnly())
+	d.Execute(&Command{Cmd: "SET", Args: []string{"short", "v", "EX", "1"}})
+	d.Execute(&Command{Cmd: "SET", Args: []string{"long", "v"}})
+	d.Execute(&Command{Cmd: "EXPIRE", Args: []string{"long", "100"}})
+	d.Close()
+
+	// The server is down past the deadline of "short".
+	time.Sleep(1100 * time.Millisecond)
+
+	restarted := NewDispatcher(2)
+	defer restarted.Close()
+	assert.NoError(t, restarted.LoadAppendOnly())
+	assert.Equal(t, "$-1\r\n", string(restarted.Execute(&Command{Cmd: "GET", Args: []string{"short"}})))
+	var ttl int64
+	assert.NoError(t, DecodeInt64(restarted.Execute(&Command{Cmd: "TTL", Args: []string{"long"}}), &ttl))
+	assert.InDelta(t, 98, ttl, 1)
+}
+
+func TestAof_truncatedTail(t *testing.T) {
+	useAppendOnly(t, constant.AppendFsyncAlways)
+	path := filepath.Join(config.Dir, config.AppendFilename)
+	complete := encodeCommand(&Command{Cmd: "SET", Args: []string{"a", "1"}})
+	partial := encodeCommand(&Command{Cmd: "SET", Args: []string{"b", "2"}})
+	assert.NoError(t, os.WriteFile(path, append(complete, partial[:len(partial)-3]...), 0644))
+
+	loadTruncated := config.AofLoadTruncated
+	t.Cleanup(func() { config.AofLoadTruncated = loadTruncated })
+
+	config.AofLoadTruncated = false
+	d := NewDispatcher(2)
+	assert.ErrorIs(t, d.LoadAppendOnly(), errAofTruncated)
+	d.Close()
+
+	config.AofLoadTruncated = true
+	d = NewDispatcher(2)
+	defer d.Close()
+	assert.NoError(t, d.LoadAppendOnly())
+	assert.Equal(t, string(Encode("1", false)), string(d.Execute(&Command{Cmd: "GET", Args: []string{"a"}})))
+	assert.Equal(t, "$-1\r\n", string(d.Execute(&Command{Cmd: "GET", Args: []string{"b"}})))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, complete, data)
+}
+
+func TestAof_badFormat(t *testing.T) {
+	useAppendOnly(t, constant.AppendFsyncAlways)
+	path := filepath.Join(config.Dir, config.AppendFilename)
+	data := append(encodeCommand(&Command{Cmd: "SET", Args: []string{"a", "1"}}), "garbage\r\n"...)
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+
+	d := NewDispatcher(1)
+	defer d.Close()
+	err := d.LoadAppendOnly()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errAofTruncated)
+}
+
+func TestCmdPEXPIREAT(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "v"})
+	at := time.Now().Add(time.Minute).UnixMilli()
+	assert.Equal(t, ":1\r\n", string(s.cmdPEXPIREAT([]string{"k", strconv.FormatInt(at, 10)})))
+	exp, ok := s.dictStore.GetExpiry("k")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(at), exp)
+
+	assert.Equal(t, ":0\r\n", string(s.cmdPEXPIREAT([]string{"missing", strconv.FormatInt(at, 10)})))
+	assert.Equal(t, ":1\r\n", string(s.cmdPEXPIREAT([]string{"k", "1"})))
+	assert.Nil(t, s.dictStore.Get("k"))
+	assert.Equal(t, "-(error) ERR value is not an integer or out of range\r\n", string(s.cmdPEXPIREAT([]string{"k", "soon"})))
+}
+
+func TestAof_BGREWRITEAOF(t *testing.T) {
+	useAppendOnly(t, constant.AppendFsyncEverySec)
+	path := filepath.Join(config.Dir, config.AppendFilename)
+	d := NewDispatcher(4)
+	assert.NoError(t, d.OpenAppendOnly())
+	d.Execute(&Command{Cmd: "CMS.INITBYDIM", Args: []string{"cms", "100", "5"}})
+	d.Execute(&Command{Cmd: "BF.RESERVE", Args: []string{"bf", "0.01", "100"}})
+	for i := 0; i < 200; i++ {
+		n := strconv.Itoa(i)
+		d.Execute(&Command{Cmd: "SET", Args: []string{"key", n}})
+		d.Execute(&Command{Cmd: "SADD", Args: []string{"set", n}})
+		d.Execute(&Command{Cmd: "RPUSH", Args: []string{"list", n}})
+		d.Execute(&Command{Cmd: "HSET", Args: []string{"hash", "f" + n, n}})
+		d.Execute(&Command{Cmd: "ZADD", Args: []string{"zset", n + ".5", "m" + n}})
+		d.Execute(&Command{Cmd: "CMS.INCRBY", Args: []string{"cms", "x", "1"}})
+		d.Execute(&Command{Cmd: "BF.MADD", Args: []string{"bf", n}})
+	}
+	d.Execute(&Command{Cmd: "EXPIRE", Args: []string{"key", "100"}})
+	d.Execute(&Command{Cmd: "HEXPIRE", Args: []string{"hash", "100", "FIELDS", "2", "f7", "f8"}})
+	before, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "+Background append only file rewriting started\r\n", string(d.Execute(&Command{Cmd: "BGREWRITEAOF"})))
+	// Writes made while the rewrite runs must survive it.
+	d.Execute(&Command{Cmd: "SET", Args: []string{"during", "v"}})
+	assert.Eventually(t, func() bool { return !d.aof.rewriteInFlight.Load() }, time.Second, time.Millisecond)
+	assert.True(t, d.aof.lastRewriteOK.Load())
+	d.Execute(&Command{Cmd: "SET", Args: []string{"after", "v"}})
+	d.Close()
+
+	after, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size()/2)
+
+	restarted := NewDispatcher(2)
+	defer restarted.Close()
+	assert.NoError(t, restarted.LoadAppendOnly())
+	assert.Equal(t, string(Encode("199", false)), string(restarted.Execute(&Command{Cmd: "GET", Args: []string{"key"}})))
+	var ttl int64
+	assert.NoError(t, DecodeInt64(restarted.Execute(&Command{Cmd: "TTL", Args: []string{"key"}}), &ttl))
+	assert.InDelta(t, 99, ttl, 1)
+	assert.Equal(t, ":1\r\n", string(restarted.Execute(&Command{Cmd: "SISMEMBER", Args: []string{"set", "150"}})))
+	assert.Equal(t, ":200\r\n", string(restarted.Execute(&Command{Cmd: "LLEN", Args: []string{"list"}})))
+	assert.Equal(t, string(Encode([]string{"0", "1", "2"}, false)), string(restarted.Execute(&Command{Cmd: "LRANGE", Args: []string{"list", "0", "2"}})))
+	assert.Equal(t, string(Encode("199", false)), string(restarted.Execute(&Command{Cmd: "LINDEX", Args: []string{"list", "-1"}})))
+	assert.Equal(t, ":200\r\n", string(restarted.Execute(&Command{Cmd: "HLEN", Args: []string{"hash"}})))
+	assert.Equal(t, string(Encode("150", false)), string(restarted.Execute(&Command{Cmd: "HGET", Args: []string{"hash", "f150"}})))
+	assert.Equal(t, "*3\r\n:100\r\n:100\r\n:-1\r\n", string(restarted.Execute(&Command{Cmd: "HTTL", Args: []string{"hash", "FIELDS", "3", "f7", "f8", "f9"}})))
+	assert.Equal(t, string(Encode("150.5", false)), string(restarted.Execute(&Command{Cmd: "ZSCORE", Args: []string{"zset", "m150"}})))
+	assert.Equal(t, "*1\r\n$3\r\n200\r\n", string(restarted.Execute(&Command{Cmd: "CMS.QUERY", Args: []string{"cms", "x"}})))
+	assert.Equal(t, ":1\r\n", string(restarted.Execute(&Command{Cmd: "BF.EXISTS", Args: []string{"bf", "42"}})))
+	assert.Equal(t, ":2\r\n", string(restarted.Execute(&Command{Cmd: "EXISTS", Args: []string{"during", "after"}})))
+}
+
+func TestAof_BGREWRITEAOFDisabled(t *testing.T) {
+	d := NewDispatcher(1)
+	defer d.Close()
+	assert.Equal(t, "-ERR Append only file is disabled\r\n", string(d.Execute(&Command{Cmd: "BGREWRITEAOF"})))
+}
+
+func TestAof_rewriteDue(t *testing.T) {
+	percentage, minSize := config.AutoAofRewritePercentage, config.AutoAofRewriteMinSize
+	t.Cleanup(func() { config.AutoAofRewritePercentage, config.AutoAofRewriteMinSize = percentage, minSize })
+	config.AutoAofRewritePercentage, config.AutoAofRewriteMinSize = 100, 1000
+
+	aof := &appendOnlyFile{}
+	aof.baseSize.Store(600)
+	aof.size.Store(900)
+	_, due := aof.rewriteDue()
+	assert.False(t, due, "below the minimum size")
+
+	aof.size.Store(1100)
+	_, due = aof.rewriteDue()
+	assert.False(t, due, "grown by less than the percentage")
+
+	aof.size.Store(1200)
+	growth, due := aof.rewriteDue()
+	assert.True(t, due)
+	assert.Equal(t, int64(100), growth)
+
+	config.AutoAofRewritePercentage = 0
+	_, due = aof.rewriteDue()
+	assert.False(t, due, "disabled")
+}
+
+func TestAof_cronKeepsWritesPendingWhileAnFsyncIsInFlight(t *testing.T) {
+	aof, err := openAppendOnlyFile(filepath.Join(t.TempDir(), "appendonly.aof"), constant.AppendFsyncEverySec)
+	assert.NoError(t, err)
+	defer aof.file.Close()
+
+	// The sync of an earlier tick hasn't returned yet.
+	aof.fsyncInFlight.Store(true)
+	aof.feed([]*Command{{Cmd: "SET", Args: []string{"k", "v"}}})
+	aof.cron()
+	aof.mu.Lock()
+	assert.True(t, aof.unsynced, "writes dropped while an fsync was in flight")
+	aof.mu.Unlock()
+
+	// Once it has, the next tick syncs them.
+	aof.fsyncInFlight.Store(false)
+	aof.cron()
+	aof.mu.Lock()
+	assert.False(t, aof.unsynced)
+	aof.mu.Unlock()
+	assert.Eventually(t, func() bool { return !aof.fsyncInFlight.Load() }, time.Second, time.Millisecond)
+}
+
+func TestAof_failedWritesStayPendingAndReported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, err := openAppendOnlyFile(path, constant.AppendFsyncEverySec)
+	assert.NoError(t, err)
+	good := aof.file
+	defer good.Close()
+
+	// A file that can't be written to, nor synced.
+	bad, err := os.Open(path)
+	assert.NoError(t, err)
+	bad.Close()
+	aof.file = bad
+	aof.feed([]*Command{{Cmd: "SET", Args: []string{"k", "v"}}})
+	assert.False(t, aof.lastWriteOK.Load())
+	aof.mu.Lock()
+	assert.True(t, aof.unsynced)
+	assert.Error(t, aof.writeErr)
+	aof.mu.Unlock()
+
+	// The failed sync is reported, and retried on the next tick.
+	aof.cron()
+	assert.Eventually(t, func() bool { return !aof.fsyncInFlight.Load() }, time.Second, time.Millisecond)
+	aof.mu.Lock()
+	assert.True(t, aof.unsynced, "failed fsync not retried")
+	aof.file = good
+	aof.mu.Unlock()
+	assert.False(t, aof.lastWriteOK.Load())
+
+	// A write that goes through clears the error.
+	aof.feed([]*Command{{Cmd: "SET", Args: []string{"k", "v"}}})
+	assert.True(t, aof.lastWriteOK.Load())
+	aof.mu.Lock()
+	assert.NoError(t, aof.writeErr)
+	aof.mu.Unlock()
+}
+
+func TestAof_rewriteClosesTheOldFileAfterTheFsyncInFlight(t *testing.T) {
+	aof, err := openAppendOnlyFile(filepath.Join(t.TempDir(), "appendonly.aof"), constant.AppendFsyncEverySec)
+	assert.NoError(t, err)
+	old := aof.file
+
+	// The cron's fsync of the old file hasn't returned yet.
+	fsyncDone := make(chan struct{})
+	aof.fsyncDone = fsyncDone
+	aof.rewriteBuf = &bytes.Buffer{}
+	finished := make(chan error)
+	go func() { finished <- aof.finishRewrite(nil) }()
+
+	select {
+	case err := <-finished:
+		t.Fatalf("rewrite finished before the fsync, err %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err = old.Stat()
+	assert.NoError(t, err, "old file closed under the fsync")
+
+	close(fsyncDone)
+	assert.NoError(t, <-finished)
+	_, err = old.Stat()
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.NotSame(t, old, aof.file)
+	aof.file.Close()
+}
+
+func dumpOf(t *testing.T, s *Storage, key string) string {
+	value, err := Decode(s.cmdDUMP([]string{key}))
+	assert.NoError(t, err)
+	return value.(string)
+}
+
+func TestCmdDUMPAndRESTORE(t *testing.T) {
+	src := setupStorage()
+	src.cmdSET([]string{"str", "hello"})
+	src.cmdSADD([]string{"set", "a", "b"})
+	src.cmdCMSINITBYDIM([]string{"cms", "100", "5"})
+	src.cmdCMSINCRBY([]string{"cms", "x", "4"})
+
+	dst := setupStorage()
+	for _, key := range []string{"str", "set", "cms"} {
+		payload := dumpOf(t, src, key)
+		assert.Equal(t, "+OK\r\n", string(dst.cmdRESTORE([]string{key, "0", payload})))
+		assert.Equal(t, "-BUSYKEY Target key name already exists.\r\n", string(dst.cmdRESTORE([]string{key, "0", payload})))
+		assert.Equal(t, "+OK\r\n", string(dst.cmdRESTORE([]string{key, "0", payload, "REPLACE"})))
+	}
+	assert.Equal(t, string(Encode("hello", false)), string(dst.cmdGET([]string{"str"})))
+	assert.Equal(t, ":1\r\n", string(dst.cmdSISMEMBER([]string{"set", "b"})))
+	cms, err := dst.lookupCMS("cms")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), cms.Count("x"))
+
+	payload := dumpOf(t, src, "str")
+	assert.Equal(t, "+OK\r\n", string(dst.cmdRESTORE([]string{"ttl", "5000", payload})))
+	var ttl int64
+	assert.NoError(t, DecodeInt64(dst.cmdTTL([]string{"ttl"}), &ttl))
+	assert.InDelta(t, 5, ttl, 1)
+
+	corrupted := []byte(payload)
+	corrupted[1] ^= 0xFF
+	assert.Equal(t, "-ERR DUMP payload version or checksum are wrong\r\n", string(dst.cmdRESTORE([]string{"bad", "0", string(corrupted)})))
+	assert.Equal(t, "$-1\r\n", string(src.cmdDUMP([]string{"missing"})))
+}
+
+func TestAof_onlyCommandsThatChangedSomethingAreLogged(t *testing.T) {
+	useAppendOnly(t, constant.AppendFsyncAlways)
+	d := NewDispatcher(1)
+	defer d.Close()
+	assert.NoError(t, d.OpenAppendOnly())
+	d.Execute(&Command{Cmd: "SET", Args: []string{"lock", "a", "NX", "PX", "30000"}})
+	d.Execute(&Command{Cmd: "SET", Args: []string{"lock", "b", "NX", "PX", "30000"}})
+	d.Execute(&Command{Cmd: "SET", Args: []string{"missing", "v", "XX"}})
+	d.Execute(&Command{Cmd: "DEL", Args: []string{"missing"}})
+	d.Execute(&Command{Cmd: "SREM", Args: []string{"missing", "m"}})
+
+	data, err := os.ReadFile(filepath.Join(config.Dir, config.AppendFilename))
+	assert.NoError(t, err)
+	cmds, _, err := parseAof(data)
+	assert.NoError(t, err)
+	assert.Len(t, cmds, 2)
+	assert.Equal(t, &Command{Cmd: "SET", Args: []string{"lock", "a"}}, cmds[0])
+	assert.Equal(t, "PEXPIREAT", cmds[1].Cmd)
+}
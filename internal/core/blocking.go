@@ -0,0 +1,268 @@
+package core
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+)
+
+// blockingCommands wait for an element when the lists they pop from are
+// empty. Run through Dispatcher.Submit they behave like their non-blocking
+// counterparts and reply nil at once; Dispatcher.Block parks them instead.
+var blockingCommands = map[string]bool{
+	"BLPOP":  true,
+	"BRPOP":  true,
+	"BLMOVE": true,
+}
+
+// IsBlockingCommand reports whether cmd should go through Dispatcher.Block.
+func IsBlockingCommand(name string) bool {
+	return blockingCommands[name]
+}
+
+// BlockedClient is a blocking command parked on the shard owning its keys
+// until one of them holds a list, or until it is unblocked. Its reply is
+// handed to deliver, which runs on the shard's worker and must not block.
+type BlockedClient struct {
+	cmd     *Command
+	keys    []string
+	timeout time.Duration
+	shard   *Shard
+	deliver func(reply []byte)
+	// queued is the place of the client in the queue of each key it waits
+	// on, nil once it doesn't wait anymore.
+	queued map[string]*list.Element
+}
+
+// Timeout is how long the client may wait, 0 meaning forever. Enforcing it is
+// up to the caller, who unblocks the client once it has passed.
+func (b *BlockedClient) Timeout() time.Duration {
+	return b.timeout
+}
+
+// parseBlockTimeout parses a timeout in seconds, which may have a fraction.
+func parseBlockTimeout(v string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) || secs > math.MaxInt64/float64(time.Second) {
+		return 0, errors.New("(error) ERR timeout is not a float or out of range")
+	}
+	if secs < 0 {
+		return 0, errors.New("(error) ERR timeout is negative")
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// parseBlocking checks the arguments of a blocking command and returns the
+// keys it waits on and its timeout. BLPOP and BRPOP are key [key ...]
+// timeout, BLMOVE is source destination LEFT | RIGHT LEFT | RIGHT timeout and
+// only waits on source.
+func parseBlocking(cmd *Command) ([]string, time.Duration, error) {
+	args := cmd.Args
+	errArity := fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", cmd.Cmd)
+	var keys []string
+	if cmd.Cmd == "BLMOVE" {
+		if len(args) != 5 {
+			return nil, 0, errArity
+		}
+		for _, end := range args[2:4] {
+			if _, err := parseListEnd(end); err != nil {
+				return nil, 0, err
+			}
+		}
+		keys = args[:1]
+	} else {
+		if len(args) < 2 {
+			return nil, 0, errArity
+		}
+		keys = args[:len(args)-1]
+	}
+	timeout, err := parseBlockTimeout(args[len(args)-1])
+	return keys, timeout, err
+}
+
+// timeoutReply is what a blocking command replies when nothing came in time.
+func timeoutReply(cmd *Command) []byte {
+	if cmd.Cmd == "BLMOVE" {
+		return constant.RespNil
+	}
+	return constant.RespNilArray
+}
+
+// Block runs a blocking command for a client that can wait for the reply.
+// The reply, whether it comes at once, once a key gets an element or as the
+// timeout reply after Unblock, is always handed to deliver, exactly once.
+// Block returns nil when the reply was an error delivered right away.
+//
+// All the keys of the command must live on one shard. Clients blocked on the
+// same key are served in the order they blocked.
+func (d *Dispatcher) Block(cmd *Command, deliver func(reply []byte)) *BlockedClient {
+	d.stats.totalCommands.Add(1)
+	keys, timeout, err := parseBlocking(cmd)
+	if err != nil {
+		deliver(Encode(err, false))
+		return nil
+	}
+	sh := d.shardOf(cmd.Args[0])
+	for _, key := range commandKeys[cmd.Cmd].keys(cmd.Args) {
+		if d.shardOf(key) != sh {
+			deliver(Encode(errCrossSlot, false))
+			return nil
+		}
+	}
+	b := &BlockedClient{cmd: cmd, keys: keys, timeout: timeout, shard: sh, deliver: deliver}
+	sh.tasks <- &task{run: func(s *Storage) []byte {
+		s.block(b)
+		return nil
+	}}
+	return b
+}
+
+// Unblock gives up waiting for b, which then gets its timeout reply unless it
+// was served meanwhile.
+func (d *Dispatcher) Unblock(b *BlockedClient) {
+	b.shard.tasks <- &task{run: func(s *Storage) []byte {
+		if b.queued != nil {
+			s.unqueue(b)
+			b.deliver(timeoutReply(b.cmd))
+		}
+		return nil
+	}}
+}
+
+// block serves b right away if it can, or queues it on each of its keys.
+func (s *Storage) block(b *BlockedClient) {
+	if res, ok := s.serveNow(b.cmd); ok {
+		b.deliver(res)
+		// A BLMOVE may have fed a list others wait on.
+		s.serveBlockedClients()
+		return
+	}
+	b.queued = make(map[string]*list.Element, len(b.keys))
+	for _, key := range b.keys {
+		if _, dup := b.queued[key]; dup {
+			continue
+		}
+		queue, ok := s.blocking[key]
+		if !ok {
+			queue = list.New()
+			s.blocking[key] = queue
+		}
+		b.queued[key] = queue.PushBack(b)
+	}
+}
+
+func (s *Storage) unqueue(b *BlockedClient) {
+	for key, e := range b.queued {
+		queue := s.blocking[key]
+		queue.Remove(e)
+		if queue.Len() == 0 {
+			delete(s.blocking, key)
+		}
+	}
+	b.queued = nil
+}
+
+// serveNow runs a blocking command against the first of its keys holding a
+// list. ok is false when all of them are empty.
+func (s *Storage) serveNow(cmd *Command) (res []byte, ok bool) {
+	keys, _, err := parseBlocking(cmd)
+	if err != nil {
+		return Encode(err, false), true
+	}
+	for _, key := range keys {
+		l, err := s.lookupList(key)
+		if err != nil {
+			return Encode(err, false), true
+		}
+		if l != nil {
+			return s.serveBlocked(cmd, key), true
+		}
+	}
+	return nil, false
+}
+
+// serveBlocked pops for cmd from the list at key, which must not be empty.
+// The AOF gets the non-blocking command that did the same.
+func (s *Storage) serveBlocked(cmd *Command, key string) []byte {
+	if cmd.Cmd == "BLMOVE" {
+		lmove := &Command{Cmd: "LMOVE", Args: cmd.Args[:4]}
+		dirty := s.dirty.Load()
+		res := s.cmdLMOVE(lmove.Args)
+		if s.aof != nil && s.dirty.Load() != dirty {
+			s.aof.feed([]*Command{lmove})
+		}
+		return res
+	}
+	l, _ := s.lookupList(key)
+	var v string
+	if cmd.Cmd == "BLPOP" {
+		v, _ = l.PopHead()
+	} else {
+		v, _ = l.PopTail()
+	}
+	s.deleteIfEmpty(key, l)
+	s.dirty.Add(1)
+	if s.aof != nil {
+		// BLPOP -> LPOP, BRPOP -> RPOP
+		s.aof.feed([]*Command{{Cmd: cmd.Cmd[1:], Args: []string{key}}})
+	}
+	return Encode([]string{key, v}, false)
+}
+
+// signalKeyAsReady notes that key, which may have clients blocked on it,
+// now holds a list. Every handler that creates a list calls it.
+func (s *Storage) signalKeyAsReady(key string) {
+	if _, ok := s.blocking[key]; !ok {
+		return
+	}
+	if _, ok := s.readyKeySet[key]; ok {
+		return
+	}
+	s.readyKeySet[key] = struct{}{}
+	s.readyKeys = append(s.readyKeys, key)
+}
+
+// serveBlockedClients hands elements to the clients blocked on the ready
+// keys, key by key in the order they got a list, and on each key the longest
+// waiting first. Serving a BLMOVE can feed another waited on list, which then
+// joins the end of the ready keys.
+func (s *Storage) serveBlockedClients() {
+	for i := 0; i < len(s.readyKeys); i++ {
+		key := s.readyKeys[i]
+		delete(s.readyKeySet, key)
+		queue := s.blocking[key]
+		for queue != nil && queue.Len() > 0 {
+			if l, err := s.lookupList(key); err != nil || l == nil {
+				break
+			}
+			b := queue.Front().Value.(*BlockedClient)
+			s.unqueue(b)
+			b.deliver(s.serveBlocked(b.cmd, key))
+		}
+	}
+	s.readyKeys = s.readyKeys[:0]
+}
+
+func blockingPop(s *Storage, cmd *Command) []byte {
+	if res, ok := s.serveNow(cmd); ok {
+		return res
+	}
+	return timeoutReply(cmd)
+}
+
+func (s *Storage) cmdBLPOP(args []string) []byte {
+	return blockingPop(s, &Command{Cmd: "BLPOP", Args: args})
+}
+
+func (s *Storage) cmdBRPOP(args []string) []byte {
+	return blockingPop(s, &Command{Cmd: "BRPOP", Args: args})
+}
+
+func (s *Storage) cmdBLMOVE(args []string) []byte {
+	return blockingPop(s, &Command{Cmd: "BLMOVE", Args: args})
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+)
+
+// blockClient blocks cmd on d and returns the channel its reply arrives on.
+func blockClient(d *Dispatcher, cmd string, args ...string) (*BlockedClient, chan []byte) {
+	replies := make(chan []byte, 2)
+	b := d.Block(&Command{Cmd: cmd, Args: args}, func(reply []byte) { replies <- reply })
+	return b, replies
+}
+
+func receive(t *testing.T, replies chan []byte) string {
+	t.Helper()
+	select {
+	case reply := <-replies:
+		return string(reply)
+	case <-time.After(time.Second):
+		t.Fatal("no reply delivered")
+		return ""
+	}
+}
+
+func assertNoReply(t *testing.T, d *Dispatcher, replies chan []byte) {
+	t.Helper()
+	// A round trip through every shard lets queued deliveries happen first.
+	d.Execute(&Command{Cmd: "EXISTS", Args: []string{"a", "b", "c", "d", "e", "f"}})
+	select {
+	case reply := <-replies:
+		t.Fatalf("unexpected reply %q", reply)
+	default:
+	}
+}
+
+func TestBlock_servesRightAway(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+	d.Execute(&Command{Cmd: "RPUSH", Args: []string{"q", "a", "b"}})
+
+	_, replies := blockClient(d, "BLPOP", "{q}missing", "q", "0")
+	assert.Equal(t, string(Encode([]string{"q", "a"}, false)), receive(t, replies))
+	_, replies = blockClient(d, "BRPOP", "q", "0")
+	assert.Equal(t, string(Encode([]string{"q", "b"}, false)), receive(t, replies))
+	assert.Equal(t, ":0\r\n", string(d.Execute(&Command{Cmd: "EXISTS", Args: []string{"q"}})))
+}
+
+func TestBlock_servesInBlockingOrder(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	_, first := blockClient(d, "BLPOP", "q", "0")
+	_, second := blockClient(d, "BRPOP", "{q}other", "q", "0")
+	_, third := blockClient(d, "BLPOP", "q", "0")
+	assertNoReply(t, d, first)
+
+	assert.Equal(t, ":2\r\n", string(d.Execute(&Command{Cmd: "RPUSH", Args: []string{"q", "a", "b"}})))
+	assert.Equal(t, string(Encode([]string{"q", "a"}, false)), receive(t, first))
+	assert.Equal(t, string(Encode([]string{"q", "b"}, false)), receive(t, second))
+	assertNoReply(t, d, third)
+
+	d.Execute(&Command{Cmd: "LPUSH", Args: []string{"q", "c"}})
+	assert.Equal(t, string(Encode([]string{"q", "c"}, false)), receive(t, third))
+	assert.Equal(t, ":0\r\n", string(d.Execute(&Command{Cmd: "EXISTS", Args: []string{"q"}})))
+}
+
+func TestBlock_unblock(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	b, replies := blockClient(d, "BLPOP", "q", "1.5")
+	assert.Equal(t, 1500*time.Millisecond, b.Timeout())
+	d.Unblock(b)
+	assert.Equal(t, string(constant.RespNilArray), receive(t, replies))
+
+	// An unblocked client no longer takes elements.
+	d.Execute(&Command{Cmd: "RPUSH", Args: []string{"q", "a"}})
+	assertNoReply(t, d, replies)
+	assert.Equal(t, ":1\r\n", string(d.Execute(&Command{Cmd: "LLEN", Args: []string{"q"}})))
+
+	// Nor does unblocking a served client reply twice.
+	b, replies = blockClient(d, "BLMOVE", "q", "{q}dst", "LEFT", "LEFT", "0")
+	assert.Equal(t, "$1\r\na\r\n", receive(t, replies))
+	d.Unblock(b)
+	assertNoReply(t, d, replies)
+
+	b, replies = blockClient(d, "BLMOVE", "q", "{q}dst", "LEFT", "LEFT", "0")
+	d.Unblock(b)
+	assert.Equal(t, string(constant.RespNil), receive(t, replies))
+}
+
+func TestBlock_BLMOVEFeedsOtherBlockedClients(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	_, mover := blockClient(d, "BLMOVE", "{q}src", "{q}dst", "RIGHT", "LEFT", "0")
+	_, popper := blockClient(d, "BLPOP", "{q}dst", "0")
+	d.Execute(&Command{Cmd: "RPUSH", Args: []string{"{q}src", "a", "b"}})
+	assert.Equal(t, "$1\r\nb\r\n", receive(t, mover))
+	assert.Equal(t, string(Encode([]string{"{q}dst", "b"}, false)), receive(t, popper))
+	assert.Equal(t, string(Encode([]string{"a"}, false)),
+		string(d.Execute(&Command{Cmd: "LRANGE", Args: []string{"{q}src", "0", "-1"}})))
+	assert.Equal(t, ":0\r\n", string(d.Execute(&Command{Cmd: "EXISTS", Args: []string{"{q}dst"}})))
+}
+
+func TestBlock_servesKeysInTheOrderTheyBecameReady(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	_, popper := blockClient(d, "BLPOP", "{q}b", "{q}a", "0")
+	_, toA := blockClient(d, "BLMOVE", "{q}src", "{q}a", "LEFT", "LEFT", "0")
+	_, toB := blockClient(d, "BLMOVE", "{q}src", "{q}b", "LEFT", "LEFT", "0")
+	d.Execute(&Command{Cmd: "RPUSH", Args: []string{"{q}src", "1", "2"}})
+	assert.Equal(t, "$1\r\n1\r\n", receive(t, toA))
+	assert.Equal(t, "$1\r\n2\r\n", receive(t, toB))
+	// {q}a got its element first, so it is the one popped from.
+	assert.Equal(t, string(Encode([]string{"{q}a", "1"}, false)), receive(t, popper))
+	assert.Equal(t, string(Encode([]string{"2"}, false)),
+		string(d.Execute(&Command{Cmd: "LRANGE", Args: []string{"{q}b", "0", "-1"}})))
+}
+
+func TestBlock_errors(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+	d.Execute(&Command{Cmd: "SET", Args: []string{"str", "v"}})
+	assert.NotEqual(t, d.shardOf("a"), d.shardOf("b"))
+
+	testCases := []struct {
+		cmd  string
+		args []string
+		want string
+	}{
+		{"BLPOP", []string{"q"}, "-(error) ERR wrong number of arguments for 'BLPOP' command\r\n"},
+		{"BLPOP", []string{"q", "-1"}, "-(error) ERR timeout is negative\r\n"},
+		{"BRPOP", []string{"q", "soon"}, "-(error) ERR timeout is not a float or out of range\r\n"},
+		{"BLMOVE", []string{"q", "dst", "UP", "LEFT", "0"}, "-(error) ERR syntax error\r\n"},
+		{"BLPOP", []string{"a", "b", "0"}, string(Encode(errCrossSlot, false))},
+		{"BLMOVE", []string{"a", "b", "LEFT", "LEFT", "0"}, string(Encode(errCrossSlot, false))},
+		{"BLPOP", []string{"str", "0"}, wrongType},
+	}
+	for _, tc := range testCases {
+		_, replies := blockClient(d, tc.cmd, tc.args...)
+		assert.Equal(t, tc.want, receive(t, replies), tc.cmd)
+	}
+}
+
+func TestDispatcher_blockingCommandsDontBlockWhenSubmitted(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	assert.Equal(t, "*-1\r\n", string(d.Execute(&Command{Cmd: "BLPOP", Args: []string{"q", "0"}})))
+	assert.Equal(t, "$-1\r\n", string(d.Execute(&Command{Cmd: "BLMOVE", Args: []string{"q", "{q}dst", "LEFT", "RIGHT", "0"}})))
+	d.Execute(&Command{Cmd: "RPUSH", Args: []string{"q", "a", "b"}})
+	assert.Equal(t, string(Encode([]string{"q", "b"}, false)), string(d.Execute(&Command{Cmd: "BRPOP", Args: []string{"q", "0"}})))
+}
+
+func TestAof_servedBlockingCommandsAreLoggedAsPops(t *testing.T) {
+	useAppendOnly(t, constant.AppendFsyncAlways)
+	d := NewDispatcher(2)
+	assert.NoError(t, d.OpenAppendOnly())
+	_, popper := blockClient(d, "BLPOP", "q", "0")
+	_, mover := blockClient(d, "BLMOVE", "q", "{q}dst", "LEFT", "RIGHT", "0")
+	d.Execute(&Command{Cmd: "RPUSH", Args: []string{"q", "a", "b", "c"}})
+	receive(t, popper)
+	receive(t, mover)
+	d.Execute(&Command{Cmd: "BRPOP", Args: []string{"q", "0"}})
+	d.Close()
+
+	restarted := NewDispatcher(2)
+	defer restarted.Close()
+	assert.NoError(t, restarted.LoadAppendOnly())
+	assert.Equal(t, ":0\r\n", string(restarted.Execute(&Command{Cmd: "EXISTS", Args: []string{"q"}})))
+	assert.Equal(t, string(Encode([]string{"b"}, false)),
+		string(restarted.Execute(&Command{Cmd: "LRANGE", Args: []string{"{q}dst", "0", "-1"}})))
+}
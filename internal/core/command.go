@@ -1,6 +1,29 @@
 package core
 
+import (
+	"errors"
+	"strings"
+)
+
 type Command struct {
 	Cmd  string
 	Args []string
 }
+
+// NewCommand builds a Command from a decoded RESP value, which must be a
+// non-empty array of bulk strings.
+func NewCommand(value interface{}) (*Command, error) {
+	array, ok := value.([]interface{})
+	if !ok || len(array) == 0 {
+		return nil, ErrProtocol
+	}
+	tokens := make([]string, len(array))
+	for i := range tokens {
+		token, ok := array[i].(string)
+		if !ok {
+			return nil, errors.New("ERR Protocol error: expected bulk string")
+		}
+		tokens[i] = token
+	}
+	return &Command{Cmd: strings.ToUpper(tokens[0]), Args: tokens[1:]}, nil
+}
@@ -0,0 +1,506 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+// maxBitOffset is the last bit of the longest string allowed.
+const maxBitOffset = maxStringSize*8 - 1
+
+var errBitOffset = errors.New("(error) ERR bit offset is not an integer or out of range")
+
+func parseBitOffset(v string) (uint64, error) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 || n > maxBitOffset {
+		return 0, errBitOffset
+	}
+	return uint64(n), nil
+}
+
+// lookupBitmap returns the bytes of the string at key. The bit commands and
+// APPEND change strings in place, so a string is switched to the bytes
+// encoding the first time one of them uses it.
+func (s *Storage) lookupBitmap(key string) ([]byte, bool, error) {
+	obj := s.dictStore.Get(key)
+	if obj == nil {
+		return nil, false, nil
+	}
+	if obj.Type != data_structure.ObjTypeString {
+		return nil, false, errWrongType
+	}
+	if obj.Encoding != data_structure.ObjEncodingBytes {
+		obj.Value = []byte(stringOf(obj))
+		obj.Encoding = data_structure.ObjEncodingBytes
+	}
+	return obj.Value.([]byte), true, nil
+}
+
+// growBitmap returns the bitmap at key padded with zero bytes to at least
+// size bytes, creating the key if needed.
+func (s *Storage) growBitmap(key string, size uint64) ([]byte, error) {
+	b, found, err := s.lookupBitmap(key)
+	if err != nil {
+		return nil, err
+	}
+	if found && uint64(len(b)) >= size {
+		return b, nil
+	}
+	b = append(b, make([]byte, size-uint64(len(b)))...)
+	s.setValue(key, b)
+	return b, nil
+}
+
+func (s *Storage) cmdSETBIT(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'SETBIT' command"), false)
+	}
+	key := args[0]
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if args[2] != "0" && args[2] != "1" {
+		return Encode(errors.New("(error) ERR bit is not an integer or out of range"), false)
+	}
+	b, err := s.growBitmap(key, offset/8+1)
+	if err != nil {
+		return Encode(err, false)
+	}
+	old := data_structure.SetBit(b, offset, int(args[2][0]-'0'))
+	s.dirty.Add(1)
+	return Encode(int64(old), false)
+}
+
+func (s *Storage) cmdGETBIT(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'GETBIT' command"), false)
+	}
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return Encode(err, false)
+	}
+	b, _, err := s.lookupBitmap(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	return Encode(int64(data_structure.GetBit(b, offset)), false)
+}
+
+// parseBitRange parses the start, end and BYTE | BIT unit of BITCOUNT and
+// BITPOS.
+func parseBitRange(args []string) (start, end int64, isBit bool, err error) {
+	if start, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+		return 0, 0, false, errNotInteger
+	}
+	if end, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+		return 0, 0, false, errNotInteger
+	}
+	if len(args) == 3 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			isBit = true
+		default:
+			return 0, 0, false, errSyntax
+		}
+	}
+	return start, end, isBit, nil
+}
+
+// bitRange resolves start and end, in bytes or with isBit in bits, to the
+// bit offsets they cover in a string of n bytes. Negative values count from
+// the end, as for GETRANGE. ok is false when the range is empty.
+func bitRange(start, end int64, isBit bool, n int) (first, last uint64, ok bool) {
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, false
+	}
+	total := int64(n)
+	if isBit {
+		total *= 8
+	}
+	if start < 0 {
+		start = max(total+start, 0)
+	}
+	if end < 0 {
+		end = max(total+end, 0)
+	}
+	end = min(end, total-1)
+	if total == 0 || start > end {
+		return 0, 0, false
+	}
+	if isBit {
+		return uint64(start), uint64(end), true
+	}
+	return uint64(start) * 8, uint64(end)*8 + 7, true
+}
+
+// cmdBITCOUNT is BITCOUNT key [start end [BYTE | BIT]].
+func (s *Storage) cmdBITCOUNT(args []string) []byte {
+	if len(args) < 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'BITCOUNT' command"), false)
+	}
+	if len(args) != 1 && len(args) != 3 && len(args) != 4 {
+		return Encode(errSyntax, false)
+	}
+	start, end, isBit := int64(0), int64(-1), false
+	if len(args) > 1 {
+		var err error
+		if start, end, isBit, err = parseBitRange(args[1:]); err != nil {
+			return Encode(err, false)
+		}
+	}
+	b, _, err := s.lookupBitmap(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	first, last, ok := bitRange(start, end, isBit, len(b))
+	if !ok {
+		return constant.RespZero
+	}
+	return Encode(data_structure.BitCount(b, first, last), false)
+}
+
+// cmdBITPOS is BITPOS key bit [start [end [BYTE | BIT]]].
+func (s *Storage) cmdBITPOS(args []string) []byte {
+	if len(args) < 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'BITPOS' command"), false)
+	}
+	if len(args) > 5 {
+		return Encode(errSyntax, false)
+	}
+	bit, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	if bit != 0 && bit != 1 {
+		return Encode(errors.New("(error) ERR The bit argument must be 1 or 0."), false)
+	}
+	start, end, isBit := int64(0), int64(-1), false
+	endGiven := len(args) > 3
+	switch len(args) {
+	case 3:
+		if start, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return Encode(errNotInteger, false)
+		}
+	case 4, 5:
+		if start, end, isBit, err = parseBitRange(args[2:]); err != nil {
+			return Encode(err, false)
+		}
+	}
+
+	b, found, err := s.lookupBitmap(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if !found {
+		// A missing key is an empty string, all zero bits.
+		if bit == 1 {
+			return Encode(int64(-1), false)
+		}
+		return constant.RespZero
+	}
+	first, last, ok := bitRange(start, end, isBit, len(b))
+	if !ok {
+		return Encode(int64(-1), false)
+	}
+	pos := data_structure.BitPos(b, int(bit), first, last)
+	// Without an end the string is seen as padded with zero bits, so a clear
+	// bit is always found right after it.
+	if pos == -1 && bit == 0 && !endGiven {
+		pos = int64(last) + 1
+	}
+	return Encode(pos, false)
+}
+
+// bitop computes BITOP op destkey key [key ...] without storing the result.
+func bitop(args []string, storageOf func(key string) *Storage) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, errors.New("(error) ERR wrong number of arguments for 'BITOP' command")
+	}
+	op := strings.ToUpper(args[0])
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(args) != 3 {
+			return nil, errors.New("(error) ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return nil, errSyntax
+	}
+
+	srcs := make([][]byte, len(args)-2)
+	size := 0
+	for i, key := range args[2:] {
+		b, _, err := storageOf(key).lookupBitmap(key)
+		if err != nil {
+			return nil, err
+		}
+		srcs[i] = b
+		size = max(size, len(b))
+	}
+	// Shorter sources are padded with zero bytes.
+	res := make([]byte, size)
+	if op == "NOT" {
+		for i, c := range srcs[0] {
+			res[i] = ^c
+		}
+		return res, nil
+	}
+	copy(res, srcs[0])
+	for _, src := range srcs[1:] {
+		for i := range res {
+			var c byte
+			if i < len(src) {
+				c = src[i]
+			}
+			switch op {
+			case "AND":
+				res[i] &= c
+			case "OR":
+				res[i] |= c
+			case "XOR":
+				res[i] ^= c
+			}
+		}
+	}
+	return res, nil
+}
+
+// cmdBITOP stores the result at destkey, which loses its TTL, and replies
+// with its length. An empty result deletes destkey.
+func (s *Storage) cmdBITOP(args []string) []byte {
+	res, err := bitop(args, func(string) *Storage { return s })
+	if err != nil {
+		return Encode(err, false)
+	}
+	dest := args[1]
+	if len(res) == 0 {
+		s.dictStore.Del(dest)
+	} else {
+		s.dictStore.Set(dest, s.dictStore.NewObj(dest, res, -1))
+		s.dictStore.DelExpiry(dest)
+	}
+	s.dirty.Add(1)
+	return Encode(int64(len(res)), false)
+}
+
+// bitopAcrossShards runs BITOP with keys on several shards. The result is
+// stored with a SET, or a DEL when empty, on the shard owning destkey, so that
+// the AOF gets a command it can replay on that shard alone.
+func bitopAcrossShards(cmd *Command, storageOf func(key string) *Storage) []byte {
+	res, err := bitop(cmd.Args, storageOf)
+	if err != nil {
+		return Encode(err, false)
+	}
+	dest := cmd.Args[1]
+	store := &Command{Cmd: "SET", Args: []string{dest, string(res)}}
+	if len(res) == 0 {
+		store = &Command{Cmd: "DEL", Args: []string{dest}}
+	}
+	_ = storageOf(dest).ExecuteAndResponse(store, io.Discard)
+	return Encode(int64(len(res)), false)
+}
+
+// bitfieldOp is one GET, SET or INCRBY of a BITFIELD command.
+type bitfieldOp struct {
+	kind   string
+	signed bool
+	width  uint
+	offset uint64
+	// value is the argument of SET and INCRBY.
+	value int64
+	// overflow is WRAP, SAT or FAIL, as set by the last OVERFLOW before it.
+	overflow string
+}
+
+// parseBitfieldType parses a field type such as i16 or u8. Signed fields
+// have 1 to 64 bits, unsigned ones 1 to 63 so their value fits an int64.
+func parseBitfieldType(v string) (signed bool, width uint, err error) {
+	errType := errors.New("(error) ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(v) < 2 {
+		return false, 0, errType
+	}
+	switch v[0] {
+	case 'i', 'I':
+		signed = true
+	case 'u', 'U':
+	default:
+		return false, 0, errType
+	}
+	n, err := strconv.ParseUint(v[1:], 10, 8)
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return false, 0, errType
+	}
+	return signed, uint(n), nil
+}
+
+// parseBitfieldOffset parses a bit offset, or with a # prefix an index
+// multiplied by the field width.
+func parseBitfieldOffset(v string, width uint) (uint64, error) {
+	multiply := strings.HasPrefix(v, "#")
+	n, err := strconv.ParseInt(strings.TrimPrefix(v, "#"), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errBitOffset
+	}
+	if multiply {
+		if n > math.MaxInt64/int64(width) {
+			return 0, errBitOffset
+		}
+		n *= int64(width)
+	}
+	if n > maxBitOffset-int64(width)+1 {
+		return 0, errBitOffset
+	}
+	return uint64(n), nil
+}
+
+func parseBitfieldOps(args []string) ([]bitfieldOp, error) {
+	var ops []bitfieldOp
+	overflow := "WRAP"
+	for i := 0; i < len(args); i++ {
+		switch kind := strings.ToUpper(args[i]); kind {
+		case "OVERFLOW":
+			if i+1 == len(args) {
+				return nil, errSyntax
+			}
+			i++
+			overflow = strings.ToUpper(args[i])
+			if overflow != "WRAP" && overflow != "SAT" && overflow != "FAIL" {
+				return nil, errors.New("(error) ERR Invalid OVERFLOW type specified")
+			}
+		case "GET", "SET", "INCRBY":
+			nargs := 3
+			if kind == "GET" {
+				nargs = 2
+			}
+			if i+nargs >= len(args) {
+				return nil, errSyntax
+			}
+			op := bitfieldOp{kind: kind, overflow: overflow}
+			var err error
+			if op.signed, op.width, err = parseBitfieldType(args[i+1]); err != nil {
+				return nil, err
+			}
+			if op.offset, err = parseBitfieldOffset(args[i+2], op.width); err != nil {
+				return nil, err
+			}
+			if kind != "GET" {
+				if op.value, err = strconv.ParseInt(args[i+3], 10, 64); err != nil {
+					return nil, errNotInteger
+				}
+			}
+			ops = append(ops, op)
+			i += nargs
+		default:
+			return nil, errSyntax
+		}
+	}
+	return ops, nil
+}
+
+// read returns the value of the field in b.
+func (op *bitfieldOp) read(b []byte) int64 {
+	v := data_structure.GetBitfield(b, op.offset, op.width)
+	if op.signed {
+		// Sign-extend from the top bit of the field.
+		shift := 64 - op.width
+		return int64(v<<shift) >> shift
+	}
+	return int64(v)
+}
+
+// fit returns value+incr brought into the range of the field by the overflow
+// policy. ok is false when it doesn't fit and the policy is FAIL.
+func (op *bitfieldOp) fit(value, incr int64) (res int64, ok bool) {
+	var overflow, underflow bool
+	var maxValue, minValue, wrapped int64
+	if op.signed {
+		maxValue = int64(math.MaxInt64 >> (64 - op.width))
+		minValue = -maxValue - 1
+		overflow = value > maxValue || (incr > 0 && value > maxValue-incr)
+		underflow = value < minValue || (incr < 0 && value < minValue-incr)
+		shift := 64 - op.width
+		wrapped = int64((uint64(value)+uint64(incr))<<shift) >> shift
+	} else {
+		mask := uint64(1)<<op.width - 1
+		maxValue = int64(mask)
+		uv := uint64(value)
+		// A negative value to SET is seen as a huge unsigned one.
+		overflow = uv > mask || (incr > 0 && uint64(incr) > mask-uv)
+		underflow = !overflow && incr < 0 && uint64(-incr) > uv
+		wrapped = int64((uv + uint64(incr)) & mask)
+	}
+	if !overflow && !underflow {
+		return value + incr, true
+	}
+	switch op.overflow {
+	case "SAT":
+		if overflow {
+			return maxValue, true
+		}
+		return minValue, true
+	case "FAIL":
+		return 0, false
+	}
+	return wrapped, true
+}
+
+// cmdBITFIELD is BITFIELD key [GET type offset | [OVERFLOW WRAP | SAT | FAIL]
+// SET type offset value | [OVERFLOW ...] INCRBY type offset increment ...].
+// It replies with one entry per GET, SET and INCRBY: the value read, the
+// value replaced and the new value, or nil when OVERFLOW FAIL stopped a write.
+func (s *Storage) cmdBITFIELD(args []string) []byte {
+	if len(args) < 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'BITFIELD' command"), false)
+	}
+	key := args[0]
+	ops, err := parseBitfieldOps(args[1:])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if _, _, err := s.lookupBitmap(key); err != nil {
+		return Encode(err, false)
+	}
+
+	res := make([]interface{}, len(ops))
+	changes := 0
+	for i := range ops {
+		op := &ops[i]
+		b, _, _ := s.lookupBitmap(key)
+		old := op.read(b)
+		if op.kind == "GET" {
+			res[i] = old
+			continue
+		}
+
+		var v int64
+		var ok bool
+		if op.kind == "SET" {
+			v, ok = op.fit(op.value, 0)
+		} else {
+			v, ok = op.fit(old, op.value)
+		}
+		if !ok {
+			continue
+		}
+		if b, err = s.growBitmap(key, (op.offset+uint64(op.width)-1)/8+1); err != nil {
+			return Encode(err, false)
+		}
+		data_structure.SetBitfield(b, op.offset, op.width, uint64(v))
+		changes++
+		if op.kind == "SET" {
+			res[i] = old
+		} else {
+			res[i] = v
+		}
+	}
+	s.dirty.Add(int64(changes))
+	return Encode(res, false)
+}
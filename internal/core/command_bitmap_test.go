@@ -0,0 +1,226 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+func TestCmdSETBITAndGETBIT(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, ":0\r\n", string(s.cmdSETBIT([]string{"k", "7", "1"})))
+	assert.Equal(t, "$1\r\n\x01\r\n", string(s.cmdGET([]string{"k"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdSETBIT([]string{"k", "7", "0"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdGETBIT([]string{"k", "7"})))
+
+	// The string grows as needed, keeping its TTL.
+	s.cmdEXPIRE([]string{"k", "100"})
+	s.cmdSETBIT([]string{"k", "100", "1"})
+	assert.Equal(t, ":13\r\n", string(s.cmdSTRLEN([]string{"k"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdGETBIT([]string{"k", "100"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdGETBIT([]string{"k", "100000"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdGETBIT([]string{"missing", "3"})))
+	_, hasExp := s.dictStore.GetExpiry("k")
+	assert.True(t, hasExp)
+
+	// Strings of any encoding can be used as bitmaps.
+	s.cmdSET([]string{"n", "1"})
+	assert.Equal(t, ":1\r\n", string(s.cmdGETBIT([]string{"n", "7"})))
+	assert.Equal(t, data_structure.ObjEncodingBytes, s.dictStore.Get("n").Encoding)
+	s.cmdSETBIT([]string{"n", "6", "1"})
+	assert.Equal(t, ":4\r\n", string(s.cmdINCR([]string{"n"})))
+
+	assert.Equal(t, "-(error) ERR bit offset is not an integer or out of range\r\n", string(s.cmdSETBIT([]string{"k", "-1", "1"})))
+	assert.Equal(t, "-(error) ERR bit offset is not an integer or out of range\r\n", string(s.cmdSETBIT([]string{"k", "4294967296", "1"})))
+	assert.Equal(t, "-(error) ERR bit is not an integer or out of range\r\n", string(s.cmdSETBIT([]string{"k", "1", "2"})))
+	s.cmdSADD([]string{"set", "a"})
+	assert.Equal(t, wrongType, string(s.cmdSETBIT([]string{"set", "1", "1"})))
+	assert.Equal(t, wrongType, string(s.cmdGETBIT([]string{"set", "1"})))
+}
+
+func TestCmdBITCOUNT(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "foobar"})
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"k"}, ":26\r\n"},
+		{[]string{"k", "0", "0"}, ":4\r\n"},
+		{[]string{"k", "1", "1"}, ":6\r\n"},
+		{[]string{"k", "1", "1", "byte"}, ":6\r\n"},
+		{[]string{"k", "5", "30", "BIT"}, ":17\r\n"},
+		{[]string{"k", "-2", "-1"}, ":7\r\n"},
+		{[]string{"k", "0", "100"}, ":26\r\n"},
+		{[]string{"k", "3", "1"}, ":0\r\n"},
+		{[]string{"missing"}, ":0\r\n"},
+		{[]string{"k", "0"}, "-(error) ERR syntax error\r\n"},
+		{[]string{"k", "0", "1", "WORD"}, "-(error) ERR syntax error\r\n"},
+		{[]string{"k", "a", "1"}, "-(error) ERR value is not an integer or out of range\r\n"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, string(s.cmdBITCOUNT(tc.args)), tc.args)
+	}
+}
+
+func TestCmdBITPOS(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"ones", "\xff\xf0\x00"})
+	s.cmdSET([]string{"zeros", "\x00\xff\xf0"})
+	s.cmdSET([]string{"full", "\xff\xff\xff"})
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ones", "0"}, ":12\r\n"},
+		{[]string{"zeros", "1", "0"}, ":8\r\n"},
+		{[]string{"zeros", "1", "2"}, ":16\r\n"},
+		{[]string{"zeros", "1", "2", "-1", "BYTE"}, ":16\r\n"},
+		{[]string{"zeros", "1", "7", "15", "BIT"}, ":8\r\n"},
+		{[]string{"zeros", "0", "-1"}, ":20\r\n"},
+		// Without an end a full string is followed by clear bits.
+		{[]string{"full", "0"}, ":24\r\n"},
+		{[]string{"full", "0", "1"}, ":24\r\n"},
+		{[]string{"full", "0", "0", "-1"}, ":-1\r\n"},
+		{[]string{"full", "1", "5", "1"}, ":-1\r\n"},
+		{[]string{"missing", "0"}, ":0\r\n"},
+		{[]string{"missing", "1"}, ":-1\r\n"},
+		{[]string{"full", "2"}, "-(error) ERR The bit argument must be 1 or 0.\r\n"},
+		{[]string{"full", "1", "0", "1", "BIT", "x"}, "-(error) ERR syntax error\r\n"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, string(s.cmdBITPOS(tc.args)), tc.args)
+	}
+}
+
+func TestCmdBITOP(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"a", "foobar"})
+	s.cmdSET([]string{"b", "abcdef"})
+	s.cmdSET([]string{"short", "\xff"})
+
+	assert.Equal(t, ":6\r\n", string(s.cmdBITOP([]string{"AND", "dest", "a", "b"})))
+	assert.Equal(t, "$6\r\n`bc`ab\r\n", string(s.cmdGET([]string{"dest"})))
+	s.cmdBITOP([]string{"OR", "dest", "a", "b"})
+	assert.Equal(t, "$6\r\ngoofev\r\n", string(s.cmdGET([]string{"dest"})))
+	s.cmdBITOP([]string{"XOR", "dest", "a", "a"})
+	assert.Equal(t, "$6\r\n\x00\x00\x00\x00\x00\x00\r\n", string(s.cmdGET([]string{"dest"})))
+	s.cmdBITOP([]string{"NOT", "dest", "short"})
+	assert.Equal(t, "$1\r\n\x00\r\n", string(s.cmdGET([]string{"dest"})))
+
+	// Shorter and missing sources are padded with zero bytes.
+	assert.Equal(t, ":6\r\n", string(s.cmdBITOP([]string{"or", "dest", "short", "missing", "a"})))
+	assert.Equal(t, "$6\r\n\xffoobar\r\n", string(s.cmdGET([]string{"dest"})))
+	s.cmdBITOP([]string{"AND", "dest", "short", "a"})
+	assert.Equal(t, "$6\r\nf\x00\x00\x00\x00\x00\r\n", string(s.cmdGET([]string{"dest"})))
+
+	// An empty result deletes the destination.
+	s.cmdEXPIRE([]string{"dest", "100"})
+	assert.Equal(t, ":0\r\n", string(s.cmdBITOP([]string{"AND", "dest", "missing"})))
+	assert.False(t, s.keyExists("dest"))
+
+	assert.Equal(t, "-(error) ERR BITOP NOT must be called with a single source key.\r\n", string(s.cmdBITOP([]string{"NOT", "dest", "a", "b"})))
+	assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdBITOP([]string{"NAND", "dest", "a"})))
+	s.cmdSADD([]string{"set", "x"})
+	assert.Equal(t, wrongType, string(s.cmdBITOP([]string{"AND", "dest", "a", "set"})))
+}
+
+func TestCmdBITFIELD(t *testing.T) {
+	s := setupStorage()
+	res := s.cmdBITFIELD([]string{"k", "INCRBY", "i5", "100", "1", "GET", "u4", "0"})
+	assert.Equal(t, string(Encode([]interface{}{int64(1), int64(0)}, false)), string(res))
+
+	// OVERFLOW applies to the operations after it.
+	want := [][]interface{}{
+		{int64(1), int64(1)},
+		{int64(2), int64(2)},
+		{int64(3), int64(3)},
+		{int64(0), int64(3)},
+	}
+	for _, w := range want {
+		res = s.cmdBITFIELD([]string{"k", "incrby", "u2", "100", "1", "OVERFLOW", "SAT", "incrby", "u2", "102", "1"})
+		assert.Equal(t, string(Encode(w, false)), string(res))
+	}
+	res = s.cmdBITFIELD([]string{"k", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1", "GET", "u2", "102"})
+	assert.Equal(t, string(Encode([]interface{}{nil, int64(3)}, false)), string(res))
+
+	// SET replies with the old value; #N offsets count fields.
+	res = s.cmdBITFIELD([]string{"f", "SET", "i8", "#1", "-100", "SET", "i8", "#1", "50", "GET", "i8", "8", "GET", "u8", "#0"})
+	assert.Equal(t, string(Encode([]interface{}{int64(0), int64(-100), int64(50), int64(0)}, false)), string(res))
+	assert.Equal(t, ":2\r\n", string(s.cmdSTRLEN([]string{"f"})))
+
+	// Reading only doesn't create the key.
+	s.cmdBITFIELD([]string{"none", "GET", "u8", "0"})
+	assert.False(t, s.keyExists("none"))
+
+	s.cmdBITFIELD([]string{"full", "SET", "i64", "0", "9223372036854775807"})
+	res = s.cmdBITFIELD([]string{"full", "GET", "i64", "0", "INCRBY", "i64", "0", "1", "OVERFLOW", "SAT", "INCRBY", "i64", "0", "-10"})
+	assert.Equal(t, string(Encode([]interface{}{int64(9223372036854775807), int64(-9223372036854775808), int64(-9223372036854775808)}, false)), string(res))
+
+	for _, args := range [][]string{
+		{"k", "GET", "u64", "0"},
+		{"k", "GET", "i65", "0"},
+		{"k", "GET", "x8", "0"},
+		{"k", "GET", "i0", "0"},
+	} {
+		assert.Equal(t, "-(error) ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n", string(s.cmdBITFIELD(args)), args)
+	}
+	assert.Equal(t, "-(error) ERR bit offset is not an integer or out of range\r\n", string(s.cmdBITFIELD([]string{"k", "GET", "u8", "-1"})))
+	assert.Equal(t, "-(error) ERR bit offset is not an integer or out of range\r\n", string(s.cmdBITFIELD([]string{"k", "GET", "u8", "4294967290"})))
+	assert.Equal(t, "-(error) ERR Invalid OVERFLOW type specified\r\n", string(s.cmdBITFIELD([]string{"k", "OVERFLOW", "LOOP"})))
+	assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdBITFIELD([]string{"k", "SET", "u8", "0"})))
+	assert.Equal(t, "-(error) ERR value is not an integer or out of range\r\n", string(s.cmdBITFIELD([]string{"k", "SET", "u8", "0", "x"})))
+}
+
+func TestBitfieldOverflow(t *testing.T) {
+	testCases := []struct {
+		typ, overflow string
+		value, incr   int64
+		want          int64
+		ok            bool
+	}{
+		{"u8", "WRAP", 250, 10, 4, true},
+		{"u8", "SAT", 250, 10, 255, true},
+		{"u8", "FAIL", 250, 10, 0, false},
+		{"u8", "WRAP", 5, -10, 251, true},
+		{"u8", "SAT", 5, -10, 0, true},
+		{"u8", "SAT", -1, 0, 255, true},
+		{"u8", "WRAP", -1, 0, 255, true},
+		{"u63", "SAT", 1, -9223372036854775808, 0, true},
+		{"i8", "WRAP", 127, 1, -128, true},
+		{"i8", "SAT", 127, 1, 127, true},
+		{"i8", "SAT", -128, -1, -128, true},
+		{"i8", "WRAP", -128, -1, 127, true},
+		{"i8", "FAIL", 200, 0, 0, false},
+		{"i8", "WRAP", 200, 0, -56, true},
+		{"i64", "WRAP", 9223372036854775807, 1, -9223372036854775808, true},
+		{"i64", "SAT", -9223372036854775808, -9223372036854775808, -9223372036854775808, true},
+		{"i64", "WRAP", 5, -3, 2, true},
+	}
+	for _, tc := range testCases {
+		op := bitfieldOp{overflow: tc.overflow}
+		var err error
+		op.signed, op.width, err = parseBitfieldType(tc.typ)
+		assert.NoError(t, err)
+		got, ok := op.fit(tc.value, tc.incr)
+		assert.Equal(t, tc.ok, ok, tc)
+		if ok {
+			assert.Equal(t, tc.want, got, tc)
+		}
+	}
+}
+
+func TestDispatcher_BITOPAcrossShards(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	d.Execute(&Command{Cmd: "SET", Args: []string{"a", "foobar"}})
+	d.Execute(&Command{Cmd: "SET", Args: []string{"b", "abcdef"}})
+	assert.NotSame(t, d.shardOf("a"), d.shardOf("b"))
+
+	assert.Equal(t, ":6\r\n", string(d.Execute(&Command{Cmd: "BITOP", Args: []string{"AND", "dest:1", "a", "b"}})))
+	assert.Equal(t, "$6\r\n`bc`ab\r\n", string(d.Execute(&Command{Cmd: "GET", Args: []string{"dest:1"}})))
+	assert.Equal(t, ":0\r\n", string(d.Execute(&Command{Cmd: "BITOP", Args: []string{"OR", "dest:1", "missing", "other"}})))
+	assert.Equal(t, ":0\r\n", string(d.Execute(&Command{Cmd: "EXISTS", Args: []string{"dest:1"}})))
+}
@@ -8,7 +8,7 @@ import (
 	"strconv"
 )
 
-func cmdBFRESERVE(args []string) []byte {
+func (s *Storage) cmdBFRESERVE(args []string) []byte {
 	if !(len(args) == 3 || len(args) == 5) {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'BF.RESERVE' command"), false)
 	}
@@ -21,41 +21,52 @@ func cmdBFRESERVE(args []string) []byte {
 	if err != nil {
 		return Encode(errors.New(fmt.Sprintf("capacity must be an integer number %s", args[2])), false)
 	}
-	_, exist := bloomStore[key]
-	if exist {
+	bloom, err := s.lookupBloom(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if bloom != nil {
 		return Encode(errors.New(fmt.Sprintf("Bloom filter with key '%s' already exist", key)), false)
 	}
-	bloomStore[key] = data_structure.CreateBloomFilter(capacity, errRate)
+	s.setValue(key, data_structure.CreateBloomFilter(capacity, errRate))
+	s.dirty.Add(1)
 	return constant.RespOk
 }
 
-func cmdBFMADD(args []string) []byte {
+func (s *Storage) cmdBFMADD(args []string) []byte {
 	if len(args) < 2 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'BF.MADD' command"), false)
 	}
 	key := args[0]
-	bloom, exist := bloomStore[key]
-	if !exist {
+	bloom, err := s.lookupBloom(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if bloom == nil {
 		bloom = data_structure.CreateBloomFilter(constant.BfDefaultInitCapacity,
 			constant.BfDefaultErrRate)
-		bloomStore[key] = bloom
+		s.setValue(key, bloom)
 	}
 	var res []string
 	for i := 1; i < len(args); i++ {
 		item := args[i]
 		bloom.Add(item)
+		s.dirty.Add(1)
 		res = append(res, "1")
 	}
 	return Encode(res, false)
 }
 
-func cmdBFEXISTS(args []string) []byte {
+func (s *Storage) cmdBFEXISTS(args []string) []byte {
 	if len(args) != 2 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'BF.EXISTS' command"), false)
 	}
 	key, item := args[0], args[1]
-	bloom, exist := bloomStore[key]
-	if !exist {
+	bloom, err := s.lookupBloom(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if bloom == nil {
 		return constant.RespZero
 	}
 	if !bloom.Exist(item) {
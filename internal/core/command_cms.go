@@ -9,7 +9,7 @@ import (
 	"strconv"
 )
 
-func cmdCMSINITBYDIM(args []string) []byte {
+func (s *Storage) cmdCMSINITBYDIM(args []string) []byte {
 	if len(args) != 3 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.INITBYDIM' command"), false)
 	}
@@ -22,15 +22,19 @@ func cmdCMSINITBYDIM(args []string) []byte {
 	if err != nil {
 		return Encode(errors.New(fmt.Sprintf("height must be a integer number %s", args[1])), false)
 	}
-	_, exist := cmsStore[key]
-	if exist {
+	cms, err := s.lookupCMS(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if cms != nil {
 		return Encode(errors.New("CMS: key already exists"), false)
 	}
-	cmsStore[key] = data_structure.CreateCMS(uint32(width), uint32(height))
+	s.setValue(key, data_structure.CreateCMS(uint32(width), uint32(height)))
+	s.dirty.Add(1)
 	return constant.RespOk
 }
 
-func cmdCMSINITBYPROB(args []string) []byte {
+func (s *Storage) cmdCMSINITBYPROB(args []string) []byte {
 	if len(args) != 3 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.INITBYPROB' command"), false)
 	}
@@ -49,22 +53,29 @@ func cmdCMSINITBYPROB(args []string) []byte {
 	if probability >= 1 || probability <= 0 {
 		return Encode(errors.New("CMS: invalid prob value"), false)
 	}
-	_, exist := cmsStore[key]
-	if exist {
+	cms, err := s.lookupCMS(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if cms != nil {
 		return Encode(errors.New("CMS: key already exists"), false)
 	}
 	w, h := data_structure.CalcCMSDim(errRate, probability)
-	cmsStore[key] = data_structure.CreateCMS(w, h)
+	s.setValue(key, data_structure.CreateCMS(w, h))
+	s.dirty.Add(1)
 	return constant.RespOk
 }
 
-func cmdCMSINCRBY(args []string) []byte {
+func (s *Storage) cmdCMSINCRBY(args []string) []byte {
 	if len(args) < 3 || len(args)%2 == 0 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.INCBY' command"), false)
 	}
 	key := args[0]
-	cms, exist := cmsStore[key]
-	if !exist {
+	cms, err := s.lookupCMS(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if cms == nil {
 		return Encode(errors.New("CMS: key does not exist"), false)
 	}
 	var res []string
@@ -75,6 +86,7 @@ func cmdCMSINCRBY(args []string) []byte {
 			return Encode(errors.New(fmt.Sprintf("increment must be a non negative integer number %s", args[1])), false)
 		}
 		count := cms.IncrBy(item, uint32(value))
+		s.dirty.Add(1)
 		if count == math.MaxUint32 {
 			res = append(res, "CMS: INCRBY overflow")
 			continue
@@ -84,13 +96,16 @@ func cmdCMSINCRBY(args []string) []byte {
 	return Encode(res, false)
 }
 
-func cmdCMSQUERY(args []string) []byte {
+func (s *Storage) cmdCMSQUERY(args []string) []byte {
 	if len(args) < 2 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.QUERY' command"), false)
 	}
 	key := args[0]
-	cms, exist := cmsStore[key]
-	if !exist {
+	cms, err := s.lookupCMS(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if cms == nil {
 		return Encode(errors.New("CMS: key does not exist"), false)
 	}
 	var res []string
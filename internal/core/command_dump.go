@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"strconv"
+	"strings"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+)
+
+// A DUMP payload is a single snapshot value: the type byte and the value as
+// written to the snapshot file, followed by the format version and a CRC64
+// of everything before it.
+func (s *Storage) dumpPayload(key string) ([]byte, bool, error) {
+	obj := s.dictStore.Get(key)
+	if obj == nil {
+		return nil, false, nil
+	}
+	var buf bytes.Buffer
+	w := &rdbWriter{buf: &buf}
+	if err := w.writeValue(nil, obj); err != nil {
+		return nil, true, err
+	}
+	buf.WriteString(rdbVersion)
+	w.writeUint64(crc64.Checksum(buf.Bytes(), rdbCrcTable))
+	return buf.Bytes(), true, nil
+}
+
+func (s *Storage) restorePayload(key string, payload []byte) error {
+	footer := len(rdbVersion) + 8
+	if len(payload) < 1+footer {
+		return errRdbFormat
+	}
+	body := payload[:len(payload)-8]
+	if crc64.Checksum(body, rdbCrcTable) != binary.LittleEndian.Uint64(payload[len(payload)-8:]) {
+		return errRdbChecksum
+	}
+	if string(body[len(body)-len(rdbVersion):]) != rdbVersion {
+		return errRdbFormat
+	}
+	r := &rdbReader{r: bytes.NewReader(body[1 : len(body)-len(rdbVersion)])}
+	value, err := decodeRdbValue(r, body[0], key)
+	if err != nil {
+		return err
+	}
+	if r.r.Len() != 0 {
+		return errRdbFormat
+	}
+	s.setValue(key, value)
+	return nil
+}
+
+func (s *Storage) cmdDUMP(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'DUMP' command"), false)
+	}
+	payload, found, err := s.dumpPayload(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if !found {
+		return constant.RespNil
+	}
+	return Encode(string(payload), false)
+}
+
+// cmdRESTORE creates a key from a DUMP payload:
+// RESTORE key ttl payload [REPLACE] [ABSTTL]. A ttl of 0 means no expiry.
+func (s *Storage) cmdRESTORE(args []string) []byte {
+	if len(args) < 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'RESTORE' command"), false)
+	}
+	key, payload := args[0], args[2]
+	ttlMs, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || ttlMs < 0 {
+		return Encode(errors.New("(error) ERR Invalid TTL value, must be >= 0"), false)
+	}
+	var replace, absTTL bool
+	for _, opt := range args[3:] {
+		switch strings.ToUpper(opt) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		default:
+			return Encode(errors.New("(error) ERR syntax error"), false)
+		}
+	}
+
+	if s.keyExists(key) {
+		if !replace {
+			return Encode(errors.New("BUSYKEY Target key name already exists."), false)
+		}
+		s.dictStore.Del(key)
+	}
+	if err = s.restorePayload(key, []byte(payload)); err != nil {
+		return Encode(errors.New("ERR DUMP payload version or checksum are wrong"), false)
+	}
+	if ttlMs > 0 {
+		if absTTL {
+			s.dictStore.SetExpiryAt(key, uint64(ttlMs))
+		} else {
+			s.dictStore.SetExpiry(key, ttlMs)
+		}
+		if s.dictStore.HasExpired(key) {
+			s.dictStore.Del(key)
+		}
+	}
+	s.dirty.Add(1)
+	return constant.RespOk
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+)
+
+// expireFlags are the NX | XX | GT | LT options of the EXPIRE family.
+type expireFlags struct {
+	nx, xx, gt, lt bool
+}
+
+func parseExpireFlags(args []string) (expireFlags, error) {
+	var f expireFlags
+	for _, arg := range args {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			f.nx = true
+		case "XX":
+			f.xx = true
+		case "GT":
+			f.gt = true
+		case "LT":
+			f.lt = true
+		default:
+			return f, fmt.Errorf("(error) ERR Unsupported option %s", arg)
+		}
+	}
+	if f.nx && (f.xx || f.gt || f.lt) {
+		return f, errors.New("(error) ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if f.gt && f.lt {
+		return f, errors.New("(error) ERR GT and LT options at the same time are not compatible")
+	}
+	return f, nil
+}
+
+// allow reports whether a key whose expiry is exp (hasExp false when it has
+// none) may get the new expiry at. No expiry counts as an infinite TTL.
+func (f expireFlags) allow(exp uint64, hasExp bool, at int64) bool {
+	switch {
+	case f.nx:
+		return !hasExp
+	case f.xx && !hasExp:
+		return false
+	case f.gt:
+		return hasExp && at > int64(exp)
+	case f.lt:
+		return !hasExp || at < int64(exp)
+	}
+	return true
+}
+
+// deadlineMs converts the time argument of the EXPIRE family, n units relative
+// to now unless absolute, to unix ms, rejecting values that would overflow.
+func deadlineMs(name string, n int64, unit time.Duration, absolute bool) (int64, error) {
+	errInvalid := fmt.Errorf("(error) ERR invalid expire time in '%s' command", strings.ToLower(name))
+	perMs := int64(unit / time.Millisecond)
+	if n > math.MaxInt64/perMs || n < math.MinInt64/perMs {
+		return 0, errInvalid
+	}
+	at := n * perMs
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if at > math.MaxInt64-now {
+			return 0, errInvalid
+		}
+		at += now
+	}
+	return at, nil
+}
+
+// expireGeneric implements EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT:
+// key time [NX | XX | GT | LT], where time is in unit and relative to now
+// unless absolute. A time already in the past deletes the key.
+func (s *Storage) expireGeneric(name string, args []string, unit time.Duration, absolute bool) []byte {
+	if len(args) < 2 {
+		return Encode(fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name), false)
+	}
+
+	key := args[0]
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	flags, err := parseExpireFlags(args[2:])
+	if err != nil {
+		return Encode(err, false)
+	}
+
+	at, err := deadlineMs(name, n, unit, absolute)
+	if err != nil {
+		return Encode(err, false)
+	}
+
+	if !s.keyExists(key) {
+		return constant.RespZero
+	}
+	exp, hasExp := s.dictStore.GetExpiry(key)
+	if !flags.allow(exp, hasExp, at) {
+		return constant.RespZero
+	}
+	s.dirty.Add(1)
+	if at <= time.Now().UnixMilli() {
+		s.dictStore.Del(key)
+		return constant.RespOne
+	}
+	s.dictStore.SetExpiryAt(key, uint64(at))
+	return constant.RespOne
+}
+
+func (s *Storage) cmdEXPIRE(args []string) []byte {
+	return s.expireGeneric("EXPIRE", args, time.Second, false)
+}
+
+func (s *Storage) cmdPEXPIRE(args []string) []byte {
+	return s.expireGeneric("PEXPIRE", args, time.Millisecond, false)
+}
+
+func (s *Storage) cmdEXPIREAT(args []string) []byte {
+	return s.expireGeneric("EXPIREAT", args, time.Second, true)
+}
+
+func (s *Storage) cmdPEXPIREAT(args []string) []byte {
+	return s.expireGeneric("PEXPIREAT", args, time.Millisecond, true)
+}
+
+// remainingMs is the TTL of key in milliseconds, or the -2 (missing) / -1
+// (no expiry) reply shared by the TTL family.
+func (s *Storage) remainingMs(key string) (int64, []byte) {
+	if !s.keyExists(key) {
+		return 0, constant.TtlKeyNotExist
+	}
+	exp, isExpirySet := s.dictStore.GetExpiry(key)
+	if !isExpirySet {
+		return 0, constant.TtlKeyExistNoExpire
+	}
+	return max(int64(exp)-time.Now().UnixMilli(), 0), nil
+}
+
+func (s *Storage) cmdTTL(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'TTL' command"), false)
+	}
+	remainMs, res := s.remainingMs(args[0])
+	if res != nil {
+		return res
+	}
+	// Round to the nearest second, as Redis does.
+	return Encode((remainMs+500)/1000, false)
+}
+
+func (s *Storage) cmdPTTL(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'PTTL' command"), false)
+	}
+	remainMs, res := s.remainingMs(args[0])
+	if res != nil {
+		return res
+	}
+	return Encode(remainMs, false)
+}
+
+func (s *Storage) expireTimeGeneric(name string, args []string, unit time.Duration) []byte {
+	if len(args) != 1 {
+		return Encode(fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name), false)
+	}
+	key := args[0]
+	if !s.keyExists(key) {
+		return constant.TtlKeyNotExist
+	}
+	exp, isExpirySet := s.dictStore.GetExpiry(key)
+	if !isExpirySet {
+		return constant.TtlKeyExistNoExpire
+	}
+	return Encode(int64(exp)/int64(unit/time.Millisecond), false)
+}
+
+func (s *Storage) cmdEXPIRETIME(args []string) []byte {
+	return s.expireTimeGeneric("EXPIRETIME", args, time.Second)
+}
+
+func (s *Storage) cmdPEXPIRETIME(args []string) []byte {
+	return s.expireTimeGeneric("PEXPIRETIME", args, time.Millisecond)
+}
+
+func (s *Storage) cmdPERSIST(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'PERSIST' command"), false)
+	}
+	key := args[0]
+	if !s.keyExists(key) || !s.dictStore.DelExpiry(key) {
+		return constant.RespZero
+	}
+	s.dirty.Add(1)
+	return constant.RespOne
+}
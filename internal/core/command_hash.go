@@ -0,0 +1,505 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+// hashForWrite returns the hash at key, creating an empty one if the key is
+// missing.
+func (s *Storage) hashForWrite(key string) (*data_structure.Hash, error) {
+	hash, err := s.lookupHash(key)
+	if err != nil || hash != nil {
+		return hash, err
+	}
+	hash = data_structure.NewHash()
+	s.setValue(key, hash)
+	return hash, nil
+}
+
+// hashGet is hash.Get that also takes the nil hash of a missing key.
+func hashGet(hash *data_structure.Hash, field string) (string, bool) {
+	if hash == nil {
+		return "", false
+	}
+	return hash.Get(field)
+}
+
+// cmdHSET is HSET key field value [field value ...]. It replies with the
+// number of fields that were added rather than updated.
+func (s *Storage) cmdHSET(args []string) []byte {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HSET' command"), false)
+	}
+	hash, err := s.hashForWrite(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if hash.Set(args[i], args[i+1]) {
+			added++
+		}
+	}
+	s.dirty.Add(int64(len(args) / 2))
+	return Encode(added, false)
+}
+
+func (s *Storage) cmdHSETNX(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HSETNX' command"), false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if _, exists := hashGet(hash, args[1]); exists {
+		return constant.RespZero
+	}
+	hash, _ = s.hashForWrite(args[0])
+	hash.Set(args[1], args[2])
+	s.dirty.Add(1)
+	return Encode(1, false)
+}
+
+func (s *Storage) cmdHGET(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HGET' command"), false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	value, ok := hashGet(hash, args[1])
+	if !ok {
+		return constant.RespNil
+	}
+	return Encode(value, false)
+}
+
+// cmdHMGET replies with the value of each field, nil for missing ones.
+func (s *Storage) cmdHMGET(args []string) []byte {
+	if len(args) < 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HMGET' command"), false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	values := make([]interface{}, len(args)-1)
+	for i, field := range args[1:] {
+		if value, ok := hashGet(hash, field); ok {
+			values[i] = value
+		}
+	}
+	return Encode(values, false)
+}
+
+func (s *Storage) cmdHDEL(args []string) []byte {
+	if len(args) < 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HDEL' command"), false)
+	}
+	key := args[0]
+	hash, err := s.lookupHash(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if hash == nil {
+		return constant.RespZero
+	}
+	deleted := 0
+	for _, field := range args[1:] {
+		if hash.Del(field) {
+			deleted++
+		}
+	}
+	// A hash without fields doesn't exist.
+	if hash.Len() == 0 {
+		s.dictStore.Del(key)
+	}
+	s.dirty.Add(int64(deleted))
+	return Encode(deleted, false)
+}
+
+func (s *Storage) cmdHLEN(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HLEN' command"), false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if hash == nil {
+		return constant.RespZero
+	}
+	return Encode(hash.Len(), false)
+}
+
+func (s *Storage) cmdHEXISTS(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HEXISTS' command"), false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if _, ok := hashGet(hash, args[1]); !ok {
+		return constant.RespZero
+	}
+	return Encode(1, false)
+}
+
+// hashPairs returns the fields and values of the hash at key, every other
+// element being a field. A missing key has none.
+func (s *Storage) hashPairs(name string, args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil || hash == nil {
+		return []string{}, err
+	}
+	return hash.Pairs(), nil
+}
+
+func (s *Storage) cmdHGETALL(args []string) []byte {
+	pairs, err := s.hashPairs("HGETALL", args)
+	if err != nil {
+		return Encode(err, false)
+	}
+	return Encode(pairs, false)
+}
+
+func (s *Storage) cmdHKEYS(args []string) []byte {
+	pairs, err := s.hashPairs("HKEYS", args)
+	if err != nil {
+		return Encode(err, false)
+	}
+	fields := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		fields = append(fields, pairs[i])
+	}
+	return Encode(fields, false)
+}
+
+func (s *Storage) cmdHVALS(args []string) []byte {
+	pairs, err := s.hashPairs("HVALS", args)
+	if err != nil {
+		return Encode(err, false)
+	}
+	values := make([]string, 0, len(pairs)/2)
+	for i := 1; i < len(pairs); i += 2 {
+		values = append(values, pairs[i])
+	}
+	return Encode(values, false)
+}
+
+func (s *Storage) cmdHINCRBY(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HINCRBY' command"), false)
+	}
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	var n int64
+	if value, ok := hashGet(hash, args[1]); ok {
+		if n, ok = parseCanonicalInt(value); !ok {
+			return Encode(errors.New("(error) ERR hash value is not an integer"), false)
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return Encode(errOverflow, false)
+	}
+	n += delta
+	hash, _ = s.hashForWrite(args[0])
+	hash.Update(args[1], strconv.FormatInt(n, 10))
+	s.dirty.Add(1)
+	return Encode(n, false)
+}
+
+func (s *Storage) cmdHINCRBYFLOAT(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HINCRBYFLOAT' command"), false)
+	}
+	incr, ok := parseFloat(args[2])
+	if !ok {
+		return Encode(errNotFloat, false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	var current float64
+	if value, found := hashGet(hash, args[1]); found {
+		if current, ok = parseFloat(value); !ok {
+			return Encode(errors.New("(error) ERR hash value is not a float"), false)
+		}
+	}
+	result := current + incr
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return Encode(errors.New("(error) ERR increment would produce NaN or Infinity"), false)
+	}
+	res := formatFloat(result)
+	hash, _ = s.hashForWrite(args[0])
+	hash.Update(args[1], res)
+	s.dirty.Add(1)
+	return Encode(res, false)
+}
+
+// cmdHSCAN is HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]. The
+// reply is the next cursor, 0 once the scan is complete, and the fields and
+// values visited. MATCH filters after visiting, so a call may return fewer
+// than COUNT fields, even none, before the scan is over.
+func (s *Storage) cmdHSCAN(args []string) []byte {
+	if len(args) < 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HSCAN' command"), false)
+	}
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return Encode(errors.New("(error) ERR invalid cursor"), false)
+	}
+	pattern, count, noValues := "*", 10, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			if i+1 == len(args) {
+				return Encode(errSyntax, false)
+			}
+			i++
+			pattern = args[i]
+		case "COUNT":
+			if i+1 == len(args) {
+				return Encode(errSyntax, false)
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil {
+				return Encode(errNotInteger, false)
+			}
+			if n < 1 {
+				return Encode(errSyntax, false)
+			}
+			count = n
+		case "NOVALUES":
+			noValues = true
+		default:
+			return Encode(errSyntax, false)
+		}
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if hash == nil {
+		return Encode([]interface{}{"0", []string{}}, false)
+	}
+
+	next, pairs := hash.Scan(cursor, count)
+	items := make([]string, 0, len(pairs))
+	for i := 0; i < len(pairs); i += 2 {
+		if pattern != "*" && !globMatch(pattern, pairs[i]) {
+			continue
+		}
+		items = append(items, pairs[i])
+		if !noValues {
+			items = append(items, pairs[i+1])
+		}
+	}
+	return Encode([]interface{}{strconv.FormatUint(next, 10), items}, false)
+}
+
+// parseHashFields parses the FIELDS numfields field [field ...] that ends the
+// arguments of the field TTL commands.
+func parseHashFields(args []string) ([]string, error) {
+	if len(args) < 2 || !strings.EqualFold(args[0], "FIELDS") {
+		return nil, errors.New("(error) ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return nil, errors.New("(error) ERR Parameter `numFields` should be greater than 0")
+	}
+	if n != len(args)-2 {
+		return nil, errors.New("(error) ERR The `numfields` parameter must match the number of arguments")
+	}
+	return args[2:], nil
+}
+
+// Replies of the field TTL commands, one per field.
+const (
+	fieldMissing   int64 = -2
+	fieldNoTTL     int64 = -1
+	fieldNotSet    int64 = 0
+	fieldSet       int64 = 1
+	fieldDeleted   int64 = 2
+	fieldPersisted int64 = 1
+)
+
+// hexpireGeneric implements HEXPIRE, HPEXPIRE, HEXPIREAT and HPEXPIREAT:
+// key time [NX | XX | GT | LT] FIELDS numfields field [field ...]. It replies
+// for each field with -2 when it doesn't exist, 0 when the flag prevented the
+// change, 1 when the TTL was set and 2 when the time was already past and the
+// field was deleted.
+func (s *Storage) hexpireGeneric(name string, args []string, unit time.Duration, absolute bool) []byte {
+	if len(args) < 4 {
+		return Encode(fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name), false)
+	}
+	key := args[0]
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	at, err := deadlineMs(name, n, unit, absolute)
+	if err != nil {
+		return Encode(err, false)
+	}
+	rest := args[2:]
+	var flags expireFlags
+	if !strings.EqualFold(rest[0], "FIELDS") {
+		if flags, err = parseExpireFlags(rest[:1]); err != nil {
+			return Encode(err, false)
+		}
+		rest = rest[1:]
+	}
+	fields, err := parseHashFields(rest)
+	if err != nil {
+		return Encode(err, false)
+	}
+
+	hash, err := s.lookupHash(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	replies := make([]interface{}, len(fields))
+	past := at <= time.Now().UnixMilli()
+	changed := 0
+	for i, field := range fields {
+		if _, ok := hashGet(hash, field); !ok {
+			replies[i] = fieldMissing
+			continue
+		}
+		exp, hasExp := hash.Expiry(field)
+		switch {
+		case !flags.allow(exp, hasExp, at):
+			replies[i] = fieldNotSet
+		case past:
+			hash.Del(field)
+			replies[i] = fieldDeleted
+			changed++
+		default:
+			hash.SetExpiry(field, uint64(at))
+			replies[i] = fieldSet
+			changed++
+		}
+	}
+	if hash != nil {
+		if hash.Len() == 0 {
+			s.dictStore.Del(key)
+		} else if hash.HasExpiries() {
+			s.hashFieldExpiries[key] = struct{}{}
+		}
+	}
+	s.dirty.Add(int64(changed))
+	return Encode(replies, false)
+}
+
+func (s *Storage) cmdHEXPIRE(args []string) []byte {
+	return s.hexpireGeneric("HEXPIRE", args, time.Second, false)
+}
+
+func (s *Storage) cmdHPEXPIRE(args []string) []byte {
+	return s.hexpireGeneric("HPEXPIRE", args, time.Millisecond, false)
+}
+
+func (s *Storage) cmdHEXPIREAT(args []string) []byte {
+	return s.hexpireGeneric("HEXPIREAT", args, time.Second, true)
+}
+
+func (s *Storage) cmdHPEXPIREAT(args []string) []byte {
+	return s.hexpireGeneric("HPEXPIREAT", args, time.Millisecond, true)
+}
+
+// httlGeneric implements HTTL and HPTTL: key FIELDS numfields field
+// [field ...]. It replies for each field with its TTL in unit, -2 when it
+// doesn't exist and -1 when it has no TTL.
+func (s *Storage) httlGeneric(name string, args []string, unit time.Duration) []byte {
+	if len(args) < 3 {
+		return Encode(fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name), false)
+	}
+	fields, err := parseHashFields(args[1:])
+	if err != nil {
+		return Encode(err, false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	now := time.Now().UnixMilli()
+	perMs := int64(unit / time.Millisecond)
+	replies := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if _, ok := hashGet(hash, field); !ok {
+			replies[i] = fieldMissing
+			continue
+		}
+		exp, ok := hash.Expiry(field)
+		if !ok {
+			replies[i] = fieldNoTTL
+			continue
+		}
+		// Round to the nearest unit, as TTL does.
+		replies[i] = (max(int64(exp)-now, 0) + perMs/2) / perMs
+	}
+	return Encode(replies, false)
+}
+
+func (s *Storage) cmdHTTL(args []string) []byte {
+	return s.httlGeneric("HTTL", args, time.Second)
+}
+
+func (s *Storage) cmdHPTTL(args []string) []byte {
+	return s.httlGeneric("HPTTL", args, time.Millisecond)
+}
+
+// cmdHPERSIST is HPERSIST key FIELDS numfields field [field ...]. It replies
+// for each field with 1 when its TTL was removed, -1 when it had none and -2
+// when it doesn't exist.
+func (s *Storage) cmdHPERSIST(args []string) []byte {
+	if len(args) < 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'HPERSIST' command"), false)
+	}
+	fields, err := parseHashFields(args[1:])
+	if err != nil {
+		return Encode(err, false)
+	}
+	hash, err := s.lookupHash(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	replies := make([]interface{}, len(fields))
+	persisted := 0
+	for i, field := range fields {
+		switch _, ok := hashGet(hash, field); {
+		case !ok:
+			replies[i] = fieldMissing
+		case hash.Persist(field):
+			replies[i] = fieldPersisted
+			persisted++
+		default:
+			replies[i] = fieldNoTTL
+		}
+	}
+	s.dirty.Add(int64(persisted))
+	return Encode(replies, false)
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+func decodeArray(t *testing.T, reply []byte) []interface{} {
+	t.Helper()
+	value, err := Decode(reply)
+	assert.NoError(t, err)
+	return value.([]interface{})
+}
+
+func TestCmdHSETAndHGET(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, ":2\r\n", string(s.cmdHSET([]string{"user", "name", "ada", "age", "36"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdHSET([]string{"user", "age", "37"})))
+	assert.Equal(t, "+hash\r\n", string(s.cmdTYPE([]string{"user"})))
+	assert.Equal(t, string(Encode("37", false)), string(s.cmdHGET([]string{"user", "age"})))
+	assert.Equal(t, "$-1\r\n", string(s.cmdHGET([]string{"user", "email"})))
+	assert.Equal(t, "$-1\r\n", string(s.cmdHGET([]string{"missing", "age"})))
+	assert.Equal(t, string(Encode([]interface{}{"ada", nil, "37"}, false)),
+		string(s.cmdHMGET([]string{"user", "name", "email", "age"})))
+	assert.Equal(t, "*1\r\n$-1\r\n", string(s.cmdHMGET([]string{"missing", "name"})))
+
+	assert.Equal(t, ":0\r\n", string(s.cmdHSETNX([]string{"user", "name", "bob"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdHSETNX([]string{"user", "email", "ada@example.com"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdHSETNX([]string{"other", "f", "v"})))
+	assert.Equal(t, ":3\r\n", string(s.cmdHLEN([]string{"user"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdHEXISTS([]string{"user", "email"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdHEXISTS([]string{"user", "phone"})))
+
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'HSET' command\r\n", string(s.cmdHSET([]string{"user", "name"})))
+	s.cmdSET([]string{"str", "v"})
+	assert.Equal(t, wrongType, string(s.cmdHSET([]string{"str", "f", "v"})))
+	assert.Equal(t, wrongType, string(s.cmdHGET([]string{"str", "f"})))
+	assert.Equal(t, wrongType, string(s.cmdHSETNX([]string{"str", "f", "v"})))
+}
+
+func TestCmdHDELAndHGETALL(t *testing.T) {
+	s := setupStorage()
+	s.cmdHSET([]string{"h", "a", "1", "b", "2", "c", "3"})
+	assert.ElementsMatch(t, []interface{}{"a", "1", "b", "2", "c", "3"}, decodeArray(t, s.cmdHGETALL([]string{"h"})))
+	assert.ElementsMatch(t, []interface{}{"a", "b", "c"}, decodeArray(t, s.cmdHKEYS([]string{"h"})))
+	assert.ElementsMatch(t, []interface{}{"1", "2", "3"}, decodeArray(t, s.cmdHVALS([]string{"h"})))
+
+	assert.Equal(t, ":2\r\n", string(s.cmdHDEL([]string{"h", "a", "b", "missing"})))
+	assert.Equal(t, string(Encode([]string{"c", "3"}, false)), string(s.cmdHGETALL([]string{"h"})))
+	// Deleting the last field deletes the key.
+	assert.Equal(t, ":1\r\n", string(s.cmdHDEL([]string{"h", "c"})))
+	assert.False(t, s.keyExists("h"))
+	assert.Equal(t, "*0\r\n", string(s.cmdHGETALL([]string{"h"})))
+	assert.Equal(t, "*0\r\n", string(s.cmdHKEYS([]string{"h"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdHDEL([]string{"h", "c"})))
+}
+
+func TestCmdHINCRBY(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, ":5\r\n", string(s.cmdHINCRBY([]string{"h", "n", "5"})))
+	assert.Equal(t, ":-2\r\n", string(s.cmdHINCRBY([]string{"h", "n", "-7"})))
+	assert.Equal(t, string(Encode("-2", false)), string(s.cmdHGET([]string{"h", "n"})))
+
+	s.cmdHSET([]string{"h", "max", "9223372036854775807", "word", "abc"})
+	assert.Equal(t, "-(error) ERR increment or decrement would overflow\r\n", string(s.cmdHINCRBY([]string{"h", "max", "1"})))
+	assert.Equal(t, "-(error) ERR hash value is not an integer\r\n", string(s.cmdHINCRBY([]string{"h", "word", "1"})))
+	assert.Equal(t, "-(error) ERR value is not an integer or out of range\r\n", string(s.cmdHINCRBY([]string{"h", "n", "x"})))
+
+	assert.Equal(t, string(Encode("2.5", false)), string(s.cmdHINCRBYFLOAT([]string{"h", "f", "2.5"})))
+	assert.Equal(t, string(Encode("3", false)), string(s.cmdHINCRBYFLOAT([]string{"h", "f", "0.5"})))
+	assert.Equal(t, string(Encode("-1.5", false)), string(s.cmdHINCRBYFLOAT([]string{"h", "n", "0.5"})))
+	assert.Equal(t, "-(error) ERR hash value is not a float\r\n", string(s.cmdHINCRBYFLOAT([]string{"h", "word", "1"})))
+	assert.Equal(t, "-(error) ERR value is not a valid float\r\n", string(s.cmdHINCRBYFLOAT([]string{"h", "f", "x"})))
+	// A failed increment doesn't leave an empty hash behind.
+	assert.Equal(t, "-(error) ERR increment would produce NaN or Infinity\r\n", string(s.cmdHINCRBYFLOAT([]string{"new", "f", "inf"})))
+	assert.False(t, s.keyExists("new"))
+}
+
+func TestCmdHSCAN(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, "*2\r\n$1\r\n0\r\n*0\r\n", string(s.cmdHSCAN([]string{"missing", "0"})))
+
+	s.cmdHSET([]string{"small", "name", "ada", "nick", "countess", "age", "36"})
+	assert.Equal(t, string(Encode([]interface{}{"0", []string{"name", "ada", "nick", "countess"}}, false)),
+		string(s.cmdHSCAN([]string{"small", "0", "MATCH", "n*"})))
+	assert.Equal(t, string(Encode([]interface{}{"0", []string{"name", "nick", "age"}}, false)),
+		string(s.cmdHSCAN([]string{"small", "0", "NOVALUES"})))
+
+	for i := 0; i < 500; i++ {
+		s.cmdHSET([]string{"big", "f" + strconv.Itoa(i), strconv.Itoa(i)})
+	}
+	seen := map[interface{}]int{}
+	for cursor := "0"; ; {
+		reply := decodeArray(t, s.cmdHSCAN([]string{"big", cursor, "COUNT", "20", "MATCH", "f1*", "NOVALUES"}))
+		for _, field := range reply[1].([]interface{}) {
+			seen[field]++
+		}
+		if cursor = reply[0].(string); cursor == "0" {
+			break
+		}
+	}
+	// f1, f10 to f19 and f100 to f199, each once.
+	assert.Len(t, seen, 111)
+	for field, n := range seen {
+		assert.Equal(t, 1, n, field)
+	}
+
+	assert.Equal(t, "-(error) ERR invalid cursor\r\n", string(s.cmdHSCAN([]string{"big", "-1"})))
+	assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdHSCAN([]string{"big", "0", "COUNT", "0"})))
+	assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdHSCAN([]string{"big", "0", "MATCH"})))
+	assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdHSCAN([]string{"big", "0", "SORTED"})))
+}
+
+func TestCmdHEXPIREAndHTTL(t *testing.T) {
+	s := setupStorage()
+	s.cmdHSET([]string{"user", "name", "ada", "token", "t1", "otp", "123"})
+
+	assert.Equal(t, string(Encode([]interface{}{int64(1), int64(-2)}, false)),
+		string(s.cmdHEXPIRE([]string{"user", "100", "FIELDS", "2", "token", "missing"})))
+	assert.Equal(t, string(Encode([]interface{}{int64(100), int64(-1), int64(-2)}, false)),
+		string(s.cmdHTTL([]string{"user", "FIELDS", "3", "token", "name", "missing"})))
+	reply := decodeArray(t, s.cmdHPTTL([]string{"user", "FIELDS", "1", "token"}))
+	assert.InDelta(t, 100000, reply[0], 1000)
+
+	// The flags work as for keys.
+	assert.Equal(t, "*2\r\n:0\r\n:1\r\n", string(s.cmdHPEXPIRE([]string{"user", "500", "NX", "FIELDS", "2", "token", "otp"})))
+	assert.Equal(t, "*1\r\n:0\r\n", string(s.cmdHEXPIRE([]string{"user", "1000", "LT", "FIELDS", "1", "token"})))
+	assert.Equal(t, "*1\r\n:1\r\n", string(s.cmdHEXPIRE([]string{"user", "1000", "GT", "FIELDS", "1", "token"})))
+	assert.Equal(t, "*1\r\n:0\r\n", string(s.cmdHEXPIRE([]string{"user", "10", "XX", "FIELDS", "1", "name"})))
+
+	assert.Equal(t, "*3\r\n:1\r\n:-1\r\n:-2\r\n", string(s.cmdHPERSIST([]string{"user", "FIELDS", "3", "token", "name", "missing"})))
+	assert.Equal(t, "*1\r\n:-1\r\n", string(s.cmdHTTL([]string{"user", "FIELDS", "1", "token"})))
+
+	// A time in the past deletes the field, and the last field the key.
+	assert.Equal(t, "*1\r\n:2\r\n", string(s.cmdHEXPIREAT([]string{"user", "1", "FIELDS", "1", "token"})))
+	assert.Equal(t, "*1\r\n:2\r\n", string(s.cmdHEXPIRE([]string{"user", "0", "FIELDS", "1", "name"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdHLEN([]string{"user"})))
+	assert.Equal(t, "*1\r\n:2\r\n", string(s.cmdHPEXPIREAT([]string{"user", "1", "FIELDS", "1", "otp"})))
+	assert.False(t, s.keyExists("user"))
+	assert.Equal(t, "*2\r\n:-2\r\n:-2\r\n", string(s.cmdHEXPIRE([]string{"user", "10", "FIELDS", "2", "a", "b"})))
+	assert.Equal(t, "*1\r\n:-2\r\n", string(s.cmdHTTL([]string{"user", "FIELDS", "1", "a"})))
+
+	// So does a negative TTL.
+	s.cmdHSET([]string{"session", "a", "1", "b", "2"})
+	assert.Equal(t, "*1\r\n:2\r\n", string(s.cmdHEXPIRE([]string{"session", "-1", "FIELDS", "1", "a"})))
+	assert.Equal(t, "*1\r\n:2\r\n", string(s.cmdHPEXPIRE([]string{"session", "-100", "FIELDS", "1", "b"})))
+	assert.False(t, s.keyExists("session"))
+
+	s.cmdHSET([]string{"h", "f", "v"})
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"h", "10", "NX", "1", "f"}, "-(error) ERR Mandatory argument FIELDS is missing or not at the right position\r\n"},
+		{[]string{"h", "10", "FIELDS", "0", "f"}, "-(error) ERR Parameter `numFields` should be greater than 0\r\n"},
+		{[]string{"h", "10", "FIELDS", "2", "f"}, "-(error) ERR The `numfields` parameter must match the number of arguments\r\n"},
+		{[]string{"h", "10", "SOON", "FIELDS", "1", "f"}, "-(error) ERR Unsupported option SOON\r\n"},
+		{[]string{"h", "soon", "FIELDS", "1", "f"}, "-(error) ERR value is not an integer or out of range\r\n"},
+		{[]string{"h", "9223372036854775807", "FIELDS", "1", "f"}, "-(error) ERR invalid expire time in 'hexpire' command\r\n"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, string(s.cmdHEXPIRE(tc.args)), tc.args)
+	}
+	s.cmdSET([]string{"str", "v"})
+	assert.Equal(t, wrongType, string(s.cmdHTTL([]string{"str", "FIELDS", "1", "f"})))
+}
+
+func TestHashFieldExpiry_lazy(t *testing.T) {
+	s := setupStorage()
+	s.cmdHSET([]string{"h", "token", "t", "name", "ada"})
+	s.cmdHEXPIRE([]string{"h", "100", "FIELDS", "1", "token"})
+	hash, _ := s.lookupHash("h")
+	hash.SetExpiry("token", uint64(time.Now().UnixMilli()-1))
+
+	assert.Equal(t, "$-1\r\n", string(s.cmdHGET([]string{"h", "token"})))
+	assert.Equal(t, string(Encode([]string{"name", "ada"}, false)), string(s.cmdHGETALL([]string{"h"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdHLEN([]string{"h"})))
+
+	// Overwriting a field clears its TTL, incrementing it doesn't.
+	s.cmdHSET([]string{"h", "n", "1"})
+	s.cmdHEXPIRE([]string{"h", "100", "FIELDS", "2", "name", "n"})
+	s.cmdHSET([]string{"h", "name", "bob"})
+	s.cmdHINCRBY([]string{"h", "n", "1"})
+	assert.Equal(t, "*2\r\n:-1\r\n:100\r\n", string(s.cmdHTTL([]string{"h", "FIELDS", "2", "name", "n"})))
+
+	// Once every field has expired the key is gone.
+	hash.SetExpiry("name", uint64(time.Now().UnixMilli()-1))
+	hash.SetExpiry("n", uint64(time.Now().UnixMilli()-1))
+	assert.Equal(t, "*1\r\n$-1\r\n", string(s.cmdHMGET([]string{"h", "name"})))
+	assert.False(t, s.keyExists("h"))
+}
+
+func TestHashFieldExpiry_active(t *testing.T) {
+	s := setupStorage()
+	past := uint64(time.Now().UnixMilli() - 1)
+	for i := 0; i < 100; i++ {
+		key := "session:" + strconv.Itoa(i)
+		s.cmdHSET([]string{key, "token", "t", "user", "u"})
+		s.cmdHEXPIRE([]string{key, "100", "FIELDS", "1", "token"})
+		hash, _ := lookupValue[*data_structure.Hash](s, key, data_structure.ObjTypeHash)
+		hash.SetExpiry("token", past)
+	}
+	// Only fields of the hashes that have some are sampled.
+	s.cmdHSET([]string{"plain", "f", "v"})
+	s.cmdHSET([]string{"gone", "f", "v"})
+	s.cmdHEXPIRE([]string{"gone", "100", "FIELDS", "1", "f"})
+	s.cmdDEL([]string{"gone"})
+	s.cmdHSET([]string{"all", "f", "v"})
+	s.cmdHEXPIRE([]string{"all", "100", "FIELDS", "1", "f"})
+	allHash, _ := lookupValue[*data_structure.Hash](s, "all", data_structure.ObjTypeHash)
+	allHash.SetExpiry("f", past)
+
+	s.ActiveDeleteExpiredKeys()
+	// The cycle stops once few sampled hashes have expired fields, so some
+	// may be left; none of them lost a field that hadn't expired.
+	remaining := 0
+	for i := 0; i < 100; i++ {
+		hash, _ := lookupValue[*data_structure.Hash](s, "session:"+strconv.Itoa(i), data_structure.ObjTypeHash)
+		if hash.HasExpiries() {
+			remaining++
+		}
+		_, ok := hash.Get("user")
+		assert.True(t, ok)
+	}
+	assert.LessOrEqual(t, remaining, 3)
+	for key := range s.hashFieldExpiries {
+		hash, _ := lookupValue[*data_structure.Hash](s, key, data_structure.ObjTypeHash)
+		assert.True(t, hash.HasExpiries(), key)
+	}
+	assert.NotContains(t, s.hashFieldExpiries, "gone")
+	assert.NotContains(t, s.hashFieldExpiries, "plain")
+}
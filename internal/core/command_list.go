@@ -0,0 +1,364 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+// listIndex resolves an index of the list commands, negative ones counting
+// from the tail, and reports whether it falls within a list of n elements.
+func listIndex(i int64, n int) (int, bool) {
+	if i < 0 {
+		i += int64(n)
+	}
+	return int(i), i >= 0 && i < int64(n)
+}
+
+// listRange resolves the start and stop of LRANGE and LTRIM, clamping them to
+// a list of n elements. ok is false when the range is empty.
+func listRange(start, stop int64, n int) (int, int, bool) {
+	if start < 0 {
+		start = max(start+int64(n), 0)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start > stop || start >= int64(n) {
+		return 0, 0, false
+	}
+	return int(start), int(min(stop, int64(n)-1)), true
+}
+
+// pushGeneric implements LPUSH and RPUSH.
+func (s *Storage) pushGeneric(name string, args []string, head bool) []byte {
+	if len(args) < 2 {
+		return Encode(fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name), false)
+	}
+	key := args[0]
+	list, err := s.lookupList(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		list = data_structure.NewQuicklist()
+		s.dictStore.Set(key, s.dictStore.NewObj(key, list, -1))
+		s.signalKeyAsReady(key)
+	}
+	if head {
+		list.PushHead(args[1:]...)
+	} else {
+		list.PushTail(args[1:]...)
+	}
+	s.dirty.Add(int64(len(args) - 1))
+	return Encode(int64(list.Len()), false)
+}
+
+func (s *Storage) cmdLPUSH(args []string) []byte {
+	return s.pushGeneric("LPUSH", args, true)
+}
+
+func (s *Storage) cmdRPUSH(args []string) []byte {
+	return s.pushGeneric("RPUSH", args, false)
+}
+
+// deleteIfEmpty removes key once its list has no elements left, as an empty
+// list can't exist.
+func (s *Storage) deleteIfEmpty(key string, list *data_structure.Quicklist) {
+	if list.Len() == 0 {
+		s.dictStore.Del(key)
+	}
+}
+
+// popGeneric implements LPOP and RPOP: key [count]. Without count it replies
+// with one element, with it an array of up to count elements.
+func (s *Storage) popGeneric(name string, args []string, head bool) []byte {
+	if len(args) < 1 || len(args) > 2 {
+		return Encode(fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name), false)
+	}
+	key := args[0]
+	count := int64(1)
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.ParseInt(args[1], 10, 64); err != nil || count < 0 {
+			return Encode(errors.New("(error) ERR value is out of range, must be positive"), false)
+		}
+	}
+	list, err := s.lookupList(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		if len(args) == 2 {
+			return constant.RespNilArray
+		}
+		return constant.RespNil
+	}
+
+	popped := make([]string, 0, min(count, int64(list.Len())))
+	for int64(len(popped)) < count {
+		var v string
+		var ok bool
+		if head {
+			v, ok = list.PopHead()
+		} else {
+			v, ok = list.PopTail()
+		}
+		if !ok {
+			break
+		}
+		popped = append(popped, v)
+	}
+	s.deleteIfEmpty(key, list)
+	s.dirty.Add(int64(len(popped)))
+	if len(args) == 2 {
+		return Encode(popped, false)
+	}
+	return Encode(popped[0], false)
+}
+
+func (s *Storage) cmdLPOP(args []string) []byte {
+	return s.popGeneric("LPOP", args, true)
+}
+
+func (s *Storage) cmdRPOP(args []string) []byte {
+	return s.popGeneric("RPOP", args, false)
+}
+
+func (s *Storage) cmdLLEN(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LLEN' command"), false)
+	}
+	list, err := s.lookupList(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		return constant.RespZero
+	}
+	return Encode(int64(list.Len()), false)
+}
+
+func (s *Storage) cmdLRANGE(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LRANGE' command"), false)
+	}
+	start, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	stop, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	list, err := s.lookupList(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		return Encode([]string{}, false)
+	}
+	first, last, ok := listRange(start, stop, list.Len())
+	if !ok {
+		return Encode([]string{}, false)
+	}
+	return Encode(list.Range(first, last), false)
+}
+
+func (s *Storage) cmdLINDEX(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LINDEX' command"), false)
+	}
+	index, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	list, err := s.lookupList(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		return constant.RespNil
+	}
+	i, ok := listIndex(index, list.Len())
+	if !ok {
+		return constant.RespNil
+	}
+	return Encode(list.Index(i), false)
+}
+
+func (s *Storage) cmdLSET(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LSET' command"), false)
+	}
+	index, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	list, err := s.lookupList(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		return Encode(errors.New("(error) ERR no such key"), false)
+	}
+	i, ok := listIndex(index, list.Len())
+	if !ok {
+		return Encode(errors.New("(error) ERR index out of range"), false)
+	}
+	list.Set(i, args[2])
+	s.dirty.Add(1)
+	return constant.RespOk
+}
+
+// cmdLREM is LREM key count element: count > 0 removes that many elements
+// equal to element from the head, count < 0 from the tail and 0 all of them.
+func (s *Storage) cmdLREM(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LREM' command"), false)
+	}
+	key := args[0]
+	count, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	list, err := s.lookupList(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		return constant.RespZero
+	}
+	// A count beyond the list length is the same as removing all matches.
+	if count > int64(list.Len()) || count < -int64(list.Len()) {
+		count = 0
+	}
+	removed := list.Remove(args[2], int(count))
+	s.deleteIfEmpty(key, list)
+	s.dirty.Add(int64(removed))
+	return Encode(int64(removed), false)
+}
+
+func (s *Storage) cmdLTRIM(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LTRIM' command"), false)
+	}
+	key := args[0]
+	start, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	stop, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	list, err := s.lookupList(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		return constant.RespOk
+	}
+	n := list.Len()
+	first, last, ok := listRange(start, stop, n)
+	if !ok {
+		first, last = 1, 0
+	}
+	list.Trim(first, last)
+	s.deleteIfEmpty(key, list)
+	s.dirty.Add(int64(n - list.Len()))
+	return constant.RespOk
+}
+
+// cmdLINSERT is LINSERT key BEFORE | AFTER pivot element. It replies with the
+// new length, -1 when pivot isn't in the list and 0 when the key is missing.
+func (s *Storage) cmdLINSERT(args []string) []byte {
+	if len(args) != 4 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LINSERT' command"), false)
+	}
+	var after bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		return Encode(errSyntax, false)
+	}
+	list, err := s.lookupList(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if list == nil {
+		return constant.RespZero
+	}
+	if !list.Insert(args[2], args[3], after) {
+		return Encode(int64(-1), false)
+	}
+	s.dirty.Add(1)
+	return Encode(int64(list.Len()), false)
+}
+
+// parseListEnd parses the LEFT | RIGHT arguments of LMOVE and BLMOVE, LEFT
+// being the head.
+func parseListEnd(v string) (head bool, err error) {
+	switch strings.ToUpper(v) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, errSyntax
+}
+
+// cmdLMOVE is LMOVE source destination LEFT | RIGHT LEFT | RIGHT: it pops an
+// element from one end of source and pushes it to one end of destination.
+func (s *Storage) cmdLMOVE(args []string) []byte {
+	if len(args) != 4 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LMOVE' command"), false)
+	}
+	src, dst := args[0], args[1]
+	fromHead, err := parseListEnd(args[2])
+	if err != nil {
+		return Encode(err, false)
+	}
+	toHead, err := parseListEnd(args[3])
+	if err != nil {
+		return Encode(err, false)
+	}
+	srcList, err := s.lookupList(src)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if srcList == nil {
+		return constant.RespNil
+	}
+	dstList, err := s.lookupList(dst)
+	if err != nil {
+		return Encode(err, false)
+	}
+
+	var v string
+	if fromHead {
+		v, _ = srcList.PopHead()
+	} else {
+		v, _ = srcList.PopTail()
+	}
+	s.deleteIfEmpty(src, srcList)
+	// The source may have been the destination, and now be gone.
+	if dstList == nil || dstList.Len() == 0 {
+		dstList = data_structure.NewQuicklist()
+		s.dictStore.Set(dst, s.dictStore.NewObj(dst, dstList, -1))
+		s.signalKeyAsReady(dst)
+	}
+	if toHead {
+		dstList.PushHead(v)
+	} else {
+		dstList.PushTail(v)
+	}
+	s.dirty.Add(1)
+	return Encode(v, false)
+}
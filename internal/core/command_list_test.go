@@ -0,0 +1,136 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdPUSHAndPOP(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, ":2\r\n", string(s.cmdRPUSH([]string{"q", "b", "c"})))
+	assert.Equal(t, ":4\r\n", string(s.cmdLPUSH([]string{"q", "a", "z"})))
+	assert.Equal(t, string(Encode([]string{"z", "a", "b", "c"}, false)), string(s.cmdLRANGE([]string{"q", "0", "-1"})))
+	assert.Equal(t, "+list\r\n", string(s.cmdTYPE([]string{"q"})))
+
+	assert.Equal(t, "$1\r\nz\r\n", string(s.cmdLPOP([]string{"q"})))
+	assert.Equal(t, "$1\r\nc\r\n", string(s.cmdRPOP([]string{"q"})))
+	assert.Equal(t, string(Encode([]string{"b", "a"}, false)), string(s.cmdRPOP([]string{"q", "5"})))
+	// The last pop deletes the key.
+	assert.False(t, s.keyExists("q"))
+	assert.Equal(t, "$-1\r\n", string(s.cmdLPOP([]string{"q"})))
+	assert.Equal(t, "*-1\r\n", string(s.cmdLPOP([]string{"q", "2"})))
+
+	s.cmdRPUSH([]string{"q", "x"})
+	assert.Equal(t, "*0\r\n", string(s.cmdLPOP([]string{"q", "0"})))
+	assert.Equal(t, "-(error) ERR value is out of range, must be positive\r\n", string(s.cmdLPOP([]string{"q", "-1"})))
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'RPUSH' command\r\n", string(s.cmdRPUSH([]string{"q"})))
+
+	s.cmdSET([]string{"str", "v"})
+	assert.Equal(t, wrongType, string(s.cmdLPUSH([]string{"str", "x"})))
+	assert.Equal(t, wrongType, string(s.cmdRPOP([]string{"str"})))
+	assert.Equal(t, wrongType, string(s.cmdLLEN([]string{"str"})))
+}
+
+func TestCmdLRANGEAndLINDEX(t *testing.T) {
+	s := setupStorage()
+	s.cmdRPUSH([]string{"l", "a", "b", "c", "d", "e"})
+	testCases := []struct {
+		start, stop string
+		want        []string
+	}{
+		{"0", "2", []string{"a", "b", "c"}},
+		{"-2", "-1", []string{"d", "e"}},
+		{"-100", "1", []string{"a", "b"}},
+		{"3", "100", []string{"d", "e"}},
+		{"3", "1", []string{}},
+		{"5", "10", []string{}},
+		{"0", "-6", []string{}},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, string(Encode(tc.want, false)), string(s.cmdLRANGE([]string{"l", tc.start, tc.stop})), tc.start+" "+tc.stop)
+	}
+	assert.Equal(t, "*0\r\n", string(s.cmdLRANGE([]string{"missing", "0", "-1"})))
+
+	assert.Equal(t, "$1\r\na\r\n", string(s.cmdLINDEX([]string{"l", "0"})))
+	assert.Equal(t, "$1\r\ne\r\n", string(s.cmdLINDEX([]string{"l", "-1"})))
+	assert.Equal(t, "$1\r\na\r\n", string(s.cmdLINDEX([]string{"l", "-5"})))
+	assert.Equal(t, "$-1\r\n", string(s.cmdLINDEX([]string{"l", "5"})))
+	assert.Equal(t, "$-1\r\n", string(s.cmdLINDEX([]string{"l", "-6"})))
+	assert.Equal(t, ":5\r\n", string(s.cmdLLEN([]string{"l"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdLLEN([]string{"missing"})))
+}
+
+func TestCmdLSET(t *testing.T) {
+	s := setupStorage()
+	s.cmdRPUSH([]string{"l", "a", "b", "c"})
+	assert.Equal(t, "+OK\r\n", string(s.cmdLSET([]string{"l", "-1", "z"})))
+	assert.Equal(t, "+OK\r\n", string(s.cmdLSET([]string{"l", "0", "y"})))
+	assert.Equal(t, string(Encode([]string{"y", "b", "z"}, false)), string(s.cmdLRANGE([]string{"l", "0", "-1"})))
+	assert.Equal(t, "-(error) ERR index out of range\r\n", string(s.cmdLSET([]string{"l", "3", "x"})))
+	assert.Equal(t, "-(error) ERR no such key\r\n", string(s.cmdLSET([]string{"missing", "0", "x"})))
+}
+
+func TestCmdLREM(t *testing.T) {
+	s := setupStorage()
+	s.cmdRPUSH([]string{"l", "a", "b", "a", "c", "a", "a"})
+	assert.Equal(t, ":2\r\n", string(s.cmdLREM([]string{"l", "-2", "a"})))
+	assert.Equal(t, string(Encode([]string{"a", "b", "a", "c"}, false)), string(s.cmdLRANGE([]string{"l", "0", "-1"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdLREM([]string{"l", "1", "a"})))
+	assert.Equal(t, string(Encode([]string{"b", "a", "c"}, false)), string(s.cmdLRANGE([]string{"l", "0", "-1"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdLREM([]string{"l", "0", "z"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdLREM([]string{"l", "100", "a"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdLREM([]string{"missing", "0", "a"})))
+
+	s.cmdLREM([]string{"l", "0", "b"})
+	s.cmdLREM([]string{"l", "0", "c"})
+	assert.False(t, s.keyExists("l"))
+}
+
+func TestCmdLTRIM(t *testing.T) {
+	s := setupStorage()
+	s.cmdRPUSH([]string{"l", "a", "b", "c", "d", "e"})
+	assert.Equal(t, "+OK\r\n", string(s.cmdLTRIM([]string{"l", "1", "-2"})))
+	assert.Equal(t, string(Encode([]string{"b", "c", "d"}, false)), string(s.cmdLRANGE([]string{"l", "0", "-1"})))
+	s.cmdLTRIM([]string{"l", "-100", "100"})
+	assert.Equal(t, ":3\r\n", string(s.cmdLLEN([]string{"l"})))
+	// An empty range deletes the list.
+	assert.Equal(t, "+OK\r\n", string(s.cmdLTRIM([]string{"l", "2", "1"})))
+	assert.False(t, s.keyExists("l"))
+	assert.Equal(t, "+OK\r\n", string(s.cmdLTRIM([]string{"missing", "0", "1"})))
+}
+
+func TestCmdLINSERT(t *testing.T) {
+	s := setupStorage()
+	s.cmdRPUSH([]string{"l", "a", "c"})
+	assert.Equal(t, ":3\r\n", string(s.cmdLINSERT([]string{"l", "BEFORE", "c", "b"})))
+	assert.Equal(t, ":4\r\n", string(s.cmdLINSERT([]string{"l", "after", "c", "d"})))
+	assert.Equal(t, string(Encode([]string{"a", "b", "c", "d"}, false)), string(s.cmdLRANGE([]string{"l", "0", "-1"})))
+	assert.Equal(t, ":-1\r\n", string(s.cmdLINSERT([]string{"l", "BEFORE", "z", "x"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdLINSERT([]string{"missing", "BEFORE", "a", "x"})))
+	assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdLINSERT([]string{"l", "BETWEEN", "a", "x"})))
+}
+
+func TestCmdLMOVE(t *testing.T) {
+	s := setupStorage()
+	s.cmdRPUSH([]string{"src", "a", "b", "c"})
+	assert.Equal(t, "$1\r\nc\r\n", string(s.cmdLMOVE([]string{"src", "dst", "RIGHT", "LEFT"})))
+	assert.Equal(t, "$1\r\na\r\n", string(s.cmdLMOVE([]string{"src", "dst", "left", "right"})))
+	assert.Equal(t, string(Encode([]string{"c", "a"}, false)), string(s.cmdLRANGE([]string{"dst", "0", "-1"})))
+
+	// Moving within one list rotates it.
+	assert.Equal(t, "$1\r\nc\r\n", string(s.cmdLMOVE([]string{"dst", "dst", "LEFT", "RIGHT"})))
+	assert.Equal(t, string(Encode([]string{"a", "c"}, false)), string(s.cmdLRANGE([]string{"dst", "0", "-1"})))
+
+	// The last element leaves with the source key.
+	assert.Equal(t, "$1\r\nb\r\n", string(s.cmdLMOVE([]string{"src", "src", "LEFT", "LEFT"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdLLEN([]string{"src"})))
+	s.cmdLMOVE([]string{"src", "dst", "LEFT", "LEFT"})
+	assert.False(t, s.keyExists("src"))
+	assert.Equal(t, "$-1\r\n", string(s.cmdLMOVE([]string{"src", "dst", "LEFT", "LEFT"})))
+
+	s.cmdSET([]string{"str", "v"})
+	assert.Equal(t, wrongType, string(s.cmdLMOVE([]string{"dst", "str", "LEFT", "LEFT"})))
+	assert.Equal(t, ":3\r\n", string(s.cmdLLEN([]string{"dst"})))
+	assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdLMOVE([]string{"dst", "x", "UP", "LEFT"})))
+}
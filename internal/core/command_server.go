@@ -0,0 +1,101 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+)
+
+// serverCommands concern the whole server rather than a key, so the
+// dispatcher runs them itself instead of sending them to a shard.
+var serverCommands = map[string]func(d *Dispatcher, args []string) []byte{
+	"INFO":         (*Dispatcher).cmdINFO,
+	"SAVE":         (*Dispatcher).cmdSAVE,
+	"BGSAVE":       (*Dispatcher).cmdBGSAVE,
+	"LASTSAVE":     (*Dispatcher).cmdLASTSAVE,
+	"BGREWRITEAOF": (*Dispatcher).cmdBGREWRITEAOF,
+}
+
+func (d *Dispatcher) cmdINFO(args []string) []byte {
+	if len(args) > 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'INFO' command"), false)
+	}
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	b.WriteString(fmt.Sprintf("shards:%d\r\n", len(d.shards)))
+	b.WriteString("\r\n# Stats\r\n")
+	b.WriteString(fmt.Sprintf("total_commands_processed:%d\r\n", d.stats.totalCommands.Load()))
+	b.WriteString(fmt.Sprintf("instantaneous_ops_per_sec:%d\r\n", d.stats.instantaneousOps()))
+	b.WriteString("\r\n# Persistence\r\n")
+	b.WriteString(fmt.Sprintf("rdb_changes_since_last_save:%d\r\n", d.dirty()-d.snapshots.dirtyAtSave.Load()))
+	b.WriteString(fmt.Sprintf("rdb_bgsave_in_progress:%d\r\n", boolToInt(d.snapshots.bgSaveInFlight.Load())))
+	b.WriteString(fmt.Sprintf("rdb_last_save_time:%d\r\n", d.snapshots.lastSave.Load()))
+	saveStatus := "ok"
+	if !d.snapshots.lastSaveOK.Load() {
+		saveStatus = "err"
+	}
+	b.WriteString(fmt.Sprintf("rdb_last_bgsave_status:%s\r\n", saveStatus))
+	b.WriteString(fmt.Sprintf("aof_enabled:%d\r\n", boolToInt(d.aof != nil)))
+	if d.aof != nil {
+		writeStatus := "ok"
+		if !d.aof.lastWriteOK.Load() {
+			writeStatus = "err"
+		}
+		b.WriteString(fmt.Sprintf("aof_last_write_status:%s\r\n", writeStatus))
+		b.WriteString(fmt.Sprintf("aof_rewrite_in_progress:%d\r\n", boolToInt(d.aof.rewriteInFlight.Load())))
+		rewriteStatus := "ok"
+		if !d.aof.lastRewriteOK.Load() {
+			rewriteStatus = "err"
+		}
+		b.WriteString(fmt.Sprintf("aof_last_bgrewrite_status:%s\r\n", rewriteStatus))
+		b.WriteString(fmt.Sprintf("aof_current_size:%d\r\n", d.aof.size.Load()))
+		b.WriteString(fmt.Sprintf("aof_base_size:%d\r\n", d.aof.baseSize.Load()))
+	}
+	return Encode(b.String(), false)
+}
+
+func (d *Dispatcher) cmdSAVE(args []string) []byte {
+	if len(args) != 0 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'SAVE' command"), false)
+	}
+	if err := d.Save(); err != nil {
+		return Encode(err, false)
+	}
+	return constant.RespOk
+}
+
+func (d *Dispatcher) cmdBGSAVE(args []string) []byte {
+	if len(args) != 0 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'BGSAVE' command"), false)
+	}
+	if err := d.BgSave(); err != nil {
+		return Encode(err, false)
+	}
+	return Encode("Background saving started", true)
+}
+
+func (d *Dispatcher) cmdLASTSAVE(args []string) []byte {
+	if len(args) != 0 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'LASTSAVE' command"), false)
+	}
+	return Encode(d.snapshots.lastSave.Load(), false)
+}
+
+func (d *Dispatcher) cmdBGREWRITEAOF(args []string) []byte {
+	if len(args) != 0 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'BGREWRITEAOF' command"), false)
+	}
+	if err := d.BgRewriteAof(); err != nil {
+		return Encode(err, false)
+	}
+	return Encode("Background append only file rewriting started", true)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
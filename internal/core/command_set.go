@@ -5,53 +5,70 @@ import (
 	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
 )
 
-func cmdSADD(args []string) []byte {
+func (s *Storage) cmdSADD(args []string) []byte {
 	if len(args) < 2 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'SADD' command"), false)
 	}
-	key := args[0] // TODO: check key is used by other types or not
-	set, exist := setStore[key]
-	if !exist {
+	key := args[0]
+	set, err := s.lookupSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if set == nil {
 		set = data_structure.NewSimpleSet(key)
-		setStore[key] = set
+		s.setValue(key, set)
 	}
 	count := set.Add(args[1:]...)
+	s.dirty.Add(int64(count))
 	return Encode(count, false)
 }
 
-func cmdSREM(args []string) []byte {
+func (s *Storage) cmdSREM(args []string) []byte {
 	if len(args) < 2 {
-		return Encode(errors.New("(error) ERR wrong number of arguments for 'SADD' command"), false)
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'SREM' command"), false)
 	}
 	key := args[0]
-	set, exist := setStore[key]
-	if !exist {
-		set = data_structure.NewSimpleSet(key)
-		setStore[key] = set
+	set, err := s.lookupSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if set == nil {
+		return Encode(0, false)
 	}
 	count := set.Rem(args[1:]...)
+	s.dirty.Add(int64(count))
+	// A set without members doesn't exist.
+	if set.Len() == 0 {
+		s.dictStore.Del(key)
+	}
 	return Encode(count, false)
 }
 
-func cmdSMEMBERS(args []string) []byte {
+func (s *Storage) cmdSMEMBERS(args []string) []byte {
 	if len(args) != 1 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'SMEMBERS' command"), false)
 	}
 	key := args[0]
-	set, exist := setStore[key]
-	if !exist {
+	set, err := s.lookupSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if set == nil {
 		return Encode(make([]string, 0), false)
 	}
 	return Encode(set.Members(), false)
 }
 
-func cmdSISMEMBER(args []string) []byte {
+func (s *Storage) cmdSISMEMBER(args []string) []byte {
 	if len(args) != 2 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'SISMEMBER' command"), false)
 	}
 	key := args[0]
-	set, exist := setStore[key]
-	if !exist {
+	set, err := s.lookupSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if set == nil {
 		return Encode(0, false)
 	}
 	return Encode(set.IsMember(args[1]), false)
@@ -3,71 +3,562 @@ package core
 import (
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/thaison199py/multi-threaded-redis/internal/constant"
 	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
 )
 
-func cmdZADD(args []string) []byte {
+// zaddFlags are the options of ZADD.
+type zaddFlags struct {
+	nx, xx, gt, lt, ch, incr bool
+}
+
+var errZaddNaN = errors.New("(error) ERR resulting score is not a number (NaN)")
+
+// zaddGeneric implements ZADD and ZINCRBY once their arguments are parsed. It
+// replies with the number of members added, or also changed with CH, or with
+// INCR the new score of the single member, nil when the flags prevented the
+// update.
+func (s *Storage) zaddGeneric(key string, flags zaddFlags, scores []float64, members []string) []byte {
+	zset, err := s.lookupZSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	// The set is only stored once something is added to it.
+	created := zset == nil
+	if created {
+		zset = data_structure.NewSortedSet(constant.DefaultBPlusTreeDegree)
+	}
+
+	added, changed := 0, 0
+	incrReply := constant.RespNil
+	for i, member := range members {
+		score := scores[i]
+		old, exists := zset.GetScore(member)
+		if (flags.nx && exists) || (flags.xx && !exists) {
+			continue
+		}
+		if flags.incr {
+			score += old
+			if math.IsNaN(score) {
+				return Encode(errZaddNaN, false)
+			}
+		}
+		if exists && ((flags.gt && score <= old) || (flags.lt && score >= old)) {
+			continue
+		}
+		if flags.incr {
+			incrReply = Encode(formatScore(score), false)
+		}
+		if zset.Add(score, member) == 1 {
+			added++
+		} else if score != old {
+			changed++
+		}
+	}
+
+	if created && zset.Len() > 0 {
+		s.setValue(key, zset)
+	}
+	s.dirty.Add(int64(added + changed))
+	switch {
+	case flags.incr:
+		return incrReply
+	case flags.ch:
+		return Encode(added+changed, false)
+	}
+	return Encode(added, false)
+}
+
+// parseZaddFlags parses the flags at the head of the arguments of ZADD and
+// returns them with how many arguments they are.
+func parseZaddFlags(args []string) (zaddFlags, int) {
+	var flags zaddFlags
+	for i, arg := range args {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			flags.nx = true
+		case "XX":
+			flags.xx = true
+		case "GT":
+			flags.gt = true
+		case "LT":
+			flags.lt = true
+		case "CH":
+			flags.ch = true
+		case "INCR":
+			flags.incr = true
+		default:
+			return flags, i
+		}
+	}
+	return flags, len(args)
+}
+
+// cmdZADD implements ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member
+// [score member ...].
+func (s *Storage) cmdZADD(args []string) []byte {
 	if len(args) < 3 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZADD' command"), false)
 	}
 	key := args[0]
 	scoreIndex := 1
 
+	flags, n := parseZaddFlags(args[scoreIndex:])
+	scoreIndex += n
+
 	numScoreEleArgs := len(args) - scoreIndex
 	if numScoreEleArgs%2 == 1 || numScoreEleArgs == 0 {
 		return Encode(errors.New(fmt.Sprintf("(error) Wrong number of (score, member) arg: %d", numScoreEleArgs)), false)
 	}
-
-	zset, exist := zsetStore[key]
-	if !exist {
-		zset = data_structure.NewSortedSet(constant.DefaultBPlusTreeDegree)
-		zsetStore[key] = zset
+	if flags.nx && flags.xx {
+		return Encode(errors.New("(error) ERR XX and NX options at the same time are not compatible"), false)
+	}
+	if (flags.gt && flags.lt) || (flags.nx && (flags.gt || flags.lt)) {
+		return Encode(errors.New("(error) ERR GT, LT, and/or NX options at the same time are not compatible"), false)
+	}
+	if flags.incr && numScoreEleArgs > 2 {
+		return Encode(errors.New("(error) ERR INCR option supports a single increment-element pair"), false)
 	}
 
-	count := 0
+	// Every score is checked before any member is added.
+	var scores []float64
+	var members []string
 	for i := scoreIndex; i < len(args); i += 2 {
-		member := args[i+1]
-		score, err := strconv.ParseFloat(args[i], 64)
-		if err != nil {
+		score, ok := parseFloat(args[i])
+		if !ok {
 			return Encode(errors.New("(error) Score must be floating point number"), false)
 		}
-		ret := zset.Add(score, member)
-		if ret != 1 {
-			return Encode(errors.New("error when adding element"), false)
-		}
-		count++
+		scores = append(scores, score)
+		members = append(members, args[i+1])
+	}
+	return s.zaddGeneric(key, flags, scores, members)
+}
+
+func (s *Storage) cmdZINCRBY(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZINCRBY' command"), false)
 	}
-	return Encode(count, false)
+	incr, ok := parseFloat(args[1])
+	if !ok {
+		return Encode(errNotFloat, false)
+	}
+	return s.zaddGeneric(args[0], zaddFlags{incr: true}, []float64{incr}, []string{args[2]})
 }
 
-func cmdZSCORE(args []string) []byte {
+func (s *Storage) cmdZSCORE(args []string) []byte {
 	if len(args) != 2 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZSCORE' command"), false)
 	}
 	key, member := args[0], args[1]
-	zset, exist := zsetStore[key]
-	if !exist {
+	zset, err := s.lookupZSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil {
 		return constant.RespNil
 	}
 	scoreVal, found := zset.GetScore(member)
 	if !found {
 		return constant.RespNil
 	}
-	return Encode(fmt.Sprintf("%f", scoreVal), false)
+	return Encode(formatScore(scoreVal), false)
 }
 
-func cmdZRANK(args []string) []byte {
+func (s *Storage) cmdZRANK(args []string) []byte {
 	if len(args) != 2 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZRANK' command"), false)
 	}
 	key, member := args[0], args[1]
-	zset, exist := zsetStore[key]
-	if !exist {
+	zset, err := s.lookupZSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil {
 		return constant.RespNil
 	}
 	rank := zset.GetRank(member)
+	if rank < 0 {
+		return constant.RespNil
+	}
 	return Encode(rank, false)
 }
+
+func (s *Storage) cmdZCARD(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZCARD' command"), false)
+	}
+	zset, err := s.lookupZSet(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil {
+		return constant.RespZero
+	}
+	return Encode(zset.Len(), false)
+}
+
+// zrangeBy is what the start and stop of a ZRANGE select on.
+type zrangeBy int
+
+const (
+	zrangeByRank zrangeBy = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+type zrangeOptions struct {
+	by         zrangeBy
+	rev        bool
+	limit      bool
+	offset     int64
+	count      int64
+	withScores bool
+}
+
+var errZrangeNotFloat = errors.New("(error) ERR min or max is not a float")
+
+// parseZrangeOptions parses the options after the start and stop of ZRANGE
+// and its older variants, which only take some of them: BYSCORE, BYLEX and REV
+// are only accepted when byArgs is set, LIMIT only when limit is.
+func parseZrangeOptions(args []string, by zrangeBy, byArgs, limit bool) (zrangeOptions, error) {
+	opts := zrangeOptions{by: by, count: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			opts.withScores = true
+		case "BYSCORE":
+			if !byArgs {
+				return opts, errSyntax
+			}
+			opts.by = zrangeByScore
+		case "BYLEX":
+			if !byArgs {
+				return opts, errSyntax
+			}
+			opts.by = zrangeByLex
+		case "REV":
+			if !byArgs {
+				return opts, errSyntax
+			}
+			opts.rev = true
+		case "LIMIT":
+			if !limit || i+2 >= len(args) {
+				return opts, errSyntax
+			}
+			offset, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return opts, errNotInteger
+			}
+			count, err := strconv.ParseInt(args[i+2], 10, 64)
+			if err != nil {
+				return opts, errNotInteger
+			}
+			opts.limit, opts.offset, opts.count = true, offset, count
+			i += 2
+		default:
+			return opts, errSyntax
+		}
+	}
+	if opts.limit && opts.by == zrangeByRank {
+		return opts, errors.New("(error) ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if opts.withScores && opts.by == zrangeByLex {
+		return opts, errors.New("(error) ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return opts, nil
+}
+
+// parseScoreBound parses a bound of a score range: a score, "-inf" or "+inf",
+// prefixed with '(' when the bound is exclusive.
+func parseScoreBound(v string) (data_structure.ScoreBound, bool) {
+	var b data_structure.ScoreBound
+	if strings.HasPrefix(v, "(") {
+		b.Exclusive = true
+		v = v[1:]
+	}
+	f, ok := parseFloat(v)
+	b.Value = f
+	return b, ok
+}
+
+// parseLexBound parses a bound of a member range: "-" and "+" stand for the
+// lowest and highest possible member, others are a member prefixed with '['
+// when the bound is inclusive or '(' when it is exclusive.
+func parseLexBound(v string) (data_structure.LexBound, bool) {
+	switch {
+	case v == "-":
+		return data_structure.LexBound{Inf: -1}, true
+	case v == "+":
+		return data_structure.LexBound{Inf: 1}, true
+	case strings.HasPrefix(v, "["):
+		return data_structure.LexBound{Value: v[1:]}, true
+	case strings.HasPrefix(v, "("):
+		return data_structure.LexBound{Value: v[1:], Exclusive: true}, true
+	}
+	return data_structure.LexBound{}, false
+}
+
+// formatScore formats a score of a reply the way Redis does, which unlike
+// strconv spells infinities "inf" and "-inf".
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// zrangeGeneric implements ZRANGE, ZRANGEBYSCORE and ZREVRANGE. start and
+// stop are ranks, scores or members according to opts.by, and go from high to
+// low when opts.rev is set unless they are ranks.
+func (s *Storage) zrangeGeneric(key, start, stop string, opts zrangeOptions) []byte {
+	var rankStart, rankStop int64
+	var scores data_structure.ScoreRange
+	var members data_structure.LexRange
+	switch opts.by {
+	case zrangeByRank:
+		var err error
+		if rankStart, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return Encode(errNotInteger, false)
+		}
+		if rankStop, err = strconv.ParseInt(stop, 10, 64); err != nil {
+			return Encode(errNotInteger, false)
+		}
+	case zrangeByScore:
+		if opts.rev {
+			start, stop = stop, start
+		}
+		var okMin, okMax bool
+		scores.Min, okMin = parseScoreBound(start)
+		scores.Max, okMax = parseScoreBound(stop)
+		if !okMin || !okMax {
+			return Encode(errZrangeNotFloat, false)
+		}
+	case zrangeByLex:
+		if opts.rev {
+			start, stop = stop, start
+		}
+		var okMin, okMax bool
+		members.Min, okMin = parseLexBound(start)
+		members.Max, okMax = parseLexBound(stop)
+		if !okMin || !okMax {
+			return Encode(errors.New("(error) ERR min or max not valid string range item"), false)
+		}
+	}
+
+	zset, err := s.lookupZSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil || opts.offset < 0 || opts.count == 0 {
+		return Encode([]string{}, false)
+	}
+	// Clamped to the size of the set, LIMIT fits in an int whatever it was.
+	offset := int(min(opts.offset, int64(zset.Len())))
+	count := int(max(min(opts.count, int64(zset.Len())), -1))
+
+	var items []*data_structure.Item
+	switch opts.by {
+	case zrangeByRank:
+		first, last, ok := listRange(rankStart, rankStop, zset.Len())
+		if !ok {
+			return Encode([]string{}, false)
+		}
+		if opts.rev {
+			first, last = zset.Len()-1-last, zset.Len()-1-first
+		}
+		items = zset.RangeByRank(first, last)
+		if opts.rev {
+			slices.Reverse(items)
+		}
+	case zrangeByScore:
+		items = zset.RangeByScore(scores, offset, count, opts.rev)
+	case zrangeByLex:
+		items = zset.RangeByLex(members, offset, count, opts.rev)
+	}
+
+	reply := make([]string, 0, len(items))
+	for _, item := range items {
+		reply = append(reply, item.Member)
+		if opts.withScores {
+			reply = append(reply, formatScore(item.Score))
+		}
+	}
+	return Encode(reply, false)
+}
+
+func (s *Storage) cmdZRANGE(args []string) []byte {
+	if len(args) < 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZRANGE' command"), false)
+	}
+	opts, err := parseZrangeOptions(args[3:], zrangeByRank, true, true)
+	if err != nil {
+		return Encode(err, false)
+	}
+	return s.zrangeGeneric(args[0], args[1], args[2], opts)
+}
+
+func (s *Storage) cmdZRANGEBYSCORE(args []string) []byte {
+	if len(args) < 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZRANGEBYSCORE' command"), false)
+	}
+	opts, err := parseZrangeOptions(args[3:], zrangeByScore, false, true)
+	if err != nil {
+		return Encode(err, false)
+	}
+	return s.zrangeGeneric(args[0], args[1], args[2], opts)
+}
+
+func (s *Storage) cmdZREVRANGE(args []string) []byte {
+	if len(args) < 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZREVRANGE' command"), false)
+	}
+	opts, err := parseZrangeOptions(args[3:], zrangeByRank, false, false)
+	if err != nil {
+		return Encode(err, false)
+	}
+	opts.rev = true
+	return s.zrangeGeneric(args[0], args[1], args[2], opts)
+}
+
+// deleteZSetIfEmpty removes key once its sorted set has no members left, as
+// an empty sorted set can't exist.
+func (s *Storage) deleteZSetIfEmpty(key string, zset *data_structure.SortedSet) {
+	if zset.Len() == 0 {
+		s.dictStore.Del(key)
+	}
+}
+
+func (s *Storage) cmdZREM(args []string) []byte {
+	if len(args) < 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZREM' command"), false)
+	}
+	key := args[0]
+	zset, err := s.lookupZSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil {
+		return constant.RespZero
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		if zset.Remove(member) {
+			removed++
+		}
+	}
+	s.deleteZSetIfEmpty(key, zset)
+	s.dirty.Add(int64(removed))
+	return Encode(removed, false)
+}
+
+// zremItems removes items from the sorted set at key and replies with how
+// many there were.
+func (s *Storage) zremItems(key string, zset *data_structure.SortedSet, items []*data_structure.Item) []byte {
+	for _, item := range items {
+		zset.Remove(item.Member)
+	}
+	s.deleteZSetIfEmpty(key, zset)
+	s.dirty.Add(int64(len(items)))
+	return Encode(len(items), false)
+}
+
+func (s *Storage) cmdZREMRANGEBYSCORE(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZREMRANGEBYSCORE' command"), false)
+	}
+	var r data_structure.ScoreRange
+	var okMin, okMax bool
+	r.Min, okMin = parseScoreBound(args[1])
+	r.Max, okMax = parseScoreBound(args[2])
+	if !okMin || !okMax {
+		return Encode(errZrangeNotFloat, false)
+	}
+	zset, err := s.lookupZSet(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil {
+		return constant.RespZero
+	}
+	return s.zremItems(args[0], zset, zset.RangeByScore(r, 0, -1, false))
+}
+
+func (s *Storage) cmdZREMRANGEBYRANK(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'ZREMRANGEBYRANK' command"), false)
+	}
+	start, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	stop, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	zset, err := s.lookupZSet(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil {
+		return constant.RespZero
+	}
+	first, last, ok := listRange(start, stop, zset.Len())
+	if !ok {
+		return constant.RespZero
+	}
+	return s.zremItems(args[0], zset, zset.RangeByRank(first, last))
+}
+
+// zpopGeneric implements ZPOPMIN and ZPOPMAX: key [count]. It replies with
+// the members popped, each followed by its score.
+func (s *Storage) zpopGeneric(name string, args []string, fromMax bool) []byte {
+	if len(args) < 1 || len(args) > 2 {
+		return Encode(fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name), false)
+	}
+	key := args[0]
+	count := int64(1)
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.ParseInt(args[1], 10, 64); err != nil || count < 0 {
+			return Encode(errors.New("(error) ERR value is out of range, must be positive"), false)
+		}
+	}
+	zset, err := s.lookupZSet(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if zset == nil || count == 0 {
+		return Encode([]string{}, false)
+	}
+
+	n := int(min(count, int64(zset.Len())))
+	var items []*data_structure.Item
+	if fromMax {
+		items = zset.RangeByRank(zset.Len()-n, zset.Len()-1)
+		slices.Reverse(items)
+	} else {
+		items = zset.RangeByRank(0, n-1)
+	}
+	reply := make([]string, 0, 2*len(items))
+	for _, item := range items {
+		reply = append(reply, item.Member, formatScore(item.Score))
+	}
+	s.zremItems(key, zset, items)
+	return Encode(reply, false)
+}
+
+func (s *Storage) cmdZPOPMIN(args []string) []byte {
+	return s.zpopGeneric("ZPOPMIN", args, false)
+}
+
+func (s *Storage) cmdZPOPMAX(args []string) []byte {
+	return s.zpopGeneric("ZPOPMAX", args, true)
+}
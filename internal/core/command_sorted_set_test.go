@@ -0,0 +1,218 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdZRANGE(t *testing.T) {
+	s := setupStorage()
+	s.cmdZADD([]string{"board", "1", "one", "2", "two", "3", "three", "3", "drei", "-inf", "low", "inf", "high"})
+	s.cmdZADD([]string{"lex", "0", "c", "0", "a", "0", "e", "0", "b", "0", "d"})
+
+	testCases := []struct {
+		name string
+		cmd  func([]string) []byte
+		args []string
+		want []string
+	}{
+		{"ZRANGE all", s.cmdZRANGE, []string{"board", "0", "-1"}, []string{"low", "one", "two", "drei", "three", "high"}},
+		{"ZRANGE ranks", s.cmdZRANGE, []string{"board", "1", "2", "WITHSCORES"}, []string{"one", "1", "two", "2"}},
+		{"ZRANGE out of range", s.cmdZRANGE, []string{"board", "6", "10"}, []string{}},
+		{"ZRANGE REV", s.cmdZRANGE, []string{"board", "0", "1", "REV", "WITHSCORES"}, []string{"high", "inf", "three", "3"}},
+		{"ZRANGE BYSCORE", s.cmdZRANGE, []string{"board", "(1", "3", "BYSCORE"}, []string{"two", "drei", "three"}},
+		{"ZRANGE BYSCORE REV", s.cmdZRANGE, []string{"board", "+inf", "(2", "BYSCORE", "REV", "WITHSCORES"},
+			[]string{"high", "inf", "three", "3", "drei", "3"}},
+		{"ZRANGE BYSCORE LIMIT", s.cmdZRANGE, []string{"board", "-inf", "+inf", "BYSCORE", "LIMIT", "1", "2"}, []string{"one", "two"}},
+		{"ZRANGE BYSCORE negative offset", s.cmdZRANGE, []string{"board", "-inf", "+inf", "BYSCORE", "LIMIT", "-1", "2"}, []string{}},
+		{"ZRANGE BYLEX", s.cmdZRANGE, []string{"lex", "[b", "(d", "BYLEX"}, []string{"b", "c"}},
+		{"ZRANGE BYLEX REV LIMIT", s.cmdZRANGE, []string{"lex", "+", "-", "BYLEX", "REV", "LIMIT", "1", "-1"}, []string{"d", "c", "b", "a"}},
+		{"ZRANGE missing", s.cmdZRANGE, []string{"missing", "0", "-1"}, []string{}},
+		{"ZRANGEBYSCORE", s.cmdZRANGEBYSCORE, []string{"board", "2", "(inf", "WITHSCORES", "LIMIT", "0", "2"}, []string{"two", "2", "drei", "3"}},
+		{"ZREVRANGE", s.cmdZREVRANGE, []string{"board", "-2", "-1"}, []string{"one", "low"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, string(Encode(tc.want, false)), string(tc.cmd(tc.args)))
+		})
+	}
+}
+
+func TestCmdZRANGE_errors(t *testing.T) {
+	s := setupStorage()
+	s.cmdZADD([]string{"board", "1", "one"})
+	s.cmdSET([]string{"str", "v"})
+
+	testCases := []struct {
+		name string
+		cmd  func([]string) []byte
+		args []string
+		want string
+	}{
+		{"arity", s.cmdZRANGE, []string{"board", "0"}, "-(error) ERR wrong number of arguments for 'ZRANGE' command\r\n"},
+		{"rank", s.cmdZRANGE, []string{"board", "0", "x"}, "-(error) ERR value is not an integer or out of range\r\n"},
+		{"score", s.cmdZRANGE, []string{"board", "(", "1", "BYSCORE"}, "-(error) ERR min or max is not a float\r\n"},
+		{"nan", s.cmdZRANGEBYSCORE, []string{"board", "nan", "1"}, "-(error) ERR min or max is not a float\r\n"},
+		{"lex", s.cmdZRANGE, []string{"board", "a", "+", "BYLEX"}, "-(error) ERR min or max not valid string range item\r\n"},
+		{"LIMIT by rank", s.cmdZRANGE, []string{"board", "0", "1", "LIMIT", "0", "1"},
+			"-(error) ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{"WITHSCORES by lex", s.cmdZRANGE, []string{"board", "-", "+", "BYLEX", "WITHSCORES"},
+			"-(error) ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n"},
+		{"short LIMIT", s.cmdZRANGEBYSCORE, []string{"board", "0", "1", "LIMIT", "0"}, "-(error) ERR syntax error\r\n"},
+		{"LIMIT count", s.cmdZRANGEBYSCORE, []string{"board", "0", "1", "LIMIT", "0", "x"}, "-(error) ERR value is not an integer or out of range\r\n"},
+		{"BYSCORE in ZRANGEBYSCORE", s.cmdZRANGEBYSCORE, []string{"board", "0", "1", "BYSCORE"}, "-(error) ERR syntax error\r\n"},
+		{"LIMIT in ZREVRANGE", s.cmdZREVRANGE, []string{"board", "0", "1", "LIMIT", "0", "1"}, "-(error) ERR syntax error\r\n"},
+		{"wrong type", s.cmdZRANGE, []string{"str", "0", "-1"}, wrongType},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, string(tc.cmd(tc.args)))
+		})
+	}
+}
+
+func TestCmdZREM(t *testing.T) {
+	s := setupStorage()
+	s.cmdZADD([]string{"board", "1", "one", "2", "two", "3", "three"})
+
+	assert.Equal(t, ":2\r\n", string(s.cmdZREM([]string{"board", "one", "missing", "three"})))
+	assert.Equal(t, string(Encode([]string{"two"}, false)), string(s.cmdZRANGE([]string{"board", "0", "-1"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdZREM([]string{"missing", "one"})))
+	// The key goes with its last member.
+	assert.Equal(t, ":1\r\n", string(s.cmdZREM([]string{"board", "two"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdEXISTS([]string{"board"})))
+}
+
+func TestCmdZREMRANGE(t *testing.T) {
+	s := setupStorage()
+	for i := 0; i < 20; i++ {
+		s.cmdZADD([]string{"board", strconv.Itoa(i), "m" + strconv.Itoa(i)})
+	}
+
+	assert.Equal(t, ":3\r\n", string(s.cmdZREMRANGEBYSCORE([]string{"board", "(4", "7"})))
+	assert.Equal(t, ":2\r\n", string(s.cmdZREMRANGEBYRANK([]string{"board", "-2", "-1"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdZREMRANGEBYRANK([]string{"board", "30", "40"})))
+	assert.Equal(t, string(Encode([]string{"m0", "m1", "m2", "m3", "m4", "m8", "m9", "m10", "m11", "m12", "m13", "m14", "m15", "m16", "m17"}, false)),
+		string(s.cmdZRANGE([]string{"board", "0", "-1"})))
+	assert.Equal(t, "-(error) ERR min or max is not a float\r\n", string(s.cmdZREMRANGEBYSCORE([]string{"board", "x", "1"})))
+	assert.Equal(t, "-(error) ERR value is not an integer or out of range\r\n", string(s.cmdZREMRANGEBYRANK([]string{"board", "0", "x"})))
+
+	assert.Equal(t, ":15\r\n", string(s.cmdZREMRANGEBYSCORE([]string{"board", "-inf", "+inf"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdEXISTS([]string{"board"})))
+}
+
+func TestCmdZPOP(t *testing.T) {
+	s := setupStorage()
+	s.cmdZADD([]string{"board", "1", "one", "2", "two", "3", "three", "4.5", "four"})
+
+	assert.Equal(t, string(Encode([]string{"one", "1"}, false)), string(s.cmdZPOPMIN([]string{"board"})))
+	assert.Equal(t, string(Encode([]string{"four", "4.5", "three", "3"}, false)), string(s.cmdZPOPMAX([]string{"board", "2"})))
+	assert.Equal(t, "*0\r\n", string(s.cmdZPOPMIN([]string{"board", "0"})))
+	assert.Equal(t, string(Encode([]string{"two", "2"}, false)), string(s.cmdZPOPMIN([]string{"board", "10"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdEXISTS([]string{"board"})))
+	assert.Equal(t, "*0\r\n", string(s.cmdZPOPMAX([]string{"board"})))
+	assert.Equal(t, "-(error) ERR value is out of range, must be positive\r\n", string(s.cmdZPOPMIN([]string{"board", "-1"})))
+}
+
+func TestCmdZRANKZSCOREAndZCARD(t *testing.T) {
+	s := setupStorage()
+	for i := 0; i < 100; i++ {
+		s.cmdZADD([]string{"board", strconv.Itoa(100 - i), "m" + strconv.Itoa(i)})
+	}
+
+	assert.Equal(t, ":100\r\n", string(s.cmdZCARD([]string{"board"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdZCARD([]string{"missing"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdZRANK([]string{"board", "m99"})))
+	assert.Equal(t, ":42\r\n", string(s.cmdZRANK([]string{"board", "m57"})))
+	assert.Equal(t, "$-1\r\n", string(s.cmdZRANK([]string{"board", "nobody"})))
+	assert.Equal(t, string(Encode("43", false)), string(s.cmdZSCORE([]string{"board", "m57"})))
+	assert.Equal(t, "$-1\r\n", string(s.cmdZSCORE([]string{"board", "nobody"})))
+
+	s.cmdZREM([]string{"board", "m99", "m98"})
+	assert.Equal(t, ":98\r\n", string(s.cmdZCARD([]string{"board"})))
+	assert.Equal(t, ":40\r\n", string(s.cmdZRANK([]string{"board", "m57"})))
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'ZCARD' command\r\n", string(s.cmdZCARD([]string{})))
+}
+
+func TestCmdZADD_flags(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, ":2\r\n", string(s.cmdZADD([]string{"board", "1", "one", "2", "two"})))
+
+	testCases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"update isn't an addition", []string{"board", "5", "one", "3", "three"}, ":1\r\n"},
+		{"CH counts changes", []string{"board", "CH", "6", "one", "2", "two", "4", "four"}, ":2\r\n"},
+		{"NX only adds", []string{"board", "NX", "CH", "0", "one", "5", "five"}, ":1\r\n"},
+		{"XX only updates", []string{"board", "XX", "CH", "7", "one", "6", "six"}, ":1\r\n"},
+		{"GT only raises", []string{"board", "GT", "CH", "1", "one", "8", "two", "0", "zero"}, ":2\r\n"},
+		{"LT only lowers", []string{"board", "lt", "ch", "9", "one", "1", "two"}, ":1\r\n"},
+		{"INCR", []string{"board", "INCR", "2.5", "one"}, string(Encode("9.5", false))},
+		{"INCR on a new member", []string{"board", "INCR", "-1", "neg"}, string(Encode("-1", false))},
+		{"INCR prevented", []string{"board", "GT", "INCR", "-1", "one"}, "$-1\r\n"},
+		{"INCR XX on a new member", []string{"board", "XX", "INCR", "1", "nobody"}, "$-1\r\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, string(s.cmdZADD(tc.args)))
+		})
+	}
+	assert.Equal(t, string(Encode([]string{"neg", "-1", "zero", "0", "two", "1", "three", "3", "four", "4", "five", "5", "one", "9.5"}, false)),
+		string(s.cmdZRANGE([]string{"board", "0", "-1", "WITHSCORES"})))
+
+	// Nothing is stored when nothing is added.
+	assert.Equal(t, ":0\r\n", string(s.cmdZADD([]string{"other", "XX", "1", "a"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdEXISTS([]string{"other"})))
+}
+
+func TestCmdZADD_errors(t *testing.T) {
+	s := setupStorage()
+	s.cmdZADD([]string{"board", "inf", "top"})
+
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"board", "NX", "XX", "1", "a"}, "-(error) ERR XX and NX options at the same time are not compatible\r\n"},
+		{[]string{"board", "GT", "LT", "1", "a"}, "-(error) ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{[]string{"board", "NX", "GT", "1", "a"}, "-(error) ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{[]string{"board", "INCR", "1", "a", "2", "b"}, "-(error) ERR INCR option supports a single increment-element pair\r\n"},
+		{[]string{"board", "CH", "1"}, "-(error) Wrong number of (score, member) arg: 1\r\n"},
+		{[]string{"board", "1", "a", "nan", "b"}, "-(error) Score must be floating point number\r\n"},
+		{[]string{"board", "INCR", "-inf", "top"}, "-(error) ERR resulting score is not a number (NaN)\r\n"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, string(s.cmdZADD(tc.args)), tc.args)
+	}
+	// A bad score anywhere means no member is added.
+	assert.Equal(t, ":1\r\n", string(s.cmdZCARD([]string{"board"})))
+}
+
+func TestCmdZINCRBY(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, string(Encode("2", false)), string(s.cmdZINCRBY([]string{"board", "2", "one"})))
+	assert.Equal(t, string(Encode("1.5", false)), string(s.cmdZINCRBY([]string{"board", "-0.5", "one"})))
+	assert.Equal(t, string(Encode("1.5", false)), string(s.cmdZSCORE([]string{"board", "one"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdZCARD([]string{"board"})))
+	assert.Equal(t, "-(error) ERR value is not a valid float\r\n", string(s.cmdZINCRBY([]string{"board", "x", "one"})))
+	s.cmdSET([]string{"str", "v"})
+	assert.Equal(t, wrongType, string(s.cmdZINCRBY([]string{"str", "1", "one"})))
+}
+
+func TestCmdZSCORE_formatsLikeZRANGE(t *testing.T) {
+	s := setupStorage()
+	s.cmdZADD([]string{"board", "1.5", "a", "100", "b", "-inf", "c", "+inf", "d", "1e30", "e", "0.1", "f"})
+
+	want := map[string]string{"a": "1.5", "b": "100", "c": "-inf", "d": "inf", "e": "1e+30", "f": "0.1"}
+	withScores := decodeArray(t, s.cmdZRANGE([]string{"board", "0", "-1", "WITHSCORES"}))
+	for i := 0; i < len(withScores); i += 2 {
+		member := withScores[i].(string)
+		assert.Equal(t, want[member], withScores[i+1], member)
+		assert.Equal(t, string(Encode(want[member], false)), string(s.cmdZSCORE([]string{"board", member})), member)
+	}
+	assert.Equal(t, string(Encode("1.5", false)), string(s.cmdZINCRBY([]string{"board", "0", "a"})))
+}
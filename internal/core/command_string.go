@@ -0,0 +1,417 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+var errOverflow = errors.New("(error) ERR increment or decrement would overflow")
+var errNotFloat = errors.New("(error) ERR value is not a valid float")
+
+// lookupInt returns the integer held by the string at key. A missing key
+// counts as 0.
+func (s *Storage) lookupInt(key string) (int64, error) {
+	obj := s.dictStore.Get(key)
+	if obj == nil {
+		return 0, nil
+	}
+	if obj.Type != data_structure.ObjTypeString {
+		return 0, errWrongType
+	}
+	if obj.Encoding == data_structure.ObjEncodingInt {
+		return obj.Value.(int64), nil
+	}
+	n, ok := parseCanonicalInt(stringOf(obj))
+	if !ok {
+		return 0, errNotInteger
+	}
+	return n, nil
+}
+
+func (s *Storage) incrDecr(key string, delta int64) []byte {
+	n, err := s.lookupInt(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return Encode(errOverflow, false)
+	}
+	n += delta
+	s.setValue(key, n)
+	s.dirty.Add(1)
+	return Encode(n, false)
+}
+
+func (s *Storage) cmdINCR(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'INCR' command"), false)
+	}
+	return s.incrDecr(args[0], 1)
+}
+
+func (s *Storage) cmdDECR(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'DECR' command"), false)
+	}
+	return s.incrDecr(args[0], -1)
+}
+
+func (s *Storage) cmdINCRBY(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'INCRBY' command"), false)
+	}
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	return s.incrDecr(args[0], delta)
+}
+
+func (s *Storage) cmdDECRBY(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'DECRBY' command"), false)
+	}
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	if delta == math.MinInt64 {
+		return Encode(errors.New("(error) ERR decrement would overflow"), false)
+	}
+	return s.incrDecr(args[0], -delta)
+}
+
+// parseFloat accepts the float syntax of Redis, which has no NaN.
+func parseFloat(v string) (float64, bool) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// formatFloat prints f the way INCRBYFLOAT stores it: the shortest decimal
+// that reads back as f, without an exponent.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (s *Storage) cmdINCRBYFLOAT(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'INCRBYFLOAT' command"), false)
+	}
+	key := args[0]
+	incr, ok := parseFloat(args[1])
+	if !ok {
+		return Encode(errNotFloat, false)
+	}
+	value, found, err := s.lookupString(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	var current float64
+	if found {
+		if current, ok = parseFloat(value); !ok {
+			return Encode(errNotFloat, false)
+		}
+	}
+	result := current + incr
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return Encode(errors.New("(error) ERR increment would produce NaN or Infinity"), false)
+	}
+	res := formatFloat(result)
+	s.setValue(key, stringValue(res))
+	s.dirty.Add(1)
+	return Encode(res, false)
+}
+
+// maxStringSize is the largest string APPEND and SETRANGE may build, the
+// default proto-max-bulk-len of Redis.
+const maxStringSize = 512 * 1024 * 1024
+
+var errStringTooLong = errors.New("(error) ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+
+func (s *Storage) cmdAPPEND(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'APPEND' command"), false)
+	}
+	key := args[0]
+	// The bytes encoding lets the string grow in place, so building a log
+	// with one APPEND per entry doesn't copy it every time.
+	value, _, err := s.lookupBitmap(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if len(value)+len(args[1]) > maxStringSize {
+		return Encode(errStringTooLong, false)
+	}
+	value = append(value, args[1]...)
+	s.setValue(key, value)
+	s.dirty.Add(1)
+	return Encode(int64(len(value)), false)
+}
+
+func (s *Storage) cmdSTRLEN(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'STRLEN' command"), false)
+	}
+	value, _, err := s.lookupString(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+	return Encode(int64(len(value)), false)
+}
+
+// cmdGETRANGE replies with the bytes of the string between start and end,
+// both inclusive. Negative offsets count from the end of the string, and the
+// range is clamped to the string.
+func (s *Storage) cmdGETRANGE(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'GETRANGE' command"), false)
+	}
+	start, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	end, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	value, _, err := s.lookupString(args[0])
+	if err != nil {
+		return Encode(err, false)
+	}
+
+	n := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return Encode("", false)
+	}
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = max(n+end, 0)
+	}
+	end = min(end, n-1)
+	if n == 0 || start > end {
+		return Encode("", false)
+	}
+	return Encode(value[start:end+1], false)
+}
+
+// cmdSETRANGE overwrites the string from offset on with value, padding it
+// with zero bytes first if it is shorter than offset.
+func (s *Storage) cmdSETRANGE(args []string) []byte {
+	if len(args) != 3 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'SETRANGE' command"), false)
+	}
+	key, patch := args[0], args[2]
+	offset, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return Encode(errNotInteger, false)
+	}
+	if offset < 0 {
+		return Encode(errors.New("(error) ERR offset is out of range"), false)
+	}
+	value, _, err := s.lookupString(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	// An empty patch changes nothing, and doesn't create the key.
+	if len(patch) == 0 {
+		return Encode(int64(len(value)), false)
+	}
+	if offset+int64(len(patch)) > maxStringSize {
+		return Encode(errStringTooLong, false)
+	}
+
+	end := int(offset) + len(patch)
+	buf := make([]byte, max(len(value), end))
+	copy(buf, value)
+	copy(buf[offset:], patch)
+	s.setValue(key, stringValue(string(buf)))
+	s.dirty.Add(1)
+	return Encode(int64(len(buf)), false)
+}
+
+func (s *Storage) cmdGETDEL(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'GETDEL' command"), false)
+	}
+	key := args[0]
+	value, found, err := s.lookupString(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if !found {
+		return constant.RespNil
+	}
+	s.dictStore.Del(key)
+	s.dirty.Add(1)
+	return Encode(value, false)
+}
+
+// cmdGETEX is GET key [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds | PERSIST], setting or removing the TTL of the
+// key in the same step as it is read.
+func (s *Storage) cmdGETEX(args []string) []byte {
+	if len(args) < 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'GETEX' command"), false)
+	}
+	key := args[0]
+	var expireAt int64
+	persist := false
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "PERSIST":
+			if persist || expireAt != 0 {
+				return Encode(errSyntax, false)
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if persist || expireAt != 0 || i+1 == len(args) {
+				return Encode(errSyntax, false)
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return Encode(errNotInteger, false)
+			}
+			if expireAt, err = expireAtMs("getex", opt, n, time.Now()); err != nil {
+				return Encode(err, false)
+			}
+		default:
+			return Encode(errSyntax, false)
+		}
+	}
+
+	value, found, err := s.lookupString(key)
+	if err != nil {
+		return Encode(err, false)
+	}
+	if !found {
+		return constant.RespNil
+	}
+	switch {
+	case expireAt > 0 && expireAt <= time.Now().UnixMilli():
+		// An EXAT or PXAT in the past deletes the key, as EXPIREAT does.
+		s.dictStore.Del(key)
+		s.dirty.Add(1)
+	case expireAt > 0:
+		s.dictStore.SetExpiryAt(key, uint64(expireAt))
+		s.dirty.Add(1)
+	case persist:
+		if s.dictStore.DelExpiry(key) {
+			s.dirty.Add(1)
+		}
+	}
+	return Encode(value, false)
+}
+
+// cmdGETSET is the older form of SET key value GET.
+func (s *Storage) cmdGETSET(args []string) []byte {
+	if len(args) != 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'GETSET' command"), false)
+	}
+	return s.cmdSET([]string{args[0], args[1], "GET"})
+}
+
+// checkPairs checks the arity of commands taking key value [key value ...].
+func checkPairs(name string, args []string) error {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return fmt.Errorf("(error) ERR wrong number of arguments for '%s' command", name)
+	}
+	return nil
+}
+
+// mset sets every key to the value following it, dropping their TTLs.
+func (s *Storage) mset(pairs []string) {
+	for i := 0; i < len(pairs); i += 2 {
+		key := pairs[i]
+		s.dictStore.Set(key, s.dictStore.NewObj(key, stringValue(pairs[i+1]), -1))
+		s.dictStore.DelExpiry(key)
+	}
+	s.dirty.Add(int64(len(pairs) / 2))
+}
+
+func (s *Storage) cmdMSET(args []string) []byte {
+	if err := checkPairs("MSET", args); err != nil {
+		return Encode(err, false)
+	}
+	s.mset(args)
+	return constant.RespOk
+}
+
+// cmdMSETNX sets the keys only if none of them exists.
+func (s *Storage) cmdMSETNX(args []string) []byte {
+	if err := checkPairs("MSETNX", args); err != nil {
+		return Encode(err, false)
+	}
+	for i := 0; i < len(args); i += 2 {
+		if s.keyExists(args[i]) {
+			return constant.RespZero
+		}
+	}
+	s.mset(args)
+	return constant.RespOne
+}
+
+// mget replies with the value of every key, nil for keys that are missing or
+// don't hold a string.
+func mget(keys []string, storageOf func(key string) *Storage) []byte {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if value, found, err := storageOf(key).lookupString(key); err == nil && found {
+			values[i] = value
+		}
+	}
+	return Encode(values, false)
+}
+
+func (s *Storage) cmdMGET(args []string) []byte {
+	if len(args) < 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'MGET' command"), false)
+	}
+	return mget(args, func(string) *Storage { return s })
+}
+
+func mgetAcrossShards(cmd *Command, storageOf func(key string) *Storage) []byte {
+	return mget(cmd.Args, storageOf)
+}
+
+// msetAcrossShards runs MSET or MSETNX on keys from several shards. Each
+// shard's part is executed as an MSET of its own, so it is counted and logged
+// to the AOF like any other write.
+func msetAcrossShards(cmd *Command, storageOf func(key string) *Storage) []byte {
+	if err := checkPairs(cmd.Cmd, cmd.Args); err != nil {
+		return Encode(err, false)
+	}
+	pairsByStorage := make(map[*Storage][]string)
+	var order []*Storage
+	for i := 0; i < len(cmd.Args); i += 2 {
+		key := cmd.Args[i]
+		s := storageOf(key)
+		if cmd.Cmd == "MSETNX" && s.keyExists(key) {
+			return constant.RespZero
+		}
+		if _, seen := pairsByStorage[s]; !seen {
+			order = append(order, s)
+		}
+		pairsByStorage[s] = append(pairsByStorage[s], key, cmd.Args[i+1])
+	}
+	for _, s := range order {
+		_ = s.ExecuteAndResponse(&Command{Cmd: "MSET", Args: pairsByStorage[s]}, io.Discard)
+	}
+	if cmd.Cmd == "MSETNX" {
+		return constant.RespOne
+	}
+	return constant.RespOk
+}
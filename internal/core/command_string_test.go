@@ -0,0 +1,262 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+func TestCmdINCRAndDECR(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, ":1\r\n", string(s.cmdINCR([]string{"counter"})))
+	assert.Equal(t, ":2\r\n", string(s.cmdINCR([]string{"counter"})))
+	assert.Equal(t, ":12\r\n", string(s.cmdINCRBY([]string{"counter", "10"})))
+	assert.Equal(t, ":11\r\n", string(s.cmdDECR([]string{"counter"})))
+	assert.Equal(t, ":-9\r\n", string(s.cmdDECRBY([]string{"counter", "20"})))
+	assert.Equal(t, ":-9\r\n", string(s.cmdINCRBY([]string{"counter", "0"})))
+	assert.Equal(t, "$2\r\n-9\r\n", string(s.cmdGET([]string{"counter"})))
+
+	obj := s.dictStore.Get("counter")
+	assert.Equal(t, data_structure.ObjEncodingInt, obj.Encoding)
+	assert.Equal(t, int64(-9), obj.Value)
+}
+
+func TestCmdINCR_existingValues(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"integer string", "41", ":42\r\n"},
+		{"negative integer", "-5", ":-4\r\n"},
+		{"not a number", "abc", "-(error) ERR value is not an integer or out of range\r\n"},
+		{"float", "1.5", "-(error) ERR value is not an integer or out of range\r\n"},
+		{"leading space", " 1", "-(error) ERR value is not an integer or out of range\r\n"},
+		{"plus sign", "+1", "-(error) ERR value is not an integer or out of range\r\n"},
+		{"leading zero", "01", "-(error) ERR value is not an integer or out of range\r\n"},
+		{"too large", "9223372036854775808", "-(error) ERR value is not an integer or out of range\r\n"},
+		{"max int64", "9223372036854775807", "-(error) ERR increment or decrement would overflow\r\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := setupStorage()
+			s.cmdSET([]string{"k", tc.value})
+			assert.Equal(t, tc.want, string(s.cmdINCR([]string{"k"})))
+		})
+	}
+}
+
+func TestCmdINCRBY_errors(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"min", "-9223372036854775808"})
+	assert.Equal(t, "-(error) ERR increment or decrement would overflow\r\n", string(s.cmdDECR([]string{"min"})))
+	assert.Equal(t, "-(error) ERR decrement would overflow\r\n", string(s.cmdDECRBY([]string{"k", "-9223372036854775808"})))
+	assert.Equal(t, "-(error) ERR value is not an integer or out of range\r\n", string(s.cmdINCRBY([]string{"k", "1.5"})))
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'INCR' command\r\n", string(s.cmdINCR([]string{})))
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'DECRBY' command\r\n", string(s.cmdDECRBY([]string{"k"})))
+
+	s.cmdSADD([]string{"set", "a"})
+	assert.Equal(t, wrongType, string(s.cmdINCR([]string{"set"})))
+	assert.Equal(t, wrongType, string(s.cmdINCRBYFLOAT([]string{"set", "1"})))
+}
+
+func TestCmdINCR_keepsTTL(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "1", "EX", "100"})
+	s.cmdINCR([]string{"k"})
+	s.cmdINCRBYFLOAT([]string{"k", "0.5"})
+	var ttl int64
+	assert.NoError(t, DecodeInt64(s.cmdTTL([]string{"k"}), &ttl))
+	assert.Equal(t, int64(100), ttl)
+}
+
+func TestCmdINCRBYFLOAT(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, "$4\r\n10.5\r\n", string(s.cmdINCRBYFLOAT([]string{"f", "10.5"})))
+	assert.Equal(t, "$4\r\n10.6\r\n", string(s.cmdINCRBYFLOAT([]string{"f", "0.1"})))
+	assert.Equal(t, "$6\r\n5610.6\r\n", string(s.cmdINCRBYFLOAT([]string{"f", "5.6e3"})))
+	assert.Equal(t, "$1\r\n3\r\n", string(s.cmdINCRBYFLOAT([]string{"f", "-5607.6"})))
+	// A whole result is stored as an integer and INCR can carry on.
+	assert.Equal(t, data_structure.ObjEncodingInt, s.dictStore.Get("f").Encoding)
+	assert.Equal(t, ":4\r\n", string(s.cmdINCR([]string{"f"})))
+
+	s.cmdSET([]string{"text", "abc"})
+	assert.Equal(t, "-(error) ERR value is not a valid float\r\n", string(s.cmdINCRBYFLOAT([]string{"text", "1"})))
+	assert.Equal(t, "-(error) ERR value is not a valid float\r\n", string(s.cmdINCRBYFLOAT([]string{"f", "abc"})))
+	assert.Equal(t, "-(error) ERR value is not a valid float\r\n", string(s.cmdINCRBYFLOAT([]string{"f", "nan"})))
+	s.cmdSET([]string{"big", "1e308"})
+	assert.Equal(t, "-(error) ERR increment would produce NaN or Infinity\r\n", string(s.cmdINCRBYFLOAT([]string{"big", "1e308"})))
+}
+
+func TestSET_integerEncoding(t *testing.T) {
+	s := setupStorage()
+	for value, encoding := range map[string]data_structure.ObjEncoding{
+		"123":                  data_structure.ObjEncodingInt,
+		"-7":                   data_structure.ObjEncodingInt,
+		"007":                  data_structure.ObjEncodingRaw,
+		"12.5":                 data_structure.ObjEncodingRaw,
+		"hello":                data_structure.ObjEncodingRaw,
+		"99999999999999999999": data_structure.ObjEncodingRaw,
+	} {
+		s.cmdSET([]string{"k", value})
+		assert.Equal(t, encoding, s.dictStore.Get("k").Encoding, value)
+		assert.Equal(t, string(Encode(value, false)), string(s.cmdGET([]string{"k"})))
+	}
+}
+
+func TestCmdAPPENDAndSTRLEN(t *testing.T) {
+	s := setupStorage()
+	assert.Equal(t, ":0\r\n", string(s.cmdSTRLEN([]string{"log"})))
+	assert.Equal(t, ":5\r\n", string(s.cmdAPPEND([]string{"log", "hello"})))
+	assert.Equal(t, ":11\r\n", string(s.cmdAPPEND([]string{"log", " world"})))
+	assert.Equal(t, ":11\r\n", string(s.cmdSTRLEN([]string{"log"})))
+	assert.Equal(t, "$11\r\nhello world\r\n", string(s.cmdGET([]string{"log"})))
+
+	// Appending to an integer works on its digits.
+	s.cmdSET([]string{"n", "12", "EX", "100"})
+	assert.Equal(t, ":3\r\n", string(s.cmdAPPEND([]string{"n", "3"})))
+	assert.Equal(t, ":124\r\n", string(s.cmdINCR([]string{"n"})))
+	assert.Equal(t, ":3\r\n", string(s.cmdSTRLEN([]string{"n"})))
+	_, hasExp := s.dictStore.GetExpiry("n")
+	assert.True(t, hasExp)
+
+	// The string grows in place rather than being copied on every APPEND.
+	var arrays []*byte
+	for i := 0; i < 1000; i++ {
+		s.cmdAPPEND([]string{"entries", "entry\n"})
+		b := s.dictStore.Get("entries").Value.([]byte)
+		if len(arrays) == 0 || arrays[len(arrays)-1] != &b[0] {
+			arrays = append(arrays, &b[0])
+		}
+	}
+	assert.Less(t, len(arrays), 30)
+	assert.Equal(t, ":6000\r\n", string(s.cmdSTRLEN([]string{"entries"})))
+
+	s.cmdSADD([]string{"set", "a"})
+	assert.Equal(t, wrongType, string(s.cmdAPPEND([]string{"set", "x"})))
+	assert.Equal(t, wrongType, string(s.cmdSTRLEN([]string{"set"})))
+}
+
+func TestCmdGETRANGE(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "This is a string"})
+	testCases := []struct {
+		start, end string
+		want       string
+	}{
+		{"0", "3", "This"},
+		{"-3", "-1", "ing"},
+		{"0", "-1", "This is a string"},
+		{"10", "100", "string"},
+		{"-100", "3", "This"},
+		{"5", "3", ""},
+		{"-1", "-5", ""},
+		{"100", "200", ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, string(Encode(tc.want, false)), string(s.cmdGETRANGE([]string{"k", tc.start, tc.end})), tc.start+" "+tc.end)
+	}
+	assert.Equal(t, "$0\r\n\r\n", string(s.cmdGETRANGE([]string{"missing", "0", "-1"})))
+	assert.Equal(t, "-(error) ERR value is not an integer or out of range\r\n", string(s.cmdGETRANGE([]string{"k", "a", "1"})))
+}
+
+func TestCmdSETRANGE(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "Hello World"})
+	assert.Equal(t, ":11\r\n", string(s.cmdSETRANGE([]string{"k", "6", "Redis"})))
+	assert.Equal(t, "$11\r\nHello Redis\r\n", string(s.cmdGET([]string{"k"})))
+
+	// A missing key, or one shorter than the offset, is padded with zero bytes.
+	assert.Equal(t, ":8\r\n", string(s.cmdSETRANGE([]string{"pad", "5", "abc"})))
+	assert.Equal(t, "$8\r\n\x00\x00\x00\x00\x00abc\r\n", string(s.cmdGET([]string{"pad"})))
+
+	// An empty value creates nothing.
+	assert.Equal(t, ":0\r\n", string(s.cmdSETRANGE([]string{"none", "3", ""})))
+	assert.False(t, s.keyExists("none"))
+	assert.Equal(t, ":11\r\n", string(s.cmdSETRANGE([]string{"k", "100", ""})))
+
+	s.cmdSET([]string{"n", "100"})
+	s.cmdSETRANGE([]string{"n", "0", "2"})
+	assert.Equal(t, ":201\r\n", string(s.cmdINCR([]string{"n"})))
+
+	assert.Equal(t, "-(error) ERR offset is out of range\r\n", string(s.cmdSETRANGE([]string{"k", "-1", "x"})))
+	assert.Equal(t, "-(error) ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n",
+		string(s.cmdSETRANGE([]string{"k", "536870911", "xy"})))
+	s.cmdSADD([]string{"set", "a"})
+	assert.Equal(t, wrongType, string(s.cmdSETRANGE([]string{"set", "0", "x"})))
+}
+
+func TestCmdGETDELAndGETSET(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "v"})
+	assert.Equal(t, "$1\r\nv\r\n", string(s.cmdGETDEL([]string{"k"})))
+	assert.False(t, s.keyExists("k"))
+	assert.Equal(t, "$-1\r\n", string(s.cmdGETDEL([]string{"k"})))
+
+	assert.Equal(t, "$-1\r\n", string(s.cmdGETSET([]string{"k", "1"})))
+	s.dictStore.SetExpiry("k", 100000)
+	assert.Equal(t, "$1\r\n1\r\n", string(s.cmdGETSET([]string{"k", "2"})))
+	assert.Equal(t, "$1\r\n2\r\n", string(s.cmdGET([]string{"k"})))
+	_, hasExp := s.dictStore.GetExpiry("k")
+	assert.False(t, hasExp)
+
+	s.cmdSADD([]string{"set", "a"})
+	assert.Equal(t, wrongType, string(s.cmdGETDEL([]string{"set"})))
+	assert.Equal(t, wrongType, string(s.cmdGETSET([]string{"set", "x"})))
+	assert.True(t, s.keyExists("set"))
+}
+
+func TestCmdGETEX(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "v"})
+	assert.Equal(t, "$1\r\nv\r\n", string(s.cmdGETEX([]string{"k"})))
+	_, hasExp := s.dictStore.GetExpiry("k")
+	assert.False(t, hasExp)
+
+	assert.Equal(t, "$1\r\nv\r\n", string(s.cmdGETEX([]string{"k", "EX", "100"})))
+	var ttl int64
+	assert.NoError(t, DecodeInt64(s.cmdTTL([]string{"k"}), &ttl))
+	assert.Equal(t, int64(100), ttl)
+
+	s.cmdGETEX([]string{"k", "persist"})
+	assert.Equal(t, string(constant.TtlKeyExistNoExpire), string(s.cmdTTL([]string{"k"})))
+
+	at := time.Now().Add(time.Hour).UnixMilli()
+	s.cmdGETEX([]string{"k", "PXAT", strconv.FormatInt(at, 10)})
+	exp, _ := s.dictStore.GetExpiry("k")
+	assert.Equal(t, uint64(at), exp)
+
+	// A time in the past deletes the key after reading it.
+	assert.Equal(t, "$1\r\nv\r\n", string(s.cmdGETEX([]string{"k", "EXAT", "1"})))
+	assert.False(t, s.keyExists("k"))
+	assert.Equal(t, "$-1\r\n", string(s.cmdGETEX([]string{"k", "EX", "10"})))
+
+	for _, args := range [][]string{{"k", "EX"}, {"k", "EX", "1", "PERSIST"}, {"k", "PERSIST", "PX", "1"}, {"k", "KEEPTTL"}} {
+		assert.Equal(t, "-(error) ERR syntax error\r\n", string(s.cmdGETEX(args)), args)
+	}
+	assert.Equal(t, "-(error) ERR invalid expire time in 'getex' command\r\n", string(s.cmdGETEX([]string{"k", "EX", "0"})))
+	assert.Equal(t, "-(error) ERR value is not an integer or out of range\r\n", string(s.cmdGETEX([]string{"k", "PX", "x"})))
+}
+
+func TestCmdMSETAndMGET(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"a", "old", "EX", "100"})
+	s.cmdSADD([]string{"set", "x"})
+	assert.Equal(t, "+OK\r\n", string(s.cmdMSET([]string{"a", "1", "b", "2", "a", "3"})))
+	assert.Equal(t, string(Encode([]interface{}{"3", "2", nil, nil}, false)), string(s.cmdMGET([]string{"a", "b", "missing", "set"})))
+	_, hasExp := s.dictStore.GetExpiry("a")
+	assert.False(t, hasExp)
+
+	assert.Equal(t, ":0\r\n", string(s.cmdMSETNX([]string{"c", "1", "b", "9"})))
+	assert.False(t, s.keyExists("c"))
+	assert.Equal(t, ":1\r\n", string(s.cmdMSETNX([]string{"c", "1", "d", "2"})))
+	assert.Equal(t, string(Encode([]interface{}{"1", "2"}, false)), string(s.cmdMGET([]string{"c", "d"})))
+
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'MSET' command\r\n", string(s.cmdMSET([]string{"a", "1", "b"})))
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'MSETNX' command\r\n", string(s.cmdMSETNX([]string{})))
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'MGET' command\r\n", string(s.cmdMGET([]string{})))
+}
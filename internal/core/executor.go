@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"io"
+	"math"
 	"strconv"
-	"syscall"
+	"strings"
 	"time"
 )
 
@@ -23,110 +25,171 @@ func cmdPING(args []string) []byte {
 	return res
 }
 
-func cmdSET(args []string) []byte {
-	if len(args) < 2 || len(args) == 3 || len(args) > 4 {
-		return Encode(errors.New("(error) ERR wrong number of arguments for 'SET' command"), false)
-	}
+// setOptions are the flags of SET key value [NX | XX] [GET]
+// [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds | KEEPTTL].
+type setOptions struct {
+	nx, xx  bool
+	get     bool
+	keepTTL bool
+	// expireAt is the absolute expiry in unix ms, 0 when none was given.
+	expireAt int64
+}
 
-	var key, value string
-	var ttlMs int64 = -1
+var errSyntax = errors.New("(error) ERR syntax error")
+var errNotInteger = errors.New("(error) ERR value is not an integer or out of range")
 
-	key, value = args[0], args[1]
-	if len(args) > 2 {
-		ttlSec, err := strconv.ParseInt(args[3], 10, 64)
-		if err != nil {
-			return Encode(errors.New("(error) ERR value is not an integer or out of range"), false)
+func parseSetOptions(args []string, now time.Time) (setOptions, error) {
+	var opts setOptions
+	hasExpire := false
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			if opts.xx {
+				return opts, errSyntax
+			}
+			opts.nx = true
+		case "XX":
+			if opts.nx {
+				return opts, errSyntax
+			}
+			opts.xx = true
+		case "GET":
+			opts.get = true
+		case "KEEPTTL":
+			if hasExpire {
+				return opts, errSyntax
+			}
+			opts.keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || opts.keepTTL || i+1 == len(args) {
+				return opts, errSyntax
+			}
+			hasExpire = true
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return opts, errNotInteger
+			}
+			if opts.expireAt, err = expireAtMs("set", opt, n, now); err != nil {
+				return opts, err
+			}
+		default:
+			return opts, errSyntax
 		}
-		ttlMs = ttlSec * 1000
 	}
+	return opts, nil
+}
 
-	dictStore.Set(key, dictStore.NewObj(key, value, ttlMs))
-	return constant.RespOk
+// expireAtMs converts the argument of EX, PX, EXAT or PXAT given to the
+// command name to an absolute time in unix ms, rejecting values that aren't
+// positive or would overflow.
+func expireAtMs(name, unit string, n int64, now time.Time) (int64, error) {
+	errInvalid := fmt.Errorf("(error) ERR invalid expire time in '%s' command", name)
+	if n <= 0 {
+		return 0, errInvalid
+	}
+	if unit == "EX" || unit == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return 0, errInvalid
+		}
+		n *= 1000
+	}
+	if unit == "EX" || unit == "PX" {
+		if n > math.MaxInt64-now.UnixMilli() {
+			return 0, errInvalid
+		}
+		n += now.UnixMilli()
+	}
+	return n, nil
 }
 
-func cmdGET(args []string) []byte {
-	if len(args) != 1 {
-		return Encode(errors.New("(error) ERR wrong number of arguments for 'GET' command"), false)
+func (s *Storage) cmdSET(args []string) []byte {
+	if len(args) < 2 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'SET' command"), false)
 	}
 
-	key := args[0]
-	obj := dictStore.Get(key)
-	if obj == nil {
-		return constant.RespNil
+	key, value := args[0], args[1]
+	opts, err := parseSetOptions(args[2:], time.Now())
+	if err != nil {
+		return Encode(err, false)
+	}
+
+	// With GET the reply is the old value, which must be a string.
+	reply := constant.RespOk
+	if opts.get {
+		old, found, err := s.lookupString(key)
+		if err != nil {
+			return Encode(err, false)
+		}
+		reply = constant.RespNil
+		if found {
+			reply = Encode(old, false)
+		}
 	}
 
-	if dictStore.HasExpired(key) {
+	exists := s.keyExists(key)
+	if (opts.nx && exists) || (opts.xx && !exists) {
+		if opts.get {
+			return reply
+		}
 		return constant.RespNil
 	}
 
-	return Encode(obj.Value, false)
+	exp, hasExp := s.dictStore.GetExpiry(key)
+	s.dictStore.Set(key, s.dictStore.NewObj(key, stringValue(value), -1))
+	switch {
+	case opts.expireAt > 0:
+		s.dictStore.SetExpiryAt(key, uint64(opts.expireAt))
+	case opts.keepTTL && hasExp:
+		s.dictStore.SetExpiryAt(key, exp)
+	default:
+		s.dictStore.DelExpiry(key)
+	}
+	s.dirty.Add(1)
+	return reply
 }
 
-func cmdTTL(args []string) []byte {
+func (s *Storage) cmdGET(args []string) []byte {
 	if len(args) != 1 {
-		return Encode(errors.New("(error) ERR wrong number of arguments for 'TTL' command"), false)
-	}
-	key := args[0]
-	obj := dictStore.Get(key)
-	if obj == nil {
-		return constant.TtlKeyNotExist
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'GET' command"), false)
 	}
 
-	exp, isExpirySet := dictStore.GetExpiry(key)
-	if !isExpirySet {
-		return constant.TtlKeyExistNoExpire
+	value, found, err := s.lookupString(args[0])
+	if err != nil {
+		return Encode(err, false)
 	}
-
-	remainMs := exp - uint64(time.Now().UnixMilli())
-	if remainMs < 0 {
-		return constant.TtlKeyNotExist
+	if !found {
+		return constant.RespNil
 	}
 
-	return Encode(int64(remainMs/1000), false)
+	return Encode(value, false)
 }
 
-func cmdDEL(args []string) []byte {
+func (s *Storage) cmdDEL(args []string) []byte {
 	if len(args) < 1 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'DEL' command"), false)
 	}
 
 	var deletedCount int
 	for _, key := range args {
-		if dictStore.Del(key) {
+		if s.dictStore.Del(key) {
 			deletedCount++
 		}
 	}
+	s.dirty.Add(int64(deletedCount))
 
 	return Encode(int64(deletedCount), false)
 }
 
-func cmdEXPIRE(args []string) []byte {
-	if len(args) != 2 {
-		return Encode(errors.New("(error) ERR wrong number of arguments for 'EXPIRE' command"), false)
-	}
-
-	key := args[0]
-	ttlSec, err := strconv.ParseInt(args[1], 10, 64)
-	if err != nil || ttlSec < 0 {
-		return Encode(errors.New("(error) ERR value is not an integer or out of range"), false)
-	}
-
-	if !dictStore.HasExpired(key) {
-		dictStore.SetExpiry(key, ttlSec*1000)
-		return constant.RespOk
-	}
-
-	return Encode(int64(0), false)
-}
-
-func cmdEXISTS(args []string) []byte {
+func (s *Storage) cmdEXISTS(args []string) []byte {
 	if len(args) < 1 {
 		return Encode(errors.New("(error) ERR wrong number of arguments for 'EXISTS' command"), false)
 	}
 
 	var existsCount int
 	for _, key := range args {
-		if dictStore.Get(key) != nil && !dictStore.HasExpired(key) {
+		if s.keyExists(key) {
 			existsCount++
 		}
 	}
@@ -134,56 +197,223 @@ func cmdEXISTS(args []string) []byte {
 	return Encode(int64(existsCount), false)
 }
 
-// ExecuteAndResponse given a Command, executes it and responses
-func ExecuteAndResponse(cmd *Command, connFd int) error {
+// ExecuteAndResponse given a Command, executes it and writes the reply to w.
+// The server passes a per-batch buffer so pipelined replies go out in one write.
+func (s *Storage) ExecuteAndResponse(cmd *Command, w io.Writer) error {
 	var res []byte
+	dirty := s.dirty.Load()
 
 	switch cmd.Cmd {
 	case "PING":
 		res = cmdPING(cmd.Args)
 	case "SET":
-		res = cmdSET(cmd.Args)
+		res = s.cmdSET(cmd.Args)
 	case "GET":
-		res = cmdGET(cmd.Args)
+		res = s.cmdGET(cmd.Args)
 	case "TTL":
-		res = cmdTTL(cmd.Args)
+		res = s.cmdTTL(cmd.Args)
+	case "INCR":
+		res = s.cmdINCR(cmd.Args)
+	case "DECR":
+		res = s.cmdDECR(cmd.Args)
+	case "INCRBY":
+		res = s.cmdINCRBY(cmd.Args)
+	case "DECRBY":
+		res = s.cmdDECRBY(cmd.Args)
+	case "INCRBYFLOAT":
+		res = s.cmdINCRBYFLOAT(cmd.Args)
+	case "APPEND":
+		res = s.cmdAPPEND(cmd.Args)
+	case "STRLEN":
+		res = s.cmdSTRLEN(cmd.Args)
+	case "GETRANGE":
+		res = s.cmdGETRANGE(cmd.Args)
+	case "SETRANGE":
+		res = s.cmdSETRANGE(cmd.Args)
+	case "GETDEL":
+		res = s.cmdGETDEL(cmd.Args)
+	case "GETEX":
+		res = s.cmdGETEX(cmd.Args)
+	case "GETSET":
+		res = s.cmdGETSET(cmd.Args)
+	case "MSET":
+		res = s.cmdMSET(cmd.Args)
+	case "MSETNX":
+		res = s.cmdMSETNX(cmd.Args)
+	case "MGET":
+		res = s.cmdMGET(cmd.Args)
+	case "SETBIT":
+		res = s.cmdSETBIT(cmd.Args)
+	case "GETBIT":
+		res = s.cmdGETBIT(cmd.Args)
+	case "BITCOUNT":
+		res = s.cmdBITCOUNT(cmd.Args)
+	case "BITPOS":
+		res = s.cmdBITPOS(cmd.Args)
+	case "BITOP":
+		res = s.cmdBITOP(cmd.Args)
+	case "BITFIELD":
+		res = s.cmdBITFIELD(cmd.Args)
 	case "DEL":
-		res = cmdDEL(cmd.Args)
+		res = s.cmdDEL(cmd.Args)
 	case "EXPIRE":
-		res = cmdEXPIRE(cmd.Args)
+		res = s.cmdEXPIRE(cmd.Args)
 	case "EXISTS":
-		res = cmdEXISTS(cmd.Args)
+		res = s.cmdEXISTS(cmd.Args)
+	case "TYPE":
+		res = s.cmdTYPE(cmd.Args)
+	case "PEXPIRE":
+		res = s.cmdPEXPIRE(cmd.Args)
+	case "EXPIREAT":
+		res = s.cmdEXPIREAT(cmd.Args)
+	case "PEXPIREAT":
+		res = s.cmdPEXPIREAT(cmd.Args)
+	case "PTTL":
+		res = s.cmdPTTL(cmd.Args)
+	case "EXPIRETIME":
+		res = s.cmdEXPIRETIME(cmd.Args)
+	case "PEXPIRETIME":
+		res = s.cmdPEXPIRETIME(cmd.Args)
+	case "PERSIST":
+		res = s.cmdPERSIST(cmd.Args)
+	case "DUMP":
+		res = s.cmdDUMP(cmd.Args)
+	case "RESTORE":
+		res = s.cmdRESTORE(cmd.Args)
 	case "ZADD":
-		res = cmdZADD(cmd.Args)
+		res = s.cmdZADD(cmd.Args)
+	case "ZINCRBY":
+		res = s.cmdZINCRBY(cmd.Args)
 	case "ZSCORE":
-		res = cmdZSCORE(cmd.Args)
+		res = s.cmdZSCORE(cmd.Args)
 	case "ZRANK":
-		res = cmdZRANK(cmd.Args)
+		res = s.cmdZRANK(cmd.Args)
+	case "ZCARD":
+		res = s.cmdZCARD(cmd.Args)
+	case "ZRANGE":
+		res = s.cmdZRANGE(cmd.Args)
+	case "ZRANGEBYSCORE":
+		res = s.cmdZRANGEBYSCORE(cmd.Args)
+	case "ZREVRANGE":
+		res = s.cmdZREVRANGE(cmd.Args)
+	case "ZREM":
+		res = s.cmdZREM(cmd.Args)
+	case "ZREMRANGEBYSCORE":
+		res = s.cmdZREMRANGEBYSCORE(cmd.Args)
+	case "ZREMRANGEBYRANK":
+		res = s.cmdZREMRANGEBYRANK(cmd.Args)
+	case "ZPOPMIN":
+		res = s.cmdZPOPMIN(cmd.Args)
+	case "ZPOPMAX":
+		res = s.cmdZPOPMAX(cmd.Args)
+	case "LPUSH":
+		res = s.cmdLPUSH(cmd.Args)
+	case "RPUSH":
+		res = s.cmdRPUSH(cmd.Args)
+	case "LPOP":
+		res = s.cmdLPOP(cmd.Args)
+	case "RPOP":
+		res = s.cmdRPOP(cmd.Args)
+	case "LLEN":
+		res = s.cmdLLEN(cmd.Args)
+	case "LRANGE":
+		res = s.cmdLRANGE(cmd.Args)
+	case "LINDEX":
+		res = s.cmdLINDEX(cmd.Args)
+	case "LSET":
+		res = s.cmdLSET(cmd.Args)
+	case "LREM":
+		res = s.cmdLREM(cmd.Args)
+	case "LTRIM":
+		res = s.cmdLTRIM(cmd.Args)
+	case "LINSERT":
+		res = s.cmdLINSERT(cmd.Args)
+	case "LMOVE":
+		res = s.cmdLMOVE(cmd.Args)
+	case "BLPOP":
+		res = s.cmdBLPOP(cmd.Args)
+	case "BRPOP":
+		res = s.cmdBRPOP(cmd.Args)
+	case "BLMOVE":
+		res = s.cmdBLMOVE(cmd.Args)
+	case "HSET":
+		res = s.cmdHSET(cmd.Args)
+	case "HSETNX":
+		res = s.cmdHSETNX(cmd.Args)
+	case "HGET":
+		res = s.cmdHGET(cmd.Args)
+	case "HMGET":
+		res = s.cmdHMGET(cmd.Args)
+	case "HDEL":
+		res = s.cmdHDEL(cmd.Args)
+	case "HLEN":
+		res = s.cmdHLEN(cmd.Args)
+	case "HEXISTS":
+		res = s.cmdHEXISTS(cmd.Args)
+	case "HGETALL":
+		res = s.cmdHGETALL(cmd.Args)
+	case "HKEYS":
+		res = s.cmdHKEYS(cmd.Args)
+	case "HVALS":
+		res = s.cmdHVALS(cmd.Args)
+	case "HINCRBY":
+		res = s.cmdHINCRBY(cmd.Args)
+	case "HINCRBYFLOAT":
+		res = s.cmdHINCRBYFLOAT(cmd.Args)
+	case "HSCAN":
+		res = s.cmdHSCAN(cmd.Args)
+	case "HEXPIRE":
+		res = s.cmdHEXPIRE(cmd.Args)
+	case "HPEXPIRE":
+		res = s.cmdHPEXPIRE(cmd.Args)
+	case "HEXPIREAT":
+		res = s.cmdHEXPIREAT(cmd.Args)
+	case "HPEXPIREAT":
+		res = s.cmdHPEXPIREAT(cmd.Args)
+	case "HTTL":
+		res = s.cmdHTTL(cmd.Args)
+	case "HPTTL":
+		res = s.cmdHPTTL(cmd.Args)
+	case "HPERSIST":
+		res = s.cmdHPERSIST(cmd.Args)
 	case "SADD":
-		res = cmdSADD(cmd.Args)
+		res = s.cmdSADD(cmd.Args)
 	case "SREM":
-		res = cmdSREM(cmd.Args)
+		res = s.cmdSREM(cmd.Args)
 	case "SMEMBERS":
-		res = cmdSMEMBERS(cmd.Args)
+		res = s.cmdSMEMBERS(cmd.Args)
 	case "SISMEMBER":
-		res = cmdSISMEMBER(cmd.Args)
+		res = s.cmdSISMEMBER(cmd.Args)
 	case "CMS.INITBYDIM":
-		res = cmdCMSINITBYDIM(cmd.Args)
+		res = s.cmdCMSINITBYDIM(cmd.Args)
 	case "CMS.INITBYPROB":
-		res = cmdCMSINITBYPROB(cmd.Args)
+		res = s.cmdCMSINITBYPROB(cmd.Args)
 	case "CMS.INCRBY":
-		res = cmdCMSINCRBY(cmd.Args)
+		res = s.cmdCMSINCRBY(cmd.Args)
 	case "CMS.QUERY":
-		res = cmdCMSQUERY(cmd.Args)
+		res = s.cmdCMSQUERY(cmd.Args)
 	case "BF.RESERVE":
-		res = cmdBFRESERVE(cmd.Args)
+		res = s.cmdBFRESERVE(cmd.Args)
 	case "BF.MADD":
-		res = cmdBFMADD(cmd.Args)
+		res = s.cmdBFMADD(cmd.Args)
 	case "BF.EXISTS":
-		res = cmdBFEXISTS(cmd.Args)
+		res = s.cmdBFEXISTS(cmd.Args)
 	default:
 		res = []byte(fmt.Sprintf("-CMD NOT FOUND\r\n"))
 	}
-	_, err := syscall.Write(connFd, res)
+	// Handlers count their changes in s.dirty; a command that changed
+	// something is logged to the AOF, and may have pushed to a list clients
+	// are blocked on.
+	if s.dirty.Load() != dirty {
+		if s.aof != nil {
+			if cmds := s.aofCommands(cmd); len(cmds) > 0 {
+				s.aof.feed(cmds)
+			}
+		}
+		if len(s.readyKeys) > 0 {
+			s.serveBlockedClients()
+		}
+	}
+	_, err := w.Write(res)
 	return err
 }
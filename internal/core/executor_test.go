@@ -1,15 +1,16 @@
 package core
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thaison199py/multi-threaded-redis/internal/constant"
-	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
 )
 
 // DecodeInt64 helper function to decode response into int64
@@ -27,27 +28,26 @@ func DecodeInt64(resp []byte, val *int64) error {
 	return nil
 }
 
-func setupDictStore() *data_structure.Dict {
-	d := data_structure.CreateDict()
-	return d
+func setupStorage() *Storage {
+	return NewStorage()
 }
 
 func TestCmdExists(t *testing.T) {
-	d := setupDictStore()
+	s := setupStorage()
+	d := s.dictStore
 	d.Set("foo", d.NewObj("foo", "bar", -1))
 	// Create expired key by setting expiry to current time - 1 second
 	d.Set("baz", d.NewObj("baz", "qux", -1))
 	d.SetExpiry("baz", -1000) // Set expiry to 1 second in the past
-	dictStore = d
 
 	// Test: 1 key exists and not expired
-	res := cmdEXISTS([]string{"foo", "baz", "notfound"})
+	res := s.cmdEXISTS([]string{"foo", "baz", "notfound"})
 	if string(res) != string(Encode(int64(1), false)) {
 		t.Errorf("expected 1, got %s", res)
 	}
 
 	// Test: no args
-	res = cmdEXISTS([]string{})
+	res = s.cmdEXISTS([]string{})
 	if string(res) != string(Encode(errors.New("(error) ERR wrong number of arguments for 'EXISTS' command"), false)) {
 		t.Errorf("expected error for no args, got %s", res)
 	}
@@ -69,89 +69,182 @@ func TestCmdPING(t *testing.T) {
 }
 
 func TestCmdSET(t *testing.T) {
-	d := setupDictStore()
-	dictStore = d
-	res := cmdSET([]string{"foo", "bar"})
+	s := setupStorage()
+	res := s.cmdSET([]string{"foo", "bar"})
 	if string(res) != string(constant.RespOk) {
 		t.Errorf("expected OK, got %s", res)
 	}
-	res = cmdSET([]string{"foo"})
+	res = s.cmdSET([]string{"foo"})
 	if string(res) != string(Encode(errors.New("(error) ERR wrong number of arguments for 'SET' command"), false)) {
 		t.Errorf("expected error, got %s", res)
 	}
 }
 
+func TestCmdSET_options(t *testing.T) {
+	syntaxErr := "-(error) ERR syntax error\r\n"
+	invalidExpire := "-(error) ERR invalid expire time in 'set' command\r\n"
+	notInteger := "-(error) ERR value is not an integer or out of range\r\n"
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	futureMs := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+
+	testCases := []struct {
+		name  string
+		setup func(s *Storage)
+		args  []string
+		want  string
+		value string // expected value afterwards, "" for none
+		ttl   int64  // expected TTL in seconds afterwards, -1 for none, -2 missing
+	}{
+		{name: "EX", args: []string{"k", "v", "EX", "100"}, want: "+OK\r\n", value: "v", ttl: 100},
+		{name: "PX", args: []string{"k", "v", "px", "100000"}, want: "+OK\r\n", value: "v", ttl: 100},
+		{name: "EXAT", args: []string{"k", "v", "EXAT", future}, want: "+OK\r\n", value: "v", ttl: 3600},
+		{name: "PXAT", args: []string{"k", "v", "PXAT", futureMs}, want: "+OK\r\n", value: "v", ttl: 3600},
+		{name: "NX on a missing key", args: []string{"k", "v", "NX", "PX", "30000"}, want: "+OK\r\n", value: "v", ttl: 30},
+		{
+			name:  "NX on an existing key",
+			setup: func(s *Storage) { s.cmdSET([]string{"k", "old"}) },
+			args:  []string{"k", "v", "NX"}, want: "$-1\r\n", value: "old", ttl: -1,
+		},
+		{name: "XX on a missing key", args: []string{"k", "v", "XX"}, want: "$-1\r\n", ttl: -2},
+		{
+			name:  "XX on an existing key",
+			setup: func(s *Storage) { s.cmdSET([]string{"k", "old"}) },
+			args:  []string{"k", "v", "XX"}, want: "+OK\r\n", value: "v", ttl: -1,
+		},
+		{
+			name:  "a plain SET clears the TTL",
+			setup: func(s *Storage) { s.cmdSET([]string{"k", "old", "EX", "100"}) },
+			args:  []string{"k", "v"}, want: "+OK\r\n", value: "v", ttl: -1,
+		},
+		{
+			name:  "KEEPTTL",
+			setup: func(s *Storage) { s.cmdSET([]string{"k", "old", "EX", "100"}) },
+			args:  []string{"k", "v", "KEEPTTL"}, want: "+OK\r\n", value: "v", ttl: 100,
+		},
+		{name: "KEEPTTL on a missing key", args: []string{"k", "v", "KEEPTTL"}, want: "+OK\r\n", value: "v", ttl: -1},
+		{name: "GET on a missing key", args: []string{"k", "v", "GET"}, want: "$-1\r\n", value: "v", ttl: -1},
+		{
+			name:  "GET returns the old value",
+			setup: func(s *Storage) { s.cmdSET([]string{"k", "old"}) },
+			args:  []string{"k", "v", "GET", "EX", "10"}, want: "$3\r\nold\r\n", value: "v", ttl: 10,
+		},
+		{
+			name:  "NX GET on an existing key",
+			setup: func(s *Storage) { s.cmdSET([]string{"k", "old"}) },
+			args:  []string{"k", "v", "NX", "GET"}, want: "$3\r\nold\r\n", value: "old", ttl: -1,
+		},
+		{
+			name:  "GET on another type",
+			setup: func(s *Storage) { s.cmdSADD([]string{"k", "m"}) },
+			args:  []string{"k", "v", "GET"}, want: wrongType, ttl: -1,
+		},
+		{name: "NX and XX", args: []string{"k", "v", "NX", "XX"}, want: syntaxErr, ttl: -2},
+		{name: "EX and PX", args: []string{"k", "v", "EX", "10", "PX", "100"}, want: syntaxErr, ttl: -2},
+		{name: "EX and KEEPTTL", args: []string{"k", "v", "EX", "10", "KEEPTTL"}, want: syntaxErr, ttl: -2},
+		{name: "KEEPTTL and PXAT", args: []string{"k", "v", "KEEPTTL", "PXAT", futureMs}, want: syntaxErr, ttl: -2},
+		{name: "EX without a value", args: []string{"k", "v", "EX"}, want: syntaxErr, ttl: -2},
+		{name: "unknown option", args: []string{"k", "v", "FOREVER"}, want: syntaxErr, ttl: -2},
+		{name: "non-integer EX", args: []string{"k", "v", "EX", "soon"}, want: notInteger, ttl: -2},
+		{name: "zero EX", args: []string{"k", "v", "EX", "0"}, want: invalidExpire, ttl: -2},
+		{name: "negative PX", args: []string{"k", "v", "PX", "-5"}, want: invalidExpire, ttl: -2},
+		{name: "overflowing EX", args: []string{"k", "v", "EX", "9223372036854775807"}, want: invalidExpire, ttl: -2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := setupStorage()
+			if tc.setup != nil {
+				tc.setup(s)
+			}
+			assert.Equal(t, tc.want, string(s.cmdSET(tc.args)))
+			if tc.value != "" {
+				assert.Equal(t, string(Encode(tc.value, false)), string(s.cmdGET([]string{"k"})))
+			}
+			var ttl int64
+			assert.NoError(t, DecodeInt64(s.cmdTTL([]string{"k"}), &ttl))
+			assert.InDelta(t, tc.ttl, ttl, 1)
+		})
+	}
+}
+
 func TestCmdGET(t *testing.T) {
-	d := setupDictStore()
+	s := setupStorage()
+	d := s.dictStore
 	d.Set("foo", d.NewObj("foo", "bar", -1))
-	dictStore = d
-	res := cmdGET([]string{"foo"})
+	res := s.cmdGET([]string{"foo"})
 	if string(res) != string(Encode("bar", false)) {
 		t.Errorf("expected bar, got %s", res)
 	}
-	res = cmdGET([]string{"notfound"})
+	res = s.cmdGET([]string{"notfound"})
 	if string(res) != string(constant.RespNil) {
 		t.Errorf("expected nil, got %s", res)
 	}
-	res = cmdGET([]string{})
+	res = s.cmdGET([]string{})
 	if string(res) != string(Encode(errors.New("(error) ERR wrong number of arguments for 'GET' command"), false)) {
 		t.Errorf("expected error, got %s", res)
 	}
 }
 
 func TestCmdDEL(t *testing.T) {
-	d := setupDictStore()
+	s := setupStorage()
+	d := s.dictStore
 	d.Set("foo", d.NewObj("foo", "bar", -1))
 	d.Set("baz", d.NewObj("baz", "qux", -1))
-	dictStore = d
-	res := cmdDEL([]string{"foo", "baz", "notfound"})
+	res := s.cmdDEL([]string{"foo", "baz", "notfound"})
 	if string(res) != string(Encode(int64(2), false)) {
 		t.Errorf("expected 2, got %s", res)
 	}
-	res = cmdDEL([]string{})
+	res = s.cmdDEL([]string{})
 	if string(res) != string(Encode(errors.New("(error) ERR wrong number of arguments for 'DEL' command"), false)) {
 		t.Errorf("expected error, got %s", res)
 	}
 }
 
 func TestCmdExpire(t *testing.T) {
-	d := setupDictStore()
+	s := setupStorage()
+	d := s.dictStore
 	d.Set("foo", d.NewObj("foo", "bar", -1))
-	dictStore = d
-	res := cmdEXPIRE([]string{"foo", "10"})
-	if string(res) != string(constant.RespOk) {
-		t.Errorf("expected OK, got %s", res)
+	res := s.cmdEXPIRE([]string{"foo", "10"})
+	if string(res) != string(constant.RespOne) {
+		t.Errorf("expected 1, got %s", res)
 	}
-	res = cmdEXPIRE([]string{"foo"})
+	res = s.cmdEXPIRE([]string{"foo"})
 	if string(res) != string(Encode(errors.New("(error) ERR wrong number of arguments for 'EXPIRE' command"), false)) {
 		t.Errorf("expected error, got %s", res)
 	}
-	res = cmdEXPIRE([]string{"foo", "-1"})
-	if string(res) != string(Encode(errors.New("(error) ERR value is not an integer or out of range"), false)) {
-		t.Errorf("expected error, got %s", res)
+	// A negative TTL is a deadline in the past, which deletes the key.
+	res = s.cmdEXPIRE([]string{"foo", "-1"})
+	if string(res) != string(constant.RespOne) {
+		t.Errorf("expected 1, got %s", res)
+	}
+	if s.keyExists("foo") {
+		t.Errorf("expected foo to be deleted")
+	}
+	res = s.cmdPEXPIRE([]string{"foo", "-1"})
+	if string(res) != string(constant.RespZero) {
+		t.Errorf("expected 0 for a missing key, got %s", res)
 	}
 }
 
 func TestCmdTTL(t *testing.T) {
-	d := setupDictStore()
-	dictStore = d
+	s := setupStorage()
+	d := s.dictStore
 
 	// Test non-existent key
-	res := cmdTTL([]string{"nonexistent"})
+	res := s.cmdTTL([]string{"nonexistent"})
 	if string(res) != string(constant.TtlKeyNotExist) {
 		t.Errorf("expected key not exist response for nonexistent key, got %s", res)
 	}
 
 	// Test key with no expiry
 	d.Set("foo", d.NewObj("foo", "bar", -1))
-	res = cmdTTL([]string{"foo"})
+	res = s.cmdTTL([]string{"foo"})
 	if string(res) != string(constant.TtlKeyExistNoExpire) {
 		t.Errorf("expected no expire response for key without TTL, got %s", res)
 	}
 
 	// Test key with expiry
 	d.Set("temp", d.NewObj("temp", "value", 5000)) // 5 seconds
-	res = cmdTTL([]string{"temp"})
+	res = s.cmdTTL([]string{"temp"})
 	// Convert response to number for approximate comparison
 	var ttl int64
 	err := DecodeInt64(res, &ttl)
@@ -165,13 +258,13 @@ func TestCmdTTL(t *testing.T) {
 	// Test expired key
 	d.Set("expired", d.NewObj("expired", "value", -1))
 	d.SetExpiry("expired", -1000) // Set to past
-	res = cmdTTL([]string{"expired"})
+	res = s.cmdTTL([]string{"expired"})
 	if string(res) != string(constant.TtlKeyNotExist) {
 		t.Errorf("expected key not exist response for expired key, got %s", res)
 	}
 
 	// Test wrong number of arguments
-	res = cmdTTL([]string{})
+	res = s.cmdTTL([]string{})
 	if string(res) != string(Encode(errors.New("(error) ERR wrong number of arguments for 'TTL' command"), false)) {
 		t.Errorf("expected error for no arguments, got %s", res)
 	}
@@ -192,8 +285,8 @@ func (w *mockWriter) Write(p []byte) (n int, err error) {
 }
 
 func TestExecuteAndResponse(t *testing.T) {
-	d := setupDictStore()
-	dictStore = d
+	s := setupStorage()
+	d := s.dictStore
 
 	testCases := []struct {
 		name          string
@@ -233,7 +326,7 @@ func TestExecuteAndResponse(t *testing.T) {
 				if string(written) != string(constant.RespOk) {
 					t.Errorf("expected OK response, got %s", written)
 				}
-				obj := dictStore.Get("key")
+				obj := s.dictStore.Get("key")
 				if obj == nil || obj.Value != "value" {
 					t.Error("SET command failed to store value")
 				}
@@ -296,150 +389,139 @@ func TestExecuteAndResponse(t *testing.T) {
 			}
 
 			writer := &mockWriter{err: tc.writerErr}
-			err := executeAndResponseWithWriter(tc.cmd, writer)
+			err := executeAndResponseWithWriter(s, tc.cmd, writer)
 			tc.verify(err, writer.written)
 		})
 	}
 }
 
-// executeAndResponseWithWriter is a test helper that uses an io.Writer instead of a file descriptor
-func executeAndResponseWithWriter(cmd *Command, writer io.Writer) error {
-	var res []byte
-
-	switch cmd.Cmd {
-	case "PING":
-		res = cmdPING(cmd.Args)
-	case "SET":
-		res = cmdSET(cmd.Args)
-	case "GET":
-		res = cmdGET(cmd.Args)
-	case "TTL":
-		res = cmdTTL(cmd.Args)
-	case "DEL":
-		res = cmdDEL(cmd.Args)
-	case "EXPIRE":
-		res = cmdEXPIRE(cmd.Args)
-	case "EXISTS":
-		res = cmdEXISTS(cmd.Args)
-	case "CMS.INITBYDIM":
-		res = cmdCMSINITBYDIM(cmd.Args)
-	case "CMS.INITBYPROB":
-		res = cmdCMSINITBYPROB(cmd.Args)
-	case "CMS.INCRBY":
-		res = cmdCMSINCRBY(cmd.Args)
-	case "CMS.QUERY":
-		res = cmdCMSQUERY(cmd.Args)
-	case "BF.RESERVE":
-		res = cmdBFRESERVE(cmd.Args)
-	case "BF.MADD":
-		res = cmdBFMADD(cmd.Args)
-	case "BF.EXISTS":
-		res = cmdBFEXISTS(cmd.Args)
-	default:
-		res = []byte("-CMD NOT FOUND\r\n")
+func TestExecuteAndResponse_pipelined(t *testing.T) {
+	s := setupStorage()
+	data := []byte("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n" +
+		"*1\r\n$4\r\nPING\r\n" +
+		"*2\r\n$3\r\nGET")
+
+	var replies bytes.Buffer
+	executed := 0
+	for {
+		value, n, err := DecodeOne(data)
+		if err == ErrIncompleteFrame {
+			break
+		}
+		assert.NoError(t, err)
+		data = data[n:]
+		cmd, err := NewCommand(value)
+		assert.NoError(t, err)
+		assert.NoError(t, s.ExecuteAndResponse(cmd, &replies))
+		executed++
 	}
-	_, err := writer.Write(res)
-	return err
+
+	assert.Equal(t, 3, executed)
+	assert.Equal(t, "+OK\r\n$1\r\n1\r\n+PONG\r\n", replies.String())
+	assert.Equal(t, "*2\r\n$3\r\nGET", string(data))
+}
+
+// executeAndResponseWithWriter is a test helper that collects the reply in an io.Writer
+func executeAndResponseWithWriter(s *Storage, cmd *Command, writer io.Writer) error {
+	return s.ExecuteAndResponse(cmd, writer)
 }
 
 func TestCmdCMSINITBYDIM(t *testing.T) {
-	// Clear the store before each test
-	cmsStore = make(map[string]*data_structure.CMS)
+	s := setupStorage()
 
 	// Test case 1: Valid arguments
-	res := cmdCMSINITBYDIM([]string{"mycms", "100", "5"})
+	res := s.cmdCMSINITBYDIM([]string{"mycms", "100", "5"})
 	assert.Equal(t, string(constant.RespOk), string(res))
-	assert.NotNil(t, cmsStore["mycms"])
+	assert.NotNil(t, s.dictStore.Get("mycms"))
 
 	// Test case 2: Key already exists
-	res = cmdCMSINITBYDIM([]string{"mycms", "200", "10"})
+	res = s.cmdCMSINITBYDIM([]string{"mycms", "200", "10"})
 	assert.Equal(t, string(Encode(errors.New("CMS: key already exists"), false)), string(res))
 
 	// Test case 3: Wrong number of arguments
-	res = cmdCMSINITBYDIM([]string{"mycms", "100"})
+	res = s.cmdCMSINITBYDIM([]string{"mycms", "100"})
 	assert.Equal(t, string(Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.INITBYDIM' command"), false)), string(res))
 
 	// Test case 4: Invalid width
-	res = cmdCMSINITBYDIM([]string{"mycms2", "abc", "5"})
+	res = s.cmdCMSINITBYDIM([]string{"mycms2", "abc", "5"})
 	assert.Contains(t, string(res), "width must be a integer number")
 
 	// Test case 5: Invalid height
-	res = cmdCMSINITBYDIM([]string{"mycms3", "100", "xyz"})
+	res = s.cmdCMSINITBYDIM([]string{"mycms3", "100", "xyz"})
 	assert.Contains(t, string(res), "height must be a integer number")
 }
 
 func TestCmdCMSINITBYPROB(t *testing.T) {
-	// Clear the store before each test
-	cmsStore = make(map[string]*data_structure.CMS)
+	s := setupStorage()
 
 	// Test case 1: Valid arguments
-	res := cmdCMSINITBYPROB([]string{"mycms", "0.01", "0.001"})
+	res := s.cmdCMSINITBYPROB([]string{"mycms", "0.01", "0.001"})
 	assert.Equal(t, string(constant.RespOk), string(res))
-	assert.NotNil(t, cmsStore["mycms"])
+	assert.NotNil(t, s.dictStore.Get("mycms"))
 
 	// Test case 2: Key already exists
-	res = cmdCMSINITBYPROB([]string{"mycms", "0.01", "0.001"})
+	res = s.cmdCMSINITBYPROB([]string{"mycms", "0.01", "0.001"})
 	assert.Equal(t, string(Encode(errors.New("CMS: key already exists"), false)), string(res))
 
 	// Test case 3: Wrong number of arguments
-	res = cmdCMSINITBYPROB([]string{"mycms", "0.01"})
+	res = s.cmdCMSINITBYPROB([]string{"mycms", "0.01"})
 	assert.Equal(t, string(Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.INITBYPROB' command"), false)), string(res))
 
 	// Test case 4: Invalid error rate (not float)
-	res = cmdCMSINITBYPROB([]string{"mycms2", "abc", "0.001"})
+	res = s.cmdCMSINITBYPROB([]string{"mycms2", "abc", "0.001"})
 	assert.Contains(t, string(res), "errRate must be a floating point number")
 
 	// Test case 5: Invalid error rate (out of range)
-	res = cmdCMSINITBYPROB([]string{"mycms3", "1.5", "0.001"})
+	res = s.cmdCMSINITBYPROB([]string{"mycms3", "1.5", "0.001"})
 	assert.Contains(t, string(res), "invalid overestimation value")
 
 	// Test case 6: Invalid probability (not float)
-	res = cmdCMSINITBYPROB([]string{"mycms4", "0.01", "xyz"})
+	res = s.cmdCMSINITBYPROB([]string{"mycms4", "0.01", "xyz"})
 	assert.Contains(t, string(res), "probability must be a floating poit number")
 
 	// Test case 7: Invalid probability (out of range)
-	res = cmdCMSINITBYPROB([]string{"mycms5", "0.01", "1.5"})
+	res = s.cmdCMSINITBYPROB([]string{"mycms5", "0.01", "1.5"})
 	assert.Contains(t, string(res), "invalid prob value")
 }
 
 func TestCmdCMSINCRBYAndCMSQUERY(t *testing.T) {
-	// Clear the store before each test
-	cmsStore = make(map[string]*data_structure.CMS)
+	s := setupStorage()
 
 	// Initialize a CMS filter
-	cmdCMSINITBYDIM([]string{"mycms", "100", "5"})
+	s.cmdCMSINITBYDIM([]string{"mycms", "100", "5"})
 
 	// Test IncrBy valid operations
-	res := cmdCMSINCRBY([]string{"mycms", "item1", "5", "item2", "10"})
+	res := s.cmdCMSINCRBY([]string{"mycms", "item1", "5", "item2", "10"})
 	assert.Contains(t, string(res), "5")  // Check for item1 count
 	assert.Contains(t, string(res), "10") // Check for item2 count
 
 	// Test Query valid operations
-	res = cmdCMSQUERY([]string{"mycms", "item1", "item2", "item3"})
+	res = s.cmdCMSQUERY([]string{"mycms", "item1", "item2", "item3"})
 	assert.Contains(t, string(res), "5")  // item1 count
 	assert.Contains(t, string(res), "10") // item2 count
 	assert.Contains(t, string(res), "0")  // item3 (non-existent) count
 
 	// Test IncrBy: key does not exist
-	res = cmdCMSINCRBY([]string{"nonexistent", "item1", "5"})
+	res = s.cmdCMSINCRBY([]string{"nonexistent", "item1", "5"})
 	assert.Equal(t, string(Encode(errors.New("CMS: key does not exist"), false)), string(res))
 
 	// Test Query: key does not exist
-	res = cmdCMSQUERY([]string{"nonexistent", "item1"})
+	res = s.cmdCMSQUERY([]string{"nonexistent", "item1"})
 	assert.Equal(t, string(Encode(errors.New("CMS: key does not exist"), false)), string(res))
 
 	// Test IncrBy: wrong number of arguments
-	res = cmdCMSINCRBY([]string{"mycms", "item1"})
+	res = s.cmdCMSINCRBY([]string{"mycms", "item1"})
 	assert.Equal(t, string(Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.INCBY' command"), false)), string(res))
-	res = cmdCMSINCRBY([]string{"mycms", "item1", "5", "item2"})
+	res = s.cmdCMSINCRBY([]string{"mycms", "item1", "5", "item2"})
 	assert.Equal(t, string(Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.INCBY' command"), false)), string(res))
 
 	// Test IncrBy: invalid increment value
-	res = cmdCMSINCRBY([]string{"mycms", "item1", "abc"})
+	res = s.cmdCMSINCRBY([]string{"mycms", "item1", "abc"})
 	assert.Contains(t, string(res), "increment must be a non negative integer number")
 
 	// Test Query: wrong number of arguments
-	res = cmdCMSQUERY([]string{"mycms"})
+	res = s.cmdCMSQUERY([]string{"mycms"})
 	assert.Equal(t, string(Encode(errors.New("(error) ERR wrong number of arguments for 'CMS.QUERY' command"), false)), string(res))
 
 	// Test IncrBy overflow (This test case requires a large increment and might be slow or difficult to reliably simulate without a mock CMS)
@@ -449,74 +531,72 @@ func TestCmdCMSINCRBYAndCMSQUERY(t *testing.T) {
 
 	// Example for a large increment that might cause overflow if not handled (conceptual)
 	// cmsStore["mycms"].IncrBy("large_item", math.MaxUint32 - 1)
-	// res = cmdCMSINCRBY([]string{"mycms", "large_item", "2"})
+	// res = s.cmdCMSINCRBY([]string{"mycms", "large_item", "2"})
 	// assert.Contains(t, string(res), "CMS: INCRBY overflow")
 }
 
 func TestCmdBFRESERVE(t *testing.T) {
-	// Clear the store before each test
-	bloomStore = make(map[string]*data_structure.Bloom)
+	s := setupStorage()
 
 	// Test case 1: Valid arguments
-	res := cmdBFRESERVE([]string{"mybf", "0.01", "100"})
+	res := s.cmdBFRESERVE([]string{"mybf", "0.01", "100"})
 	assert.Equal(t, string(constant.RespOk), string(res))
-	assert.NotNil(t, bloomStore["mybf"])
+	assert.NotNil(t, s.dictStore.Get("mybf"))
 
 	// Test case 2: Key already exists
-	res = cmdBFRESERVE([]string{"mybf", "0.01", "100"})
+	res = s.cmdBFRESERVE([]string{"mybf", "0.01", "100"})
 	assert.Contains(t, string(res), "Bloom filter with key 'mybf' already exist")
 
 	// Test case 3: Wrong number of arguments (too few)
-	res = cmdBFRESERVE([]string{"mybf2", "0.01"})
+	res = s.cmdBFRESERVE([]string{"mybf2", "0.01"})
 	assert.Contains(t, string(res), "ERR wrong number of arguments for 'BF.RESERVE' command")
 
 	// Test case 4: Valid number of arguments (with unimplemented options)
-	res = cmdBFRESERVE([]string{"mybf3", "0.01", "100", "NONEXIST", "1"})
+	res = s.cmdBFRESERVE([]string{"mybf3", "0.01", "100", "NONEXIST", "1"})
 	assert.Equal(t, string(constant.RespOk), string(res))
 
 	// Test case 5: Invalid error rate
-	res = cmdBFRESERVE([]string{"mybf4", "abc", "100"})
+	res = s.cmdBFRESERVE([]string{"mybf4", "abc", "100"})
 	assert.Contains(t, string(res), "error rate must be a floating point number")
 
 	// Test case 6: Invalid capacity
-	res = cmdBFRESERVE([]string{"mybf5", "0.01", "xyz"})
+	res = s.cmdBFRESERVE([]string{"mybf5", "0.01", "xyz"})
 	assert.Contains(t, string(res), "capacity must be an integer number")
 }
 
 func TestCmdBFMADDAndBFEXISTS(t *testing.T) {
-	// Clear the store before each test
-	bloomStore = make(map[string]*data_structure.Bloom)
+	s := setupStorage()
 
 	// Test case 1: MADD to a non-existent bloom filter (should auto-create)
-	res := cmdBFMADD([]string{"mybf", "item1", "item2"})
+	res := s.cmdBFMADD([]string{"mybf", "item1", "item2"})
 	assert.Contains(t, string(res), "1")
-	assert.NotNil(t, bloomStore["mybf"])
+	assert.NotNil(t, s.dictStore.Get("mybf"))
 
 	// Verify existence
-	res = cmdBFEXISTS([]string{"mybf", "item1"})
+	res = s.cmdBFEXISTS([]string{"mybf", "item1"})
 	assert.Equal(t, string(constant.RespOne), string(res))
-	res = cmdBFEXISTS([]string{"mybf", "item2"})
+	res = s.cmdBFEXISTS([]string{"mybf", "item2"})
 	assert.Equal(t, string(constant.RespOne), string(res))
-	res = cmdBFEXISTS([]string{"mybf", "nonexistent"})
+	res = s.cmdBFEXISTS([]string{"mybf", "nonexistent"})
 	assert.Equal(t, string(constant.RespZero), string(res))
 
 	// Test case 2: MADD to an existing bloom filter
-	res = cmdBFMADD([]string{"mybf", "item3"})
+	res = s.cmdBFMADD([]string{"mybf", "item3"})
 	assert.Contains(t, string(res), "1")
 
 	// Verify existence of newly added item
-	res = cmdBFEXISTS([]string{"mybf", "item3"})
+	res = s.cmdBFEXISTS([]string{"mybf", "item3"})
 	assert.Equal(t, string(constant.RespOne), string(res))
 
 	// Test case 3: BF.EXISTS on a non-existent bloom filter
-	res = cmdBFEXISTS([]string{"nonexistentbf", "item"})
+	res = s.cmdBFEXISTS([]string{"nonexistentbf", "item"})
 	assert.Equal(t, string(constant.RespZero), string(res))
 
 	// Test case 4: BF.MADD wrong number of arguments
-	res = cmdBFMADD([]string{"mybf"})
+	res = s.cmdBFMADD([]string{"mybf"})
 	assert.Contains(t, string(res), "ERR wrong number of arguments for 'BF.MADD' command")
 
 	// Test case 5: BF.EXISTS wrong number of arguments
-	res = cmdBFEXISTS([]string{"mybf"})
+	res = s.cmdBFEXISTS([]string{"mybf"})
 	assert.Contains(t, string(res), "ERR wrong number of arguments for 'BF.EXISTS' command")
 }
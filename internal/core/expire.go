@@ -2,24 +2,65 @@ package core
 
 import (
 	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
 	"time"
 )
 
-func ActiveDeleteExpiredKeys() {
+// ActiveDeleteExpiredKeys reclaims keys of any type that expired but were
+// never accessed again. Like Redis it samples the keys having an expiry and
+// keeps going while a large share of the sample turned out to be expired.
+func (s *Storage) ActiveDeleteExpiredKeys() {
 	for {
 		var expiredCount = 0
 		var sampleCountRemain = constant.ActiveExpireSampleSize
-		for key, expiredTime := range dictStore.GetExpireDictStore() {
+		for key, expiredTime := range s.dictStore.GetExpireDictStore() {
 			sampleCountRemain--
 			if sampleCountRemain < 0 {
 				break
 			}
 			if time.Now().UnixMilli() > int64(expiredTime) {
-				dictStore.Del(key)
+				s.dictStore.Del(key)
 				expiredCount++
 			}
 		}
 
+		if float64(expiredCount)/float64(constant.ActiveExpireSampleSize) <= constant.ActiveExpireThreshold {
+			break
+		}
+	}
+	s.activeDeleteExpiredHashFields()
+}
+
+// activeDeleteExpiredHashFields does the same for the fields of hashes: it
+// samples the hashes having fields with a TTL, reclaims their expired fields
+// and keeps going while a large share of the sample had some.
+func (s *Storage) activeDeleteExpiredHashFields() {
+	for {
+		var expiredCount = 0
+		var sampleCountRemain = constant.ActiveExpireSampleSize
+		now := uint64(time.Now().UnixMilli())
+		for key := range s.hashFieldExpiries {
+			sampleCountRemain--
+			if sampleCountRemain < 0 {
+				break
+			}
+			// Not lookupHash, which would reclaim the fields unnoticed.
+			hash, err := lookupValue[*data_structure.Hash](s, key, data_structure.ObjTypeHash)
+			if err != nil || hash == nil || !hash.HasExpiries() {
+				delete(s.hashFieldExpiries, key)
+				continue
+			}
+			if hash.DeleteExpired(now) > 0 {
+				expiredCount++
+				if hash.Len() == 0 {
+					s.dictStore.Del(key)
+				}
+				if !hash.HasExpiries() {
+					delete(s.hashFieldExpiries, key)
+				}
+			}
+		}
+
 		if float64(expiredCount)/float64(constant.ActiveExpireSampleSize) <= constant.ActiveExpireThreshold {
 			break
 		}
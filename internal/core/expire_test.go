@@ -0,0 +1,179 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// expireNow makes key expire as if its deadline had just passed.
+func expireNow(s *Storage, key string) {
+	s.dictStore.SetExpiryAt(key, uint64(time.Now().UnixMilli()-1))
+}
+
+func TestExpire_lazyOnEveryType(t *testing.T) {
+	testCases := []struct {
+		name  string
+		key   string
+		check func(s *Storage) []byte
+		want  string
+	}{
+		{"SMEMBERS", "set", func(s *Storage) []byte { return s.cmdSMEMBERS([]string{"set"}) }, "*0\r\n"},
+		{"SISMEMBER", "set", func(s *Storage) []byte { return s.cmdSISMEMBER([]string{"set", "a"}) }, ":0\r\n"},
+		{"SREM", "set", func(s *Storage) []byte { return s.cmdSREM([]string{"set", "a"}) }, ":0\r\n"},
+		{"ZSCORE", "zset", func(s *Storage) []byte { return s.cmdZSCORE([]string{"zset", "one"}) }, "$-1\r\n"},
+		{"ZRANK", "zset", func(s *Storage) []byte { return s.cmdZRANK([]string{"zset", "one"}) }, "$-1\r\n"},
+		{"CMS.QUERY", "cms", func(s *Storage) []byte { return s.cmdCMSQUERY([]string{"cms", "x"}) }, "-CMS: key does not exist\r\n"},
+		{"CMS.INCRBY", "cms", func(s *Storage) []byte { return s.cmdCMSINCRBY([]string{"cms", "x", "1"}) }, "-CMS: key does not exist\r\n"},
+		{"BF.EXISTS", "bf", func(s *Storage) []byte { return s.cmdBFEXISTS([]string{"bf", "item"}) }, ":0\r\n"},
+		{"TYPE", "bf", func(s *Storage) []byte { return s.cmdTYPE([]string{"bf"}) }, "+none\r\n"},
+		{"TTL", "zset", func(s *Storage) []byte { return s.cmdTTL([]string{"zset"}) }, ":-2\r\n"},
+		{"EXISTS", "cms", func(s *Storage) []byte { return s.cmdEXISTS([]string{"cms"}) }, ":0\r\n"},
+		{"DEL", "set", func(s *Storage) []byte { return s.cmdDEL([]string{"set"}) }, ":0\r\n"},
+		{"EXPIRE", "set", func(s *Storage) []byte { return s.cmdEXPIRE([]string{"set", "10"}) }, ":0\r\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := setupStorage()
+			populateStorage(s)
+			expireNow(s, tc.key)
+			assert.Equal(t, tc.want, string(tc.check(s)))
+			assert.NotContains(t, s.dictStore.GetExpireDictStore(), tc.key)
+		})
+	}
+}
+
+func TestExpire_writeToExpiredKeyStartsOver(t *testing.T) {
+	s := setupStorage()
+	s.cmdSADD([]string{"window", "a", "b"})
+	s.cmdEXPIRE([]string{"window", "60"})
+	expireNow(s, "window")
+
+	assert.Equal(t, ":1\r\n", string(s.cmdSADD([]string{"window", "c"})))
+	assert.Equal(t, "*1\r\n$1\r\nc\r\n", string(s.cmdSMEMBERS([]string{"window"})))
+	assert.Equal(t, ":-1\r\n", string(s.cmdTTL([]string{"window"})))
+
+	s.cmdBFRESERVE([]string{"daily", "0.01", "100"})
+	s.cmdBFMADD([]string{"daily", "bot"})
+	s.cmdEXPIRE([]string{"daily", "60"})
+	expireNow(s, "daily")
+	assert.Equal(t, "+OK\r\n", string(s.cmdBFRESERVE([]string{"daily", "0.01", "100"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdBFEXISTS([]string{"daily", "bot"})))
+}
+
+func TestActiveDeleteExpiredKeys_everyType(t *testing.T) {
+	s := setupStorage()
+	populateStorage(s)
+	for _, key := range []string{"str", "set", "zset", "cms", "bf"} {
+		expireNow(s, key)
+	}
+
+	s.ActiveDeleteExpiredKeys()
+
+	store := s.dictStore.GetDictStore()
+	for _, key := range []string{"str", "set", "zset", "cms", "bf"} {
+		assert.NotContains(t, store, key)
+	}
+	// Keys that haven't expired yet stay.
+	assert.Contains(t, store, "ttl")
+	assert.Contains(t, s.dictStore.GetExpireDictStore(), "ttl")
+}
+
+func TestCmdEXPIRE_flags(t *testing.T) {
+	testCases := []struct {
+		name   string
+		ttl    string // existing TTL in seconds, "" for none
+		args   []string
+		want   string
+		newTTL int64
+	}{
+		{name: "NX without TTL", args: []string{"k", "50", "NX"}, want: ":1\r\n", newTTL: 50},
+		{name: "NX with TTL", ttl: "100", args: []string{"k", "50", "NX"}, want: ":0\r\n", newTTL: 100},
+		{name: "XX without TTL", args: []string{"k", "50", "XX"}, want: ":0\r\n", newTTL: -1},
+		{name: "XX with TTL", ttl: "100", args: []string{"k", "50", "XX"}, want: ":1\r\n", newTTL: 50},
+		{name: "GT without TTL", args: []string{"k", "50", "GT"}, want: ":0\r\n", newTTL: -1},
+		{name: "GT with a longer TTL", ttl: "100", args: []string{"k", "50", "GT"}, want: ":0\r\n", newTTL: 100},
+		{name: "GT with a shorter TTL", ttl: "10", args: []string{"k", "50", "gt"}, want: ":1\r\n", newTTL: 50},
+		{name: "LT without TTL", args: []string{"k", "50", "LT"}, want: ":1\r\n", newTTL: 50},
+		{name: "LT with a longer TTL", ttl: "100", args: []string{"k", "50", "LT"}, want: ":1\r\n", newTTL: 50},
+		{name: "LT with a shorter TTL", ttl: "10", args: []string{"k", "50", "LT"}, want: ":0\r\n", newTTL: 10},
+		{name: "XX GT", ttl: "10", args: []string{"k", "50", "XX", "GT"}, want: ":1\r\n", newTTL: 50},
+		{
+			name: "NX and GT", args: []string{"k", "50", "NX", "GT"},
+			want:   "-(error) ERR NX and XX, GT or LT options at the same time are not compatible\r\n",
+			newTTL: -1,
+		},
+		{
+			name: "GT and LT", args: []string{"k", "50", "GT", "LT"},
+			want:   "-(error) ERR GT and LT options at the same time are not compatible\r\n",
+			newTTL: -1,
+		},
+		{name: "unknown flag", args: []string{"k", "50", "SOON"}, want: "-(error) ERR Unsupported option SOON\r\n", newTTL: -1},
+		{name: "overflow", args: []string{"k", "9223372036854775807"}, want: "-(error) ERR invalid expire time in 'expire' command\r\n", newTTL: -1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := setupStorage()
+			s.cmdSET([]string{"k", "v"})
+			if tc.ttl != "" {
+				s.cmdEXPIRE([]string{"k", tc.ttl})
+			}
+			assert.Equal(t, tc.want, string(s.cmdEXPIRE(tc.args)))
+			var ttl int64
+			assert.NoError(t, DecodeInt64(s.cmdTTL([]string{"k"}), &ttl))
+			assert.Equal(t, tc.newTTL, ttl)
+		})
+	}
+}
+
+func TestCmdPEXPIREAndPTTL(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "v"})
+	assert.Equal(t, ":-1\r\n", string(s.cmdPTTL([]string{"k"})))
+	assert.Equal(t, ":-2\r\n", string(s.cmdPTTL([]string{"missing"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdPEXPIRE([]string{"k", "1500"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdPEXPIRE([]string{"missing", "1500"})))
+
+	var pttl int64
+	assert.NoError(t, DecodeInt64(s.cmdPTTL([]string{"k"}), &pttl))
+	assert.InDelta(t, 1500, pttl, 50)
+	var ttl int64
+	assert.NoError(t, DecodeInt64(s.cmdTTL([]string{"k"}), &ttl))
+	assert.Equal(t, int64(2), ttl, "TTL rounds to the nearest second")
+
+	assert.Equal(t, ":1\r\n", string(s.cmdPEXPIRE([]string{"k", "0"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdEXISTS([]string{"k"})))
+}
+
+func TestCmdEXPIREATAndEXPIRETIME(t *testing.T) {
+	s := setupStorage()
+	s.cmdSADD([]string{"set", "a"})
+	assert.Equal(t, ":-1\r\n", string(s.cmdEXPIRETIME([]string{"set"})))
+	assert.Equal(t, ":-2\r\n", string(s.cmdPEXPIRETIME([]string{"missing"})))
+
+	at := time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, ":1\r\n", string(s.cmdEXPIREAT([]string{"set", strconv.FormatInt(at, 10)})))
+	assert.Equal(t, string(Encode(at, false)), string(s.cmdEXPIRETIME([]string{"set"})))
+	assert.Equal(t, string(Encode(at*1000, false)), string(s.cmdPEXPIRETIME([]string{"set"})))
+
+	atMs := time.Now().Add(2 * time.Hour).UnixMilli()
+	assert.Equal(t, ":0\r\n", string(s.cmdPEXPIREAT([]string{"set", strconv.FormatInt(atMs, 10), "LT"})))
+	assert.Equal(t, ":1\r\n", string(s.cmdPEXPIREAT([]string{"set", strconv.FormatInt(atMs, 10), "GT"})))
+	assert.Equal(t, string(Encode(atMs, false)), string(s.cmdPEXPIRETIME([]string{"set"})))
+
+	// A time in the past deletes the key.
+	assert.Equal(t, ":1\r\n", string(s.cmdEXPIREAT([]string{"set", "1"})))
+	assert.Equal(t, "+none\r\n", string(s.cmdTYPE([]string{"set"})))
+}
+
+func TestCmdPERSIST(t *testing.T) {
+	s := setupStorage()
+	s.cmdSET([]string{"k", "v", "EX", "100"})
+	assert.Equal(t, ":1\r\n", string(s.cmdPERSIST([]string{"k"})))
+	assert.Equal(t, ":-1\r\n", string(s.cmdTTL([]string{"k"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdPERSIST([]string{"k"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdPERSIST([]string{"missing"})))
+	assert.Equal(t, "-(error) ERR wrong number of arguments for 'PERSIST' command\r\n", string(s.cmdPERSIST(nil)))
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/thaison199py/multi-threaded-redis/internal/config"
 	"log"
 	"syscall"
+	"time"
 )
 
 type Epoll struct {
@@ -34,8 +35,22 @@ func (ep *Epoll) Monitor(event Event) error {
 	return syscall.EpollCtl(ep.fd, syscall.EPOLL_CTL_ADD, event.Fd, &epollEvent)
 }
 
-func (ep *Epoll) Wait() ([]Event, error) {
-	n, err := syscall.EpollWait(ep.fd, ep.epollEvents, -1)
+func (ep *Epoll) Modify(event Event) error {
+	epollEvent := event.toNative()
+	return syscall.EpollCtl(ep.fd, syscall.EPOLL_CTL_MOD, event.Fd, &epollEvent)
+}
+
+func (ep *Epoll) Remove(fd int) error {
+	return syscall.EpollCtl(ep.fd, syscall.EPOLL_CTL_DEL, fd, nil)
+}
+
+func (ep *Epoll) Wait(timeout time.Duration) ([]Event, error) {
+	msec := -1
+	if timeout >= 0 {
+		// Round up so a timer due in under 1ms doesn't turn into a busy loop.
+		msec = int((timeout + time.Millisecond - 1) / time.Millisecond)
+	}
+	n, err := syscall.EpollWait(ep.fd, ep.epollEvents, msec)
 	if err != nil {
 		return nil, err
 	}
@@ -1,5 +1,7 @@
 package io_multiplexing
 
+import "time"
+
 const OpRead = 0
 const OpWrite = 1
 
@@ -11,7 +13,14 @@ type Event struct {
 }
 
 type IOMultiplexer interface {
+	// Monitor starts watching event.Fd for event.Op.
 	Monitor(event Event) error
-	Wait() ([]Event, error)
+	// Modify switches an already monitored fd to event.Op.
+	Modify(event Event) error
+	// Remove stops watching fd altogether.
+	Remove(fd int) error
+	// Wait blocks until some monitored fd is ready or timeout elapses. A
+	// negative timeout waits indefinitely.
+	Wait(timeout time.Duration) ([]Event, error)
 	Close() error
 }
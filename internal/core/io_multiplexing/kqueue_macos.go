@@ -6,6 +6,7 @@ import (
 	"github.com/thaison199py/multi-threaded-redis/internal/config"
 	"log"
 	"syscall"
+	"time"
 )
 
 type KQueue struct {
@@ -35,8 +36,41 @@ func (kq *KQueue) Monitor(event Event) error {
 	return err
 }
 
-func (kq *KQueue) Wait() ([]Event, error) {
-	n, err := syscall.Kevent(kq.fd, nil, kq.kqEvents, nil)
+func (kq *KQueue) Modify(event Event) error {
+	// kqueue keeps a separate filter per direction, so switching interest
+	// means dropping the other filter and adding the requested one.
+	other := Event{Fd: event.Fd, Op: OpRead}
+	if event.Op == OpRead {
+		other.Op = OpWrite
+	}
+	if err := kq.change(other.toNative(syscall.EV_DELETE)); err != nil && err != syscall.ENOENT {
+		return err
+	}
+	return kq.change(event.toNative(syscall.EV_ADD))
+}
+
+func (kq *KQueue) Remove(fd int) error {
+	for _, op := range []Operation{OpRead, OpWrite} {
+		err := kq.change(Event{Fd: fd, Op: op}.toNative(syscall.EV_DELETE))
+		if err != nil && err != syscall.ENOENT {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kq *KQueue) change(kqEvent syscall.Kevent_t) error {
+	_, err := syscall.Kevent(kq.fd, []syscall.Kevent_t{kqEvent}, nil, nil)
+	return err
+}
+
+func (kq *KQueue) Wait(timeout time.Duration) ([]Event, error) {
+	var ts *syscall.Timespec
+	if timeout >= 0 {
+		t := syscall.NsecToTimespec(int64(timeout))
+		ts = &t
+	}
+	n, err := syscall.Kevent(kq.fd, nil, kq.kqEvents, ts)
 	if err != nil {
 		return nil, err
 	}
@@ -17,7 +17,7 @@ func (e Event) toNative() syscall.EpollEvent {
 
 func createEvent(ep syscall.EpollEvent) Event {
 	var op Operation = OpRead
-	if ep.Events == syscall.EPOLLOUT {
+	if ep.Events&syscall.EPOLLOUT != 0 {
 		op = OpWrite
 	}
 	return Event{
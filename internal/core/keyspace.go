@@ -0,0 +1,131 @@
+package core
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// lookupValue returns the value of key if it holds an object of type t. A
+// missing or expired key gives the zero value and no error, a key of another
+// type gives errWrongType.
+func lookupValue[T any](s *Storage, key string, t data_structure.ObjType) (T, error) {
+	var zero T
+	obj := s.dictStore.Get(key)
+	if obj == nil {
+		return zero, nil
+	}
+	if obj.Type != t {
+		return zero, errWrongType
+	}
+	return obj.Value.(T), nil
+}
+
+func (s *Storage) lookupString(key string) (string, bool, error) {
+	obj := s.dictStore.Get(key)
+	if obj == nil {
+		return "", false, nil
+	}
+	if obj.Type != data_structure.ObjTypeString {
+		return "", false, errWrongType
+	}
+	return stringOf(obj), true, nil
+}
+
+// stringOf returns the value of a string object whatever its encoding.
+func stringOf(obj *data_structure.Obj) string {
+	switch obj.Encoding {
+	case data_structure.ObjEncodingInt:
+		return strconv.FormatInt(obj.Value.(int64), 10)
+	case data_structure.ObjEncodingBytes:
+		return string(obj.Value.([]byte))
+	}
+	return obj.Value.(string)
+}
+
+// parseCanonicalInt parses v only if it is exactly how the integer would be
+// printed, so that storing it as an int64 gives back the same string.
+func parseCanonicalInt(v string) (int64, bool) {
+	if len(v) == 0 || len(v) > 20 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != v {
+		return 0, false
+	}
+	return n, true
+}
+
+// stringValue picks the value stored for a string: an int64 when it holds
+// an integer, the string itself otherwise.
+func stringValue(v string) interface{} {
+	if n, ok := parseCanonicalInt(v); ok {
+		return n
+	}
+	return v
+}
+
+func (s *Storage) lookupList(key string) (*data_structure.Quicklist, error) {
+	return lookupValue[*data_structure.Quicklist](s, key, data_structure.ObjTypeList)
+}
+
+// lookupHash returns the hash at key once its expired fields are gone. A hash
+// left without fields is deleted, as if the key had expired.
+func (s *Storage) lookupHash(key string) (*data_structure.Hash, error) {
+	hash, err := lookupValue[*data_structure.Hash](s, key, data_structure.ObjTypeHash)
+	if hash != nil && hash.DeleteExpired(uint64(time.Now().UnixMilli())) > 0 && hash.Len() == 0 {
+		s.dictStore.Del(key)
+		return nil, nil
+	}
+	return hash, err
+}
+
+func (s *Storage) lookupSet(key string) (*data_structure.SimpleSet, error) {
+	return lookupValue[*data_structure.SimpleSet](s, key, data_structure.ObjTypeSet)
+}
+
+func (s *Storage) lookupZSet(key string) (*data_structure.SortedSet, error) {
+	return lookupValue[*data_structure.SortedSet](s, key, data_structure.ObjTypeZSet)
+}
+
+func (s *Storage) lookupCMS(key string) (*data_structure.CMS, error) {
+	return lookupValue[*data_structure.CMS](s, key, data_structure.ObjTypeCMS)
+}
+
+func (s *Storage) lookupBloom(key string) (*data_structure.Bloom, error) {
+	return lookupValue[*data_structure.Bloom](s, key, data_structure.ObjTypeBloom)
+}
+
+// setValue stores value at key, replacing whatever the key held before. The
+// key keeps its TTL, if it had one.
+func (s *Storage) setValue(key string, value interface{}) {
+	s.dictStore.Set(key, s.dictStore.NewObj(key, value, -1))
+	switch v := value.(type) {
+	case *data_structure.Hash:
+		if v.HasExpiries() {
+			s.hashFieldExpiries[key] = struct{}{}
+		}
+	case *data_structure.Quicklist:
+		s.signalKeyAsReady(key)
+	}
+}
+
+// keyExists reports whether key holds a live value of any type.
+func (s *Storage) keyExists(key string) bool {
+	return s.dictStore.Get(key) != nil
+}
+
+func (s *Storage) cmdTYPE(args []string) []byte {
+	if len(args) != 1 {
+		return Encode(errors.New("(error) ERR wrong number of arguments for 'TYPE' command"), false)
+	}
+	obj := s.dictStore.Get(args[0])
+	if obj == nil {
+		return Encode("none", true)
+	}
+	return Encode(obj.Type.String(), true)
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const wrongType = "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+
+func TestCmdTYPE(t *testing.T) {
+	s := setupStorage()
+	populateStorage(s)
+	for key, want := range map[string]string{
+		"str":     "string",
+		"set":     "set",
+		"zset":    "zset",
+		"cms":     "CMSk-TYPE",
+		"bf":      "MBbloom--",
+		"missing": "none",
+	} {
+		assert.Equal(t, "+"+want+"\r\n", string(s.cmdTYPE([]string{key})), key)
+	}
+}
+
+func TestKeyspace_wrongType(t *testing.T) {
+	s := setupStorage()
+	populateStorage(s)
+
+	testCases := []struct {
+		name string
+		res  []byte
+	}{
+		{"GET on a set", s.cmdGET([]string{"set"})},
+		{"SADD on a string", s.cmdSADD([]string{"str", "a"})},
+		{"SADD on a zset", s.cmdSADD([]string{"zset", "a"})},
+		{"SREM on a string", s.cmdSREM([]string{"str", "a"})},
+		{"SMEMBERS on a zset", s.cmdSMEMBERS([]string{"zset"})},
+		{"SISMEMBER on a bloom filter", s.cmdSISMEMBER([]string{"bf", "a"})},
+		{"ZADD on a set", s.cmdZADD([]string{"set", "1", "a"})},
+		{"ZSCORE on a string", s.cmdZSCORE([]string{"str", "a"})},
+		{"ZRANK on a cms", s.cmdZRANK([]string{"cms", "a"})},
+		{"CMS.INITBYDIM on a set", s.cmdCMSINITBYDIM([]string{"set", "10", "5"})},
+		{"CMS.INITBYPROB on a string", s.cmdCMSINITBYPROB([]string{"str", "0.01", "0.01"})},
+		{"CMS.INCRBY on a bloom filter", s.cmdCMSINCRBY([]string{"bf", "a", "1"})},
+		{"CMS.QUERY on a zset", s.cmdCMSQUERY([]string{"zset", "a"})},
+		{"BF.RESERVE on a cms", s.cmdBFRESERVE([]string{"cms", "0.01", "100"})},
+		{"BF.MADD on a string", s.cmdBFMADD([]string{"str", "a"})},
+		{"BF.EXISTS on a set", s.cmdBFEXISTS([]string{"set", "a"})},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, wrongType, string(tc.res))
+		})
+	}
+	// Nothing was overwritten.
+	assert.Equal(t, "+set\r\n", string(s.cmdTYPE([]string{"set"})))
+	assert.Equal(t, "+string\r\n", string(s.cmdTYPE([]string{"str"})))
+}
+
+func TestKeyspace_SETOverwritesAnyType(t *testing.T) {
+	s := setupStorage()
+	s.cmdSADD([]string{"k", "a"})
+	assert.Equal(t, "+OK\r\n", string(s.cmdSET([]string{"k", "v"})))
+	assert.Equal(t, "+string\r\n", string(s.cmdTYPE([]string{"k"})))
+}
+
+func TestKeyspace_genericCommandsOnEveryType(t *testing.T) {
+	s := setupStorage()
+	populateStorage(s)
+	keys := []string{"str", "ttl", "set", "zset", "cms", "bf"}
+
+	assert.Equal(t, ":6\r\n", string(s.cmdEXISTS(append(keys, "missing"))))
+	for _, key := range keys {
+		assert.Equal(t, ":1\r\n", string(s.cmdEXPIRE([]string{key, "100"})), key)
+		var ttl int64
+		assert.NoError(t, DecodeInt64(s.cmdTTL([]string{key}), &ttl))
+		assert.InDelta(t, 100, ttl, 1, key)
+	}
+	assert.Equal(t, ":0\r\n", string(s.cmdEXPIRE([]string{"missing", "100"})))
+	assert.Equal(t, ":6\r\n", string(s.cmdDEL(append(keys, "missing"))))
+	assert.Equal(t, ":0\r\n", string(s.cmdEXISTS(keys)))
+	assert.Empty(t, s.dictStore.GetExpireDictStore())
+}
+
+func TestCmdSREM_deletesEmptySet(t *testing.T) {
+	s := setupStorage()
+	s.cmdSADD([]string{"set", "a", "b"})
+	assert.Equal(t, ":0\r\n", string(s.cmdSREM([]string{"missing", "a"})))
+	assert.Equal(t, "+none\r\n", string(s.cmdTYPE([]string{"missing"})))
+	assert.Equal(t, ":2\r\n", string(s.cmdSREM([]string{"set", "a", "b", "c"})))
+	assert.Equal(t, ":0\r\n", string(s.cmdEXISTS([]string{"set"})))
+}
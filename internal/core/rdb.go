@@ -0,0 +1,437 @@
+package core
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
+
+// Snapshot file layout:
+//
+//	"MTREDIS" <4 byte version>
+//	entries...
+//	0xFF <crc64 of everything before it, little endian>
+//
+// Each entry is an optional 0xFC <expiry in unix ms, 8 bytes> followed by a
+// type byte, the key and the type specific value. Strings are written as a
+// uvarint length and the raw bytes.
+const (
+	rdbMagic   = "MTREDIS"
+	rdbVersion = "0001"
+
+	rdbTypeString byte = 0
+	rdbTypeList   byte = 1
+	rdbTypeSet    byte = 2
+	rdbTypeZSet   byte = 3
+	rdbTypeHash   byte = 4
+	rdbTypeCMS    byte = 10
+	rdbTypeBloom  byte = 11
+
+	rdbOpExpireMs byte = 0xFC
+	rdbOpEOF      byte = 0xFF
+)
+
+var rdbCrcTable = crc64.MakeTable(crc64.ECMA)
+
+var errRdbChecksum = errors.New("rdb: checksum mismatch")
+var errRdbFormat = errors.New("rdb: bad file format")
+
+type rdbWriter struct {
+	buf *bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *rdbWriter) writeByte(b byte) {
+	w.buf.WriteByte(b)
+}
+
+func (w *rdbWriter) writeUvarint(v uint64) {
+	n := binary.PutUvarint(w.tmp[:], v)
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *rdbWriter) writeUint64(v uint64) {
+	binary.LittleEndian.PutUint64(w.tmp[:8], v)
+	w.buf.Write(w.tmp[:8])
+}
+
+func (w *rdbWriter) writeFloat(f float64) {
+	w.writeUint64(math.Float64bits(f))
+}
+
+func (w *rdbWriter) writeString(s string) {
+	w.writeUvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *rdbWriter) writeBytes(b []byte) {
+	w.writeUvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+type rdbReader struct {
+	r *bytes.Reader
+}
+
+func (r *rdbReader) readByte() (byte, error) {
+	return r.r.ReadByte()
+}
+
+func (r *rdbReader) readUvarint() (uint64, error) {
+	return binary.ReadUvarint(r.r)
+}
+
+func (r *rdbReader) readUint64() (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r.r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+func (r *rdbReader) readFloat() (float64, error) {
+	v, err := r.readUint64()
+	return math.Float64frombits(v), err
+}
+
+func (r *rdbReader) readBytes() ([]byte, error) {
+	n, err := r.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.r.Len()) {
+		return nil, errRdbFormat
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r.r, b)
+	return b, err
+}
+
+func (r *rdbReader) readString() (string, error) {
+	b, err := r.readBytes()
+	return string(b), err
+}
+
+func (w *rdbWriter) writeSet(set *data_structure.SimpleSet) {
+	members := set.Members()
+	w.writeUvarint(uint64(len(members)))
+	for _, m := range members {
+		w.writeString(m)
+	}
+}
+
+func (w *rdbWriter) writeList(list *data_structure.Quicklist) {
+	w.writeUvarint(uint64(list.Len()))
+	for _, v := range list.Values() {
+		w.writeString(v)
+	}
+}
+
+func (w *rdbWriter) writeZSet(zset *data_structure.SortedSet) {
+	w.writeUvarint(uint64(len(zset.MemberScores)))
+	for member, score := range zset.MemberScores {
+		w.writeString(member)
+		w.writeFloat(score)
+	}
+}
+
+// writeHash writes the fields and values of hash, then the deadline of the
+// fields that have one.
+func (w *rdbWriter) writeHash(hash *data_structure.Hash) {
+	pairs := hash.Pairs()
+	w.writeUvarint(uint64(len(pairs) / 2))
+	for _, s := range pairs {
+		w.writeString(s)
+	}
+	var expiring []string
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := hash.Expiry(pairs[i]); ok {
+			expiring = append(expiring, pairs[i])
+		}
+	}
+	w.writeUvarint(uint64(len(expiring)))
+	for _, field := range expiring {
+		at, _ := hash.Expiry(field)
+		w.writeString(field)
+		w.writeUint64(at)
+	}
+}
+
+func (w *rdbWriter) writeBinary(m encoding.BinaryMarshaler) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	w.writeBytes(data)
+	return nil
+}
+
+// rdbTypes maps each object type to its type byte in the file.
+var rdbTypes = map[data_structure.ObjType]byte{
+	data_structure.ObjTypeString: rdbTypeString,
+	data_structure.ObjTypeList:   rdbTypeList,
+	data_structure.ObjTypeSet:    rdbTypeSet,
+	data_structure.ObjTypeZSet:   rdbTypeZSet,
+	data_structure.ObjTypeHash:   rdbTypeHash,
+	data_structure.ObjTypeCMS:    rdbTypeCMS,
+	data_structure.ObjTypeBloom:  rdbTypeBloom,
+}
+
+// writeValue writes the type byte of obj, the key, if any, and the value.
+func (w *rdbWriter) writeValue(key *string, obj *data_structure.Obj) error {
+	valueType, ok := rdbTypes[obj.Type]
+	if !ok {
+		return fmt.Errorf("rdb: unsupported object type %v", obj.Type)
+	}
+	w.writeByte(valueType)
+	if key != nil {
+		w.writeString(*key)
+	}
+	switch v := obj.Value.(type) {
+	case string:
+		w.writeString(v)
+	case int64:
+		w.writeString(strconv.FormatInt(v, 10))
+	case []byte:
+		w.writeBytes(v)
+	case *data_structure.Quicklist:
+		w.writeList(v)
+	case *data_structure.SimpleSet:
+		w.writeSet(v)
+	case *data_structure.SortedSet:
+		w.writeZSet(v)
+	case *data_structure.Hash:
+		w.writeHash(v)
+	case encoding.BinaryMarshaler:
+		return w.writeBinary(v)
+	}
+	return nil
+}
+
+// encodeRdbEntries appends every live key of s to w. It must run while the
+// storage can't change, i.e. on the shard's worker or with the shard locked.
+func encodeRdbEntries(s *Storage, w *rdbWriter) error {
+	for key, obj := range s.dictStore.GetDictStore() {
+		if s.dictStore.HasExpired(key) {
+			continue
+		}
+		if exp, ok := s.dictStore.GetExpiry(key); ok {
+			w.writeByte(rdbOpExpireMs)
+			w.writeUint64(exp)
+		}
+		if err := w.writeValue(&key, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeRdb builds a complete snapshot file from the given storages.
+func encodeRdb(storages []*Storage) ([]byte, error) {
+	// Encode the shards concurrently, they are independent of each other.
+	bodies := make([]bytes.Buffer, len(storages))
+	errs := make(chan error, len(storages))
+	for i, s := range storages {
+		go func() {
+			errs <- encodeRdbEntries(s, &rdbWriter{buf: &bodies[i]})
+		}()
+	}
+	for range storages {
+		if err := <-errs; err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(rdbMagic)
+	buf.WriteString(rdbVersion)
+	for i := range bodies {
+		buf.Write(bodies[i].Bytes())
+	}
+	buf.WriteByte(rdbOpEOF)
+	var crc [8]byte
+	binary.LittleEndian.PutUint64(crc[:], crc64.Checksum(buf.Bytes(), rdbCrcTable))
+	buf.Write(crc[:])
+	return buf.Bytes(), nil
+}
+
+// decodeRdb loads a snapshot, placing every key in the storage returned by
+// storageOf. Keys that expired while the server was down are skipped. It
+// returns the number of keys loaded.
+func decodeRdb(data []byte, storageOf func(key string) *Storage) (int, error) {
+	header := len(rdbMagic) + len(rdbVersion)
+	if len(data) < header+1+8 || string(data[:len(rdbMagic)]) != rdbMagic {
+		return 0, errRdbFormat
+	}
+	if string(data[len(rdbMagic):header]) != rdbVersion {
+		return 0, fmt.Errorf("rdb: unsupported version %q", data[len(rdbMagic):header])
+	}
+	body, checksum := data[:len(data)-8], binary.LittleEndian.Uint64(data[len(data)-8:])
+	if crc64.Checksum(body, rdbCrcTable) != checksum {
+		return 0, errRdbChecksum
+	}
+
+	r := &rdbReader{r: bytes.NewReader(body[header:])}
+	now := uint64(time.Now().UnixMilli())
+	loaded := 0
+	for {
+		op, err := r.readByte()
+		if err != nil {
+			return loaded, errRdbFormat
+		}
+		if op == rdbOpEOF {
+			if r.r.Len() != 0 {
+				return loaded, errRdbFormat
+			}
+			return loaded, nil
+		}
+		var expireAt uint64
+		if op == rdbOpExpireMs {
+			if expireAt, err = r.readUint64(); err != nil {
+				return loaded, errRdbFormat
+			}
+			if op, err = r.readByte(); err != nil {
+				return loaded, errRdbFormat
+			}
+		}
+		key, err := r.readString()
+		if err != nil {
+			return loaded, errRdbFormat
+		}
+		value, err := decodeRdbValue(r, op, key)
+		if err != nil {
+			return loaded, err
+		}
+		s := storageOf(key)
+		s.setValue(key, value)
+		if expireAt > 0 {
+			if expireAt <= now {
+				s.dictStore.Del(key)
+				continue
+			}
+			s.dictStore.SetExpiryAt(key, expireAt)
+		}
+		loaded++
+	}
+}
+
+// decodeRdbValue reads the value of key, which has the given type byte.
+func decodeRdbValue(r *rdbReader, valueType byte, key string) (interface{}, error) {
+	switch valueType {
+	case rdbTypeString:
+		value, err := r.readString()
+		if err != nil {
+			return nil, errRdbFormat
+		}
+		return stringValue(value), nil
+	case rdbTypeList:
+		n, err := r.readUvarint()
+		if err != nil {
+			return nil, errRdbFormat
+		}
+		list := data_structure.NewQuicklist()
+		for i := uint64(0); i < n; i++ {
+			v, err := r.readString()
+			if err != nil {
+				return nil, errRdbFormat
+			}
+			list.PushTail(v)
+		}
+		return list, nil
+	case rdbTypeSet:
+		n, err := r.readUvarint()
+		if err != nil {
+			return nil, errRdbFormat
+		}
+		set := data_structure.NewSimpleSet(key)
+		for i := uint64(0); i < n; i++ {
+			member, err := r.readString()
+			if err != nil {
+				return nil, errRdbFormat
+			}
+			set.Add(member)
+		}
+		return set, nil
+	case rdbTypeZSet:
+		n, err := r.readUvarint()
+		if err != nil {
+			return nil, errRdbFormat
+		}
+		zset := data_structure.NewSortedSet(constant.DefaultBPlusTreeDegree)
+		for i := uint64(0); i < n; i++ {
+			member, err := r.readString()
+			if err != nil {
+				return nil, errRdbFormat
+			}
+			score, err := r.readFloat()
+			if err != nil {
+				return nil, errRdbFormat
+			}
+			zset.Add(score, member)
+		}
+		return zset, nil
+	case rdbTypeHash:
+		n, err := r.readUvarint()
+		if err != nil {
+			return nil, errRdbFormat
+		}
+		hash := data_structure.NewHash()
+		for i := uint64(0); i < n; i++ {
+			field, err := r.readString()
+			if err != nil {
+				return nil, errRdbFormat
+			}
+			value, err := r.readString()
+			if err != nil {
+				return nil, errRdbFormat
+			}
+			hash.Set(field, value)
+		}
+		if n, err = r.readUvarint(); err != nil {
+			return nil, errRdbFormat
+		}
+		for i := uint64(0); i < n; i++ {
+			field, err := r.readString()
+			if err != nil {
+				return nil, errRdbFormat
+			}
+			at, err := r.readUint64()
+			if _, ok := hash.Get(field); err != nil || !ok {
+				return nil, errRdbFormat
+			}
+			hash.SetExpiry(field, at)
+		}
+		return hash, nil
+	case rdbTypeCMS:
+		data, err := r.readBytes()
+		if err != nil {
+			return nil, errRdbFormat
+		}
+		cms := &data_structure.CMS{}
+		if err = cms.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return cms, nil
+	case rdbTypeBloom:
+		data, err := r.readBytes()
+		if err != nil {
+			return nil, errRdbFormat
+		}
+		bloom := &data_structure.Bloom{}
+		if err = bloom.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return bloom, nil
+	}
+	return nil, fmt.Errorf("rdb: unknown value type %d", valueType)
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+)
+
+func populateStorage(s *Storage) {
+	s.cmdSET([]string{"str", "hello"})
+	s.cmdSET([]string{"ttl", "bye", "EX", "100"})
+	s.cmdSADD([]string{"set", "a", "b", "c"})
+	s.cmdZADD([]string{"zset", "1", "one", "2.5", "two"})
+	s.cmdCMSINITBYDIM([]string{"cms", "100", "5"})
+	s.cmdCMSINCRBY([]string{"cms", "x", "7"})
+	s.cmdBFRESERVE([]string{"bf", "0.01", "100"})
+	s.cmdBFMADD([]string{"bf", "item"})
+}
+
+func TestRdb_roundTrip(t *testing.T) {
+	src := NewStorage()
+	populateStorage(src)
+
+	data, err := encodeRdb([]*Storage{src})
+	assert.NoError(t, err)
+
+	dst := NewStorage()
+	loaded, err := decodeRdb(data, func(string) *Storage { return dst })
+	assert.NoError(t, err)
+	assert.Equal(t, 6, loaded)
+
+	assert.Equal(t, string(Encode("hello", false)), string(dst.cmdGET([]string{"str"})))
+	assert.Equal(t, string(Encode("bye", false)), string(dst.cmdGET([]string{"ttl"})))
+	srcExp, _ := src.dictStore.GetExpiry("ttl")
+	dstExp, ok := dst.dictStore.GetExpiry("ttl")
+	assert.True(t, ok)
+	assert.Equal(t, srcExp, dstExp)
+	set, _ := dst.lookupSet("set")
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, set.Members())
+	zset, _ := dst.lookupZSet("zset")
+	assert.Equal(t, map[string]float64{"one": 1, "two": 2.5}, zset.MemberScores)
+	assert.Equal(t, 1, zset.GetRank("two"))
+	cms, _ := dst.lookupCMS("cms")
+	assert.Equal(t, uint32(7), cms.Count("x"))
+	bloom, _ := dst.lookupBloom("bf")
+	assert.True(t, bloom.Exist("item"))
+}
+
+func TestRdb_bitmaps(t *testing.T) {
+	src := NewStorage()
+	src.cmdSETBIT([]string{"bits", "100", "1"})
+	data, err := encodeRdb([]*Storage{src})
+	assert.NoError(t, err)
+
+	dst := NewStorage()
+	_, err = decodeRdb(data, func(string) *Storage { return dst })
+	assert.NoError(t, err)
+	assert.Equal(t, string(src.cmdGET([]string{"bits"})), string(dst.cmdGET([]string{"bits"})))
+	assert.Equal(t, ":1\r\n", string(dst.cmdGETBIT([]string{"bits", "100"})))
+}
+
+func TestRdb_lists(t *testing.T) {
+	src := NewStorage()
+	for i := 0; i < 300; i++ {
+		src.cmdRPUSH([]string{"list", strconv.Itoa(i)})
+	}
+	data, err := encodeRdb([]*Storage{src})
+	assert.NoError(t, err)
+
+	dst := NewStorage()
+	_, err = decodeRdb(data, func(string) *Storage { return dst })
+	assert.NoError(t, err)
+	list, _ := dst.lookupList("list")
+	srcList, _ := src.lookupList("list")
+	assert.Equal(t, srcList.Values(), list.Values())
+	assert.Equal(t, "+list\r\n", string(dst.cmdTYPE([]string{"list"})))
+}
+
+func TestRdb_hashes(t *testing.T) {
+	src := NewStorage()
+	src.cmdHSET([]string{"small", "name", "ada", "age", "36"})
+	src.cmdHEXPIRE([]string{"small", "100", "FIELDS", "1", "age"})
+	for i := 0; i < 200; i++ {
+		src.cmdHSET([]string{"big", "f" + strconv.Itoa(i), strconv.Itoa(i)})
+	}
+	data, err := encodeRdb([]*Storage{src})
+	assert.NoError(t, err)
+
+	dst := NewStorage()
+	_, err = decodeRdb(data, func(string) *Storage { return dst })
+	assert.NoError(t, err)
+	for _, key := range []string{"small", "big"} {
+		hash, _ := dst.lookupHash(key)
+		srcHash, _ := src.lookupHash(key)
+		assert.ElementsMatch(t, srcHash.Pairs(), hash.Pairs())
+		assert.Equal(t, srcHash.IsCompact(), hash.IsCompact())
+	}
+	assert.Equal(t, "*2\r\n:100\r\n:-1\r\n",
+		string(dst.cmdHTTL([]string{"small", "FIELDS", "2", "age", "name"})))
+	assert.Contains(t, dst.hashFieldExpiries, "small")
+	assert.Equal(t, "+hash\r\n", string(dst.cmdTYPE([]string{"big"})))
+}
+
+func TestRdb_skipsExpiredKeys(t *testing.T) {
+	src := NewStorage()
+	src.cmdSET([]string{"gone", "v"})
+	src.cmdSET([]string{"kept", "v"})
+	src.dictStore.SetExpiryAt("gone", uint64(time.Now().UnixMilli()+50))
+	data, err := encodeRdb([]*Storage{src})
+	assert.NoError(t, err)
+
+	// The key expires between saving and loading, as if the server had been down.
+	time.Sleep(60 * time.Millisecond)
+
+	dst := NewStorage()
+	loaded, err := decodeRdb(data, func(string) *Storage { return dst })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, loaded)
+	assert.Nil(t, dst.dictStore.Get("gone"))
+}
+
+func TestRdb_detectsCorruption(t *testing.T) {
+	src := NewStorage()
+	populateStorage(src)
+	data, err := encodeRdb([]*Storage{src})
+	assert.NoError(t, err)
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(rdbMagic)+len(rdbVersion)+3] ^= 0xFF
+	_, err = decodeRdb(corrupted, func(string) *Storage { return NewStorage() })
+	assert.Equal(t, errRdbChecksum, err)
+
+	_, err = decodeRdb(data[:len(data)-1], func(string) *Storage { return NewStorage() })
+	assert.Error(t, err)
+
+	_, err = decodeRdb([]byte("NOTANRDBFILE"), func(string) *Storage { return NewStorage() })
+	assert.Equal(t, errRdbFormat, err)
+}
+
+func useTempDir(t *testing.T) {
+	dir, filename := config.Dir, config.DbFilename
+	config.Dir, config.DbFilename = t.TempDir(), "dump.rdb"
+	t.Cleanup(func() { config.Dir, config.DbFilename = dir, filename })
+}
+
+func TestDispatcher_SAVEAndLoad(t *testing.T) {
+	useTempDir(t)
+	d := NewDispatcher(4)
+	for i, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		d.Execute(&Command{Cmd: "SET", Args: []string{key, string(rune('0' + i))}})
+	}
+	d.Execute(&Command{Cmd: "SADD", Args: []string{"set", "x", "y"}})
+
+	assert.Equal(t, "+OK\r\n", string(d.Execute(&Command{Cmd: "SAVE"})))
+	assert.FileExists(t, filepath.Join(config.Dir, config.DbFilename))
+	assert.Contains(t, string(d.Execute(&Command{Cmd: "INFO"})), "rdb_changes_since_last_save:0\r\n")
+	d.Close()
+
+	restarted := NewDispatcher(3)
+	defer restarted.Close()
+	assert.NoError(t, restarted.LoadSnapshot())
+	assert.Equal(t, string(Encode("4", false)), string(restarted.Execute(&Command{Cmd: "GET", Args: []string{"e"}})))
+	assert.Equal(t, ":1\r\n", string(restarted.Execute(&Command{Cmd: "SISMEMBER", Args: []string{"set", "y"}})))
+}
+
+func TestDispatcher_BGSAVEAndLASTSAVE(t *testing.T) {
+	useTempDir(t)
+	d := NewDispatcher(2)
+	defer d.Close()
+	d.snapshots.lastSave.Store(0)
+
+	d.Execute(&Command{Cmd: "SET", Args: []string{"k", "v"}})
+	assert.Equal(t, "+Background saving started\r\n", string(d.Execute(&Command{Cmd: "BGSAVE"})))
+	assert.Eventually(t, func() bool { return !d.snapshots.bgSaveInFlight.Load() }, time.Second, time.Millisecond)
+
+	var lastSave int64
+	assert.NoError(t, DecodeInt64(d.Execute(&Command{Cmd: "LASTSAVE"}), &lastSave))
+	assert.InDelta(t, time.Now().Unix(), lastSave, 2)
+	_, err := os.Stat(filepath.Join(config.Dir, config.DbFilename))
+	assert.NoError(t, err)
+}
+
+func TestDispatcher_SaveCron(t *testing.T) {
+	useTempDir(t)
+	rules := config.SaveRules
+	config.SaveRules = []config.SaveRule{{Seconds: 10, Changes: 3}}
+	t.Cleanup(func() { config.SaveRules = rules })
+
+	d := NewDispatcher(2)
+	defer d.Close()
+	start := time.Now()
+	d.snapshots.lastSave.Store(start.Unix())
+
+	for i := 0; i < 3; i++ {
+		d.Execute(&Command{Cmd: "SET", Args: []string{"k", "v"}})
+	}
+	// Failed writes aren't changes.
+	d.Execute(&Command{Cmd: "CMS.INCRBY", Args: []string{"missing", "x", "1"}})
+	assert.Equal(t, int64(3), d.dirty())
+
+	// Enough changes, but not enough time has passed.
+	d.SaveCron(start.Add(5 * time.Second))
+	assert.Equal(t, int64(0), d.snapshots.dirtyAtSave.Load())
+
+	d.SaveCron(start.Add(10 * time.Second))
+	assert.Eventually(t, func() bool { return d.snapshots.dirtyAtSave.Load() == 3 }, time.Second, time.Millisecond)
+	assert.FileExists(t, filepath.Join(config.Dir, config.DbFilename))
+}
@@ -4,37 +4,84 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"strings"
+	"math"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
 )
 
 const CRLF string = "\r\n"
 
 var RespNil = []byte("$-1\r\n")
 
+// ErrIncompleteFrame is returned by the decoder when data holds only a prefix
+// of a RESP value. The caller should keep the bytes and retry once more data
+// has been read from the connection.
+var ErrIncompleteFrame = errors.New("incomplete RESP frame")
+
+// ErrProtocol is returned when data can never become a valid RESP value.
+var ErrProtocol = errors.New("ERR Protocol error")
+
+// readLine returns the position of the CRLF terminating the line that starts
+// at data[0], or ErrIncompleteFrame if the terminator has not arrived yet.
+// Lines are type and length headers, so one longer than
+// constant.MaxInlineLength is a protocol error rather than something to wait
+// for, which also bounds the search done each time more data arrives.
+func readLine(data []byte) (int, error) {
+	window := data[:min(len(data), constant.MaxInlineLength+len(CRLF))]
+	pos := bytes.Index(window, []byte(CRLF))
+	if pos < 0 {
+		if len(data) > constant.MaxInlineLength {
+			return 0, ErrProtocol
+		}
+		return 0, ErrIncompleteFrame
+	}
+	return pos, nil
+}
+
 // +OK\r\n => OK, 5
 func readSimpleString(data []byte) (string, int, error) {
-	pos := 1
-	for data[pos] != '\r' {
-		pos++
+	pos, err := readLine(data)
+	if err != nil {
+		return "", 0, err
 	}
 	return string(data[1:pos]), pos + 2, nil
 }
 
 // :123\r\n => 123
 func readInt64(data []byte) (int64, int, error) {
+	end, err := readLine(data)
+	if err != nil {
+		return 0, 0, err
+	}
 	pos := 1
-	base := int64(1)
-	if data[1] == '-' {
+	negative := end > 1 && data[1] == '-'
+	if negative {
 		pos++
-		base = -1
 	}
-	var res int64
-	for data[pos] != '\r' {
-		val := data[pos] - '0'
-		res = res*10 + int64(val)
-		pos++
+	if pos == end {
+		return 0, 0, ErrProtocol
+	}
+	// The magnitude is accumulated unsigned so that math.MinInt64, whose
+	// magnitude doesn't fit in an int64, parses too.
+	limit := uint64(math.MaxInt64)
+	if negative {
+		limit++
+	}
+	var res uint64
+	for ; pos < end; pos++ {
+		if data[pos] < '0' || data[pos] > '9' {
+			return 0, 0, ErrProtocol
+		}
+		digit := uint64(data[pos] - '0')
+		if res > (limit-digit)/10 {
+			return 0, 0, ErrProtocol
+		}
+		res = res*10 + digit
+	}
+	if negative {
+		return -int64(res), end + 2, nil
 	}
-	return res * base, pos + 2, nil
+	return int64(res), end + 2, nil
 }
 
 func readError(data []byte) (string, int, error) {
@@ -42,38 +89,103 @@ func readError(data []byte) (string, int, error) {
 }
 
 // $5\r\nhello\r\n => 5, 4
-func readLen(data []byte) (int, int) {
-	res, pos, _ := readInt64(data)
-	return int(res), pos
+func readLen(data []byte) (int, int, error) {
+	res, pos, err := readInt64(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	// -1 is the only negative length, the one of null values.
+	if res < -1 || res > constant.MaxBulkLength {
+		return 0, 0, ErrProtocol
+	}
+	return int(res), pos, nil
 }
 
 // $5\r\nhello\r\n => "hello"
-func readBulkString(data []byte) (string, int, error) {
-	length, pos := readLen(data)
-
+func readBulkString(data []byte) (interface{}, int, error) {
+	length, pos, err := readLen(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	// $-1\r\n is the null bulk string
+	if length < 0 {
+		return nil, pos, nil
+	}
+	if len(data) < pos+length+2 {
+		return nil, 0, ErrIncompleteFrame
+	}
+	if data[pos+length] != '\r' || data[pos+length+1] != '\n' {
+		return nil, 0, ErrProtocol
+	}
 	return string(data[pos : pos+length]), pos + length + 2, nil
 }
 
 // *2\r\n$5\r\nhello\r\n$5\r\nworld\r\n => {"hello", "world"}
 func readArray(data []byte) (interface{}, int, error) {
-	length, pos := readLen(data)
-	var res []interface{} = make([]interface{}, length)
-	// implement start
-	for i := range res {
-		elem, delta, err := DecodeOne(data[pos:])
+	var st MultiBulkState
+	return st.readArray(data)
+}
+
+// MultiBulkState is how far the decoding of a partly received array has got,
+// so that DecodeFrame carries on from there once more data has arrived
+// instead of decoding the elements already received again. The zero value is
+// the state before the header.
+type MultiBulkState struct {
+	expected int           // elements announced by the header
+	elems    []interface{} // elements decoded so far
+	pos      int           // bytes taken by the header and elems, 0 before the header
+}
+
+func (st *MultiBulkState) readArray(data []byte) (interface{}, int, error) {
+	if st.pos == 0 {
+		length, pos, err := readLen(data)
 		if err != nil {
 			return nil, 0, err
 		}
-		res[i] = elem
-		pos += delta
+		// *-1\r\n is the null array
+		if length < 0 {
+			return nil, pos, nil
+		}
+		if length > constant.MaxMultiBulkLength {
+			return nil, 0, ErrProtocol
+		}
+		// The slice grows as elements arrive rather than being sized from
+		// the header, which anyone can send.
+		st.expected, st.elems, st.pos = length, []interface{}{}, pos
+	}
+	for len(st.elems) < st.expected {
+		elem, delta, err := DecodeOne(data[st.pos:])
+		if err != nil {
+			if err != ErrIncompleteFrame {
+				*st = MultiBulkState{}
+			}
+			return nil, 0, err
+		}
+		st.elems = append(st.elems, elem)
+		st.pos += delta
 	}
-	// implement end
-	return res, pos, nil
+	res, n := st.elems, st.pos
+	*st = MultiBulkState{}
+	return res, n, nil
 }
 
+// DecodeFrame is DecodeOne for a stream the frame keeps arriving on: when the
+// frame is an array, the elements decoded by an earlier call that returned
+// ErrIncompleteFrame are kept in st and aren't decoded again. data must start
+// at the same frame on each call, only longer.
+func DecodeFrame(data []byte, st *MultiBulkState) (interface{}, int, error) {
+	if st.pos == 0 && (len(data) == 0 || data[0] != '*') {
+		return DecodeOne(data)
+	}
+	return st.readArray(data)
+}
+
+// DecodeOne decodes the first RESP value in data and returns it together with
+// the number of bytes it occupied. ErrIncompleteFrame means data ends in the
+// middle of the value.
 func DecodeOne(data []byte) (interface{}, int, error) {
 	if len(data) == 0 {
-		return nil, 0, errors.New("no data")
+		return nil, 0, ErrIncompleteFrame
 	}
 	switch data[0] {
 	case '+':
@@ -87,7 +199,7 @@ func DecodeOne(data []byte) (interface{}, int, error) {
 	case '*':
 		return readArray(data)
 	}
-	return nil, 0, nil
+	return nil, 0, ErrProtocol
 }
 
 func Decode(data []byte) (interface{}, error) {
@@ -145,12 +257,5 @@ func ParseCmd(data []byte) (*Command, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	array := value.([]interface{})
-	tokens := make([]string, len(array))
-	for i := range tokens {
-		tokens[i] = array[i].(string)
-	}
-	res := &Command{Cmd: strings.ToUpper(tokens[0]), Args: tokens[1:]}
-	return res, nil
+	return NewCommand(value)
 }
@@ -1,8 +1,14 @@
 package core
 
 import (
+	"fmt"
+	"math"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
 )
 
 func Test_readSimpleString(t *testing.T) {
@@ -72,6 +78,36 @@ func Test_readInt64(t *testing.T) {
 			want:  -12345,
 			want1: 9,
 		},
+		{
+			name: "max int64",
+			args: args{
+				data: []byte(":9223372036854775807\r\n"),
+			},
+			want:  math.MaxInt64,
+			want1: 22,
+		},
+		{
+			name: "min int64",
+			args: args{
+				data: []byte(":-9223372036854775808\r\n"),
+			},
+			want:  math.MinInt64,
+			want1: 23,
+		},
+		{
+			name: "overflow",
+			args: args{
+				data: []byte(":9223372036854775808\r\n"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative overflow",
+			args: args{
+				data: []byte(":-9223372036854775809\r\n"),
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -187,3 +223,111 @@ func Test_readArray(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeOne_partialFrames(t *testing.T) {
+	frame := []byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$600\r\n" + strings.Repeat("v", 600) + "\r\n")
+	// Every strict prefix must be reported as incomplete rather than panicking.
+	for i := 0; i < len(frame); i++ {
+		_, _, err := DecodeOne(frame[:i])
+		if err != ErrIncompleteFrame {
+			t.Fatalf("DecodeOne(frame[:%d]) error = %v, want ErrIncompleteFrame", i, err)
+		}
+	}
+	got, n, err := DecodeOne(frame)
+	if err != nil {
+		t.Fatalf("DecodeOne() error = %v", err)
+	}
+	if n != len(frame) {
+		t.Errorf("DecodeOne() consumed %d bytes, want %d", n, len(frame))
+	}
+	want := []interface{}{"SET", "key", strings.Repeat("v", 600)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeOne() got = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeOne_partialArrayDoesntAllocateFromHeader(t *testing.T) {
+	frame := []byte("*1048576\r\n$3\r\nfoo\r\n")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 10; i++ {
+		if _, _, err := DecodeOne(frame); err != ErrIncompleteFrame {
+			t.Fatalf("DecodeOne() error = %v, want ErrIncompleteFrame", err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	// Sizing the array from its header would take 16MB a call.
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("DecodeOne() allocated %d bytes", allocated)
+	}
+}
+
+func TestDecodeFrame_resumes(t *testing.T) {
+	frame := []byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$600\r\n" + strings.Repeat("v", 600) + "\r\nPING")
+	end := len(frame) - len("PING")
+	var st MultiBulkState
+	// The frame arrives a byte at a time, as the same growing buffer.
+	for i := 0; i < end; i++ {
+		if _, _, err := DecodeFrame(frame[:i], &st); err != ErrIncompleteFrame {
+			t.Fatalf("DecodeFrame(frame[:%d]) error = %v, want ErrIncompleteFrame", i, err)
+		}
+	}
+	if len(st.elems) != 2 {
+		t.Errorf("DecodeFrame() kept %d elements, want 2", len(st.elems))
+	}
+	got, n, err := DecodeFrame(frame, &st)
+	if err != nil {
+		t.Fatalf("DecodeFrame() error = %v", err)
+	}
+	if n != end {
+		t.Errorf("DecodeFrame() consumed %d bytes, want %d", n, end)
+	}
+	want := []interface{}{"SET", "key", strings.Repeat("v", 600)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeFrame() got = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(st, MultiBulkState{}) {
+		t.Errorf("DecodeFrame() left state %+v", st)
+	}
+}
+
+func TestDecodeOne_longLines(t *testing.T) {
+	// A header may be up to MaxInlineLength long without being an error.
+	data := []byte("$" + strings.Repeat("1", constant.MaxInlineLength-1))
+	if _, _, err := DecodeOne(data); err != ErrIncompleteFrame {
+		t.Errorf("DecodeOne() error = %v, want ErrIncompleteFrame", err)
+	}
+	data = append(data, '1')
+	if _, _, err := DecodeOne(data); err != ErrProtocol {
+		t.Errorf("DecodeOne() error = %v, want ErrProtocol", err)
+	}
+	// A bulk string is as long as its header says, whatever the limit.
+	bulk := strings.Repeat("v", 2*constant.MaxInlineLength)
+	got, _, err := DecodeOne([]byte(fmt.Sprintf("$%d\r\n%s\r\n", len(bulk), bulk)))
+	if err != nil || got != bulk {
+		t.Errorf("DecodeOne() error = %v", err)
+	}
+}
+
+func TestDecodeOne_protocolError(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "unknown type", data: []byte("?foo\r\n")},
+		{name: "non numeric length", data: []byte("$abc\r\nfoo\r\n")},
+		{name: "missing terminator", data: []byte("$3\r\nfooXY")},
+		{name: "negative bulk length", data: []byte("$-2\r\n")},
+		{name: "negative array length", data: []byte("*-2\r\n")},
+		{name: "array too long", data: []byte("*1048577\r\n")},
+		{name: "huge array", data: []byte("*536870912\r\n")},
+		{name: "length overflow", data: []byte("*18446744073709551617\r\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := DecodeOne(tt.data); err != ErrProtocol {
+				t.Errorf("DecodeOne() error = %v, want ErrProtocol", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shardQueueSize bounds how many tasks an I/O thread may queue on a shard
+// before it has to wait for the worker to catch up.
+const shardQueueSize = 1024
+
+var errCrossSlot = errors.New("CROSSSLOT Keys in request don't hash to the same shard")
+
+// keySpec tells the dispatcher where a command's keys are, following the
+// first/last/step convention of the Redis command table. Indexes are into
+// Command.Args and a negative last counts from the end.
+type keySpec struct {
+	first int
+	last  int
+	step  int
+}
+
+// commandKeys lists every command that touches the keyspace. Commands missing
+// from the table are keyless and run on the first shard.
+var commandKeys = map[string]keySpec{
+	"SET":              {0, 0, 1},
+	"GET":              {0, 0, 1},
+	"TTL":              {0, 0, 1},
+	"INCR":             {0, 0, 1},
+	"DECR":             {0, 0, 1},
+	"INCRBY":           {0, 0, 1},
+	"DECRBY":           {0, 0, 1},
+	"INCRBYFLOAT":      {0, 0, 1},
+	"APPEND":           {0, 0, 1},
+	"STRLEN":           {0, 0, 1},
+	"GETRANGE":         {0, 0, 1},
+	"SETRANGE":         {0, 0, 1},
+	"GETDEL":           {0, 0, 1},
+	"GETEX":            {0, 0, 1},
+	"GETSET":           {0, 0, 1},
+	"MSET":             {0, -1, 2},
+	"MSETNX":           {0, -1, 2},
+	"MGET":             {0, -1, 1},
+	"SETBIT":           {0, 0, 1},
+	"GETBIT":           {0, 0, 1},
+	"BITCOUNT":         {0, 0, 1},
+	"BITPOS":           {0, 0, 1},
+	"BITOP":            {1, -1, 1},
+	"BITFIELD":         {0, 0, 1},
+	"DEL":              {0, -1, 1},
+	"EXPIRE":           {0, 0, 1},
+	"EXISTS":           {0, -1, 1},
+	"PEXPIRE":          {0, 0, 1},
+	"EXPIREAT":         {0, 0, 1},
+	"PEXPIREAT":        {0, 0, 1},
+	"PTTL":             {0, 0, 1},
+	"EXPIRETIME":       {0, 0, 1},
+	"PEXPIRETIME":      {0, 0, 1},
+	"PERSIST":          {0, 0, 1},
+	"TYPE":             {0, 0, 1},
+	"DUMP":             {0, 0, 1},
+	"RESTORE":          {0, 0, 1},
+	"ZADD":             {0, 0, 1},
+	"ZINCRBY":          {0, 0, 1},
+	"ZSCORE":           {0, 0, 1},
+	"ZRANK":            {0, 0, 1},
+	"ZCARD":            {0, 0, 1},
+	"ZRANGE":           {0, 0, 1},
+	"ZRANGEBYSCORE":    {0, 0, 1},
+	"ZREVRANGE":        {0, 0, 1},
+	"ZREM":             {0, 0, 1},
+	"ZREMRANGEBYSCORE": {0, 0, 1},
+	"ZREMRANGEBYRANK":  {0, 0, 1},
+	"ZPOPMIN":          {0, 0, 1},
+	"ZPOPMAX":          {0, 0, 1},
+	"LPUSH":            {0, 0, 1},
+	"RPUSH":            {0, 0, 1},
+	"LPOP":             {0, 0, 1},
+	"RPOP":             {0, 0, 1},
+	"LLEN":             {0, 0, 1},
+	"LRANGE":           {0, 0, 1},
+	"LINDEX":           {0, 0, 1},
+	"LSET":             {0, 0, 1},
+	"LREM":             {0, 0, 1},
+	"LTRIM":            {0, 0, 1},
+	"LINSERT":          {0, 0, 1},
+	"LMOVE":            {0, 1, 1},
+	"BLPOP":            {0, -2, 1},
+	"BRPOP":            {0, -2, 1},
+	"BLMOVE":           {0, 1, 1},
+	"HSET":             {0, 0, 1},
+	"HSETNX":           {0, 0, 1},
+	"HGET":             {0, 0, 1},
+	"HMGET":            {0, 0, 1},
+	"HDEL":             {0, 0, 1},
+	"HLEN":             {0, 0, 1},
+	"HEXISTS":          {0, 0, 1},
+	"HGETALL":          {0, 0, 1},
+	"HKEYS":            {0, 0, 1},
+	"HVALS":            {0, 0, 1},
+	"HINCRBY":          {0, 0, 1},
+	"HINCRBYFLOAT":     {0, 0, 1},
+	"HSCAN":            {0, 0, 1},
+	"HEXPIRE":          {0, 0, 1},
+	"HPEXPIRE":         {0, 0, 1},
+	"HEXPIREAT":        {0, 0, 1},
+	"HPEXPIREAT":       {0, 0, 1},
+	"HTTL":             {0, 0, 1},
+	"HPTTL":            {0, 0, 1},
+	"HPERSIST":         {0, 0, 1},
+	"SADD":             {0, 0, 1},
+	"SREM":             {0, 0, 1},
+	"SMEMBERS":         {0, 0, 1},
+	"SISMEMBER":        {0, 0, 1},
+	"CMS.INITBYDIM":    {0, 0, 1},
+	"CMS.INITBYPROB":   {0, 0, 1},
+	"CMS.INCRBY":       {0, 0, 1},
+	"CMS.QUERY":        {0, 0, 1},
+	"BF.RESERVE":       {0, 0, 1},
+	"BF.MADD":          {0, 0, 1},
+	"BF.EXISTS":        {0, 0, 1},
+}
+
+// fanOutCommands are multi-key commands whose keys may live on different
+// shards. The dispatcher splits them into one sub-command per shard and merges
+// the replies with the given function.
+var fanOutCommands = map[string]func(replies [][]byte) []byte{
+	"DEL":    sumIntegerReplies,
+	"EXISTS": sumIntegerReplies,
+}
+
+// atomicCommands are multi-key commands that must not be split: when their
+// keys live on different shards, the dispatcher parks all of those shards and
+// runs the command against their storages at once.
+var atomicCommands = map[string]func(cmd *Command, storageOf func(key string) *Storage) []byte{
+	"MSET":   msetAcrossShards,
+	"MSETNX": msetAcrossShards,
+	"MGET":   mgetAcrossShards,
+	"BITOP":  bitopAcrossShards,
+}
+
+func (k keySpec) keys(args []string) []string {
+	last := k.last
+	if last < 0 {
+		last += len(args)
+	}
+	var keys []string
+	for i := k.first; i <= last && i < len(args); i += k.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// hashTag returns the part of key used for shard selection. As in Redis
+// Cluster, only the substring inside the first non-empty {...} is hashed, so
+// related keys like {user:1}:name and {user:1}:age land on the same shard.
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+type task struct {
+	run   func(s *Storage) []byte
+	reply chan []byte // nil for tasks nobody waits on
+}
+
+// Shard owns one partition of the keyspace together with the worker goroutine
+// that executes every command touching it. Shards share nothing, so N shards
+// run N commands in parallel without any locking.
+type Shard struct {
+	id      int
+	storage *Storage
+	tasks   chan *task
+}
+
+func (sh *Shard) run() {
+	for t := range sh.tasks {
+		res := t.run(sh.storage)
+		if t.reply != nil {
+			t.reply <- res
+		}
+	}
+}
+
+func (sh *Shard) submit(run func(s *Storage) []byte) chan []byte {
+	reply := make(chan []byte, 1)
+	sh.tasks <- &task{run: run, reply: reply}
+	return reply
+}
+
+func (sh *Shard) submitCommand(cmd *Command) chan []byte {
+	return sh.submit(func(s *Storage) []byte {
+		var buf bytes.Buffer
+		_ = s.ExecuteAndResponse(cmd, &buf)
+		return buf.Bytes()
+	})
+}
+
+// PendingReply is the reply of a command that has been handed to the shards
+// but may not have finished yet.
+type PendingReply struct {
+	replies []chan []byte
+	merge   func(replies [][]byte) []byte
+}
+
+// Wait blocks until the command has run on every shard involved and returns
+// its encoded reply.
+func (p *PendingReply) Wait() []byte {
+	if p.merge == nil {
+		return <-p.replies[0]
+	}
+	results := make([][]byte, len(p.replies))
+	for i, reply := range p.replies {
+		results[i] = <-reply
+	}
+	return p.merge(results)
+}
+
+func immediateReply(res []byte) *PendingReply {
+	reply := make(chan []byte, 1)
+	reply <- res
+	return &PendingReply{replies: []chan []byte{reply}}
+}
+
+// Dispatcher routes commands from the I/O threads to the shard owning their
+// keys. Tasks on one shard run in submission order, so pipelined commands from
+// a client keep their ordering as long as they are submitted in order.
+type Dispatcher struct {
+	shards    []*Shard
+	stats     stats
+	snapshots snapshotState
+	aof       *appendOnlyFile
+}
+
+func NewDispatcher(numShards int) *Dispatcher {
+	if numShards < 1 {
+		numShards = 1
+	}
+	d := &Dispatcher{shards: make([]*Shard, numShards)}
+	for i := range d.shards {
+		d.shards[i] = &Shard{
+			id:      i,
+			storage: NewStorage(),
+			tasks:   make(chan *task, shardQueueSize),
+		}
+		go d.shards[i].run()
+	}
+	d.snapshots.lastSave.Store(time.Now().Unix())
+	d.snapshots.lastSaveOK.Store(true)
+	return d
+}
+
+func (d *Dispatcher) shardOf(key string) *Shard {
+	return d.shards[crc32.ChecksumIEEE([]byte(hashTag(key)))%uint32(len(d.shards))]
+}
+
+// Submit hands cmd to the shards that own its keys and returns without
+// waiting for the result.
+func (d *Dispatcher) Submit(cmd *Command) *PendingReply {
+	d.stats.totalCommands.Add(1)
+	if handler, ok := serverCommands[cmd.Cmd]; ok {
+		return immediateReply(handler(d, cmd.Args))
+	}
+	spec, ok := commandKeys[cmd.Cmd]
+	if !ok {
+		return &PendingReply{replies: []chan []byte{d.shards[0].submitCommand(cmd)}}
+	}
+	keys := spec.keys(cmd.Args)
+	if len(keys) == 0 {
+		// Let the handler report the arity error.
+		return &PendingReply{replies: []chan []byte{d.shards[0].submitCommand(cmd)}}
+	}
+
+	keysByShard := make(map[*Shard][]string)
+	var order []*Shard
+	for _, key := range keys {
+		sh := d.shardOf(key)
+		if _, seen := keysByShard[sh]; !seen {
+			order = append(order, sh)
+		}
+		keysByShard[sh] = append(keysByShard[sh], key)
+	}
+	if len(order) == 1 {
+		return &PendingReply{replies: []chan []byte{order[0].submitCommand(cmd)}}
+	}
+
+	if run, ok := atomicCommands[cmd.Cmd]; ok {
+		return immediateReply(d.runAtomically(order, cmd, run))
+	}
+	merge, ok := fanOutCommands[cmd.Cmd]
+	if !ok {
+		return immediateReply(Encode(errCrossSlot, false))
+	}
+	pending := &PendingReply{merge: merge}
+	for _, sh := range order {
+		sub := &Command{Cmd: cmd.Cmd, Args: keysByShard[sh]}
+		pending.replies = append(pending.replies, sh.submitCommand(sub))
+	}
+	return pending
+}
+
+// runAtomically runs cmd on the storages of shards while their workers are
+// parked. Commands queued on those shards before cmd run first, and the ones
+// queued after it wait for it to finish. Shards are always locked in the same
+// order, so concurrent callers can't deadlock each other.
+func (d *Dispatcher) runAtomically(shards []*Shard, cmd *Command, run func(cmd *Command, storageOf func(key string) *Storage) []byte) []byte {
+	sorted := slices.Clone(shards)
+	slices.SortFunc(sorted, func(a, b *Shard) int { return a.id - b.id })
+	unlock := d.lockShards(sorted)
+	defer unlock()
+	return run(cmd, func(key string) *Storage { return d.shardOf(key).storage })
+}
+
+// Execute runs cmd and waits for its reply.
+func (d *Dispatcher) Execute(cmd *Command) []byte {
+	return d.Submit(cmd).Wait()
+}
+
+// broadcast queues run on every shard without waiting for it to finish.
+func (d *Dispatcher) broadcast(run func(s *Storage)) {
+	for _, sh := range d.shards {
+		sh.tasks <- &task{run: func(s *Storage) []byte {
+			run(s)
+			return nil
+		}}
+	}
+}
+
+// ActiveDeleteExpiredKeys starts an active expiry cycle on every shard.
+func (d *Dispatcher) ActiveDeleteExpiredKeys() {
+	d.broadcast((*Storage).ActiveDeleteExpiredKeys)
+}
+
+// SampleStats feeds the instantaneous metrics reported by INFO. The event loop
+// calls it on a timer.
+func (d *Dispatcher) SampleStats(now time.Time) {
+	d.stats.sample(now)
+}
+
+// Close stops the shard workers once their queued tasks have run.
+func (d *Dispatcher) Close() {
+	for _, sh := range d.shards {
+		close(sh.tasks)
+	}
+}
+
+// sumIntegerReplies merges per-shard integer replies, as for DEL and EXISTS.
+// The first error reply wins.
+func sumIntegerReplies(replies [][]byte) []byte {
+	var total int64
+	for _, reply := range replies {
+		if len(reply) == 0 || reply[0] != ':' {
+			return reply
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(string(reply[1:]), CRLF), 10, 64)
+		if err != nil {
+			return reply
+		}
+		total += n
+	}
+	return Encode(total, false)
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashTag(t *testing.T) {
+	assert.Equal(t, "user:1", hashTag("{user:1}:name"))
+	assert.Equal(t, "user:1", hashTag("profile:{user:1}"))
+	assert.Equal(t, "foo{}bar", hashTag("foo{}bar"))
+	assert.Equal(t, "foo{bar", hashTag("foo{bar"))
+	assert.Equal(t, "plain", hashTag("plain"))
+}
+
+func TestDispatcher_routesKeysToOwningShard(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		res := d.Execute(&Command{Cmd: "SET", Args: []string{key, key}})
+		assert.Equal(t, "+OK\r\n", string(res))
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		res := d.Execute(&Command{Cmd: "GET", Args: []string{key}})
+		assert.Equal(t, string(Encode(key, false)), string(res))
+	}
+
+	// Each key must live only on the shard it hashes to.
+	total := 0
+	for _, sh := range d.shards {
+		<-sh.submit(func(s *Storage) []byte {
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key:%d", i)
+				if s.dictStore.Get(key) != nil {
+					assert.Same(t, d.shardOf(key), sh)
+					total++
+				}
+			}
+			return nil
+		})
+	}
+	assert.Equal(t, 100, total)
+}
+
+func TestDispatcher_fanOutMultiKeyCommands(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		keys = append(keys, key)
+		d.Execute(&Command{Cmd: "SET", Args: []string{key, "v"}})
+	}
+
+	res := d.Execute(&Command{Cmd: "EXISTS", Args: append([]string{"missing", "key:0"}, keys...)})
+	assert.Equal(t, ":21\r\n", string(res))
+
+	res = d.Execute(&Command{Cmd: "DEL", Args: append(keys[:10:10], "missing")})
+	assert.Equal(t, ":10\r\n", string(res))
+
+	res = d.Execute(&Command{Cmd: "EXISTS", Args: keys})
+	assert.Equal(t, ":10\r\n", string(res))
+}
+
+func TestDispatcher_pipelinedOrdering(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	var pending []*PendingReply
+	for i := 0; i < 50; i++ {
+		pending = append(pending, d.Submit(&Command{Cmd: "SET", Args: []string{"counter", fmt.Sprint(i)}}))
+		pending = append(pending, d.Submit(&Command{Cmd: "GET", Args: []string{"counter"}}))
+	}
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, "+OK\r\n", string(pending[2*i].Wait()))
+		assert.Equal(t, string(Encode(fmt.Sprint(i), false)), string(pending[2*i+1].Wait()))
+	}
+}
+
+func TestDispatcher_keylessAndArityErrors(t *testing.T) {
+	d := NewDispatcher(2)
+	defer d.Close()
+
+	assert.Equal(t, "+PONG\r\n", string(d.Execute(&Command{Cmd: "PING"})))
+	res := d.Execute(&Command{Cmd: "GET"})
+	assert.Contains(t, string(res), "wrong number of arguments for 'GET' command")
+}
+
+func TestDispatcher_INFO(t *testing.T) {
+	d := NewDispatcher(2)
+	defer d.Close()
+
+	start := time.Now()
+	d.SampleStats(start)
+	for i := 0; i < 9; i++ {
+		d.Execute(&Command{Cmd: "PING"})
+	}
+	d.SampleStats(start.Add(100 * time.Millisecond))
+
+	res := string(d.Execute(&Command{Cmd: "INFO"}))
+	assert.Contains(t, res, "shards:2\r\n")
+	assert.Contains(t, res, "total_commands_processed:10\r\n")
+	// 9 commands in 100ms is 90 ops/sec, averaged over statsMetricSamples.
+	assert.Contains(t, res, fmt.Sprintf("instantaneous_ops_per_sec:%d\r\n", 90/statsMetricSamples))
+}
+
+func TestDispatcher_multiKeyStringCommandsAcrossShards(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	var args, keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		keys = append(keys, key)
+		args = append(args, key, fmt.Sprint(i))
+	}
+	assert.Equal(t, "+OK\r\n", string(d.Execute(&Command{Cmd: "MSET", Args: args})))
+	assert.Equal(t, int64(20), d.dirty())
+
+	res := d.Execute(&Command{Cmd: "MGET", Args: []string{"key:3", "missing", "key:19", "key:0"}})
+	assert.Equal(t, string(Encode([]interface{}{"3", nil, "19", "0"}, false)), string(res))
+
+	// MSETNX writes nothing, on any shard, if one of its keys exists.
+	res = d.Execute(&Command{Cmd: "MSETNX", Args: []string{"new:1", "a", "new:2", "b", "key:7", "c"}})
+	assert.Equal(t, ":0\r\n", string(res))
+	assert.Equal(t, ":0\r\n", string(d.Execute(&Command{Cmd: "EXISTS", Args: []string{"new:1", "new:2"}})))
+	assert.Equal(t, string(Encode("7", false)), string(d.Execute(&Command{Cmd: "GET", Args: []string{"key:7"}})))
+
+	res = d.Execute(&Command{Cmd: "MSETNX", Args: []string{"new:1", "a", "new:2", "b", "new:3", "c"}})
+	assert.Equal(t, ":1\r\n", string(res))
+	assert.Equal(t, ":3\r\n", string(d.Execute(&Command{Cmd: "EXISTS", Args: []string{"new:1", "new:2", "new:3"}})))
+
+	res = d.Execute(&Command{Cmd: "MSET", Args: []string{"key:1", "a", "key:2"}})
+	assert.Contains(t, string(res), "wrong number of arguments for 'MSET' command")
+}
+
+func TestDispatcher_MSETIsAtomicAcrossShards(t *testing.T) {
+	d := NewDispatcher(4)
+	defer d.Close()
+
+	// Writers set every key to the same value while a reader checks that it
+	// never sees a mix of two writes.
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	done := make(chan struct{})
+	var writers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				var args []string
+				for _, key := range keys {
+					args = append(args, key, fmt.Sprintf("%d-%d", w, i))
+				}
+				d.Execute(&Command{Cmd: "MSET", Args: args})
+			}
+		}()
+	}
+	defer writers.Wait()
+	defer close(done)
+
+	d.Execute(&Command{Cmd: "MSET", Args: []string{"a", "0", "b", "0", "c", "0", "d", "0", "e", "0", "f", "0", "g", "0", "h", "0"}})
+	for i := 0; i < 200; i++ {
+		res, err := Decode(d.Execute(&Command{Cmd: "MGET", Args: keys}))
+		assert.NoError(t, err)
+		values := res.([]interface{})
+		for _, v := range values {
+			assert.Equal(t, values[0], v)
+		}
+	}
+}
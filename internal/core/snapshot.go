@@ -0,0 +1,188 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+)
+
+var errBgSaveInProgress = errors.New("ERR Background save already in progress")
+
+// snapshotState tracks the snapshots taken by a dispatcher. It is shared by
+// every reactor, so all fields are atomic.
+type snapshotState struct {
+	lastSave       atomic.Int64 // unix seconds of the last successful save
+	lastSaveOK     atomic.Bool
+	lastAttempt    atomic.Int64 // unix seconds of the last save attempt
+	dirtyAtSave    atomic.Int64 // total dirty count covered by the last save
+	bgSaveInFlight atomic.Bool
+}
+
+// lockShards parks the worker of every given shard, so the caller has
+// exclusive access to their storages until it calls the returned function.
+// Shards are taken one at a time in id order: waiting for each park before
+// queueing the next keeps two concurrent callers from deadlocking, and tasks
+// queued earlier on a shard still run before the caller gets it.
+func (d *Dispatcher) lockShards(shards []*Shard) (unlock func()) {
+	release := make(chan struct{})
+	for _, sh := range shards {
+		parked := make(chan struct{})
+		sh.tasks <- &task{run: func(*Storage) []byte {
+			close(parked)
+			<-release
+			return nil
+		}}
+		<-parked
+	}
+	return func() { close(release) }
+}
+
+func (d *Dispatcher) storages() []*Storage {
+	storages := make([]*Storage, len(d.shards))
+	for i, sh := range d.shards {
+		storages[i] = sh.storage
+	}
+	return storages
+}
+
+// dirty is the total number of changes made to the keyspace since startup.
+func (d *Dispatcher) dirty() int64 {
+	var total int64
+	for _, sh := range d.shards {
+		total += sh.storage.dirty.Load()
+	}
+	return total
+}
+
+// snapshot takes a point in time encoding of the whole keyspace. Go can't
+// fork, so instead of a copy-on-write child the shards are paused while they
+// are encoded to memory; writing the file can then happen without them.
+func (d *Dispatcher) snapshot() ([]byte, int64, error) {
+	unlock := d.lockShards(d.shards)
+	defer unlock()
+	dirty := d.dirty()
+	data, err := encodeRdb(d.storages())
+	return data, dirty, err
+}
+
+func snapshotPath() string {
+	return filepath.Join(config.Dir, config.DbFilename)
+}
+
+// writeSnapshotFile replaces the snapshot file atomically: the data goes to a
+// temporary file that is synced and then renamed over the old one.
+func writeSnapshotFile(data []byte) error {
+	tmp := filepath.Join(config.Dir, fmt.Sprintf("temp-%d-%d.rdb", os.Getpid(), time.Now().UnixNano()))
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, snapshotPath())
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+func (d *Dispatcher) finishSave(dirty int64, err error) {
+	now := time.Now().Unix()
+	d.snapshots.lastAttempt.Store(now)
+	d.snapshots.lastSaveOK.Store(err == nil)
+	if err != nil {
+		log.Println("snapshot failed:", err)
+		return
+	}
+	d.snapshots.lastSave.Store(now)
+	d.snapshots.dirtyAtSave.Store(dirty)
+	log.Println("DB saved on disk")
+}
+
+// Save writes a snapshot and returns once it is on disk.
+func (d *Dispatcher) Save() error {
+	if d.snapshots.bgSaveInFlight.Load() {
+		return errBgSaveInProgress
+	}
+	data, dirty, err := d.snapshot()
+	if err == nil {
+		err = writeSnapshotFile(data)
+	}
+	d.finishSave(dirty, err)
+	return err
+}
+
+// BgSave takes a snapshot and writes it to disk in the background.
+func (d *Dispatcher) BgSave() error {
+	if !d.snapshots.bgSaveInFlight.CompareAndSwap(false, true) {
+		return errBgSaveInProgress
+	}
+	data, dirty, err := d.snapshot()
+	if err != nil {
+		d.snapshots.bgSaveInFlight.Store(false)
+		d.finishSave(dirty, err)
+		return err
+	}
+	go func() {
+		defer d.snapshots.bgSaveInFlight.Store(false)
+		d.finishSave(dirty, writeSnapshotFile(data))
+	}()
+	return nil
+}
+
+// SaveCron starts a background save when one of config.SaveRules is met. The
+// event loop calls it on a timer.
+func (d *Dispatcher) SaveCron(now time.Time) {
+	if d.snapshots.bgSaveInFlight.Load() {
+		return
+	}
+	// Don't hammer a failing disk: retry only after a delay.
+	if !d.snapshots.lastSaveOK.Load() &&
+		now.Unix()-d.snapshots.lastAttempt.Load() < int64(constant.SaveRetryDelay/time.Second) {
+		return
+	}
+	changes := d.dirty() - d.snapshots.dirtyAtSave.Load()
+	elapsed := now.Unix() - d.snapshots.lastSave.Load()
+	for _, rule := range config.SaveRules {
+		if changes >= int64(rule.Changes) && elapsed >= int64(rule.Seconds) {
+			log.Printf("%d changes in %d seconds. Saving...", rule.Changes, rule.Seconds)
+			_ = d.BgSave()
+			return
+		}
+	}
+}
+
+// LoadSnapshot fills the shards from the snapshot file, if there is one.
+func (d *Dispatcher) LoadSnapshot() error {
+	data, err := os.ReadFile(snapshotPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	unlock := d.lockShards(d.shards)
+	defer unlock()
+	start := time.Now()
+	loaded, err := decodeRdb(data, func(key string) *Storage {
+		return d.shardOf(key).storage
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("DB loaded from disk: %d keys in %v", loaded, time.Since(start))
+	return nil
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsMetricSamples is how many samples the instantaneous metrics average.
+const statsMetricSamples = 16
+
+// stats are server wide counters. Counters are bumped by every I/O thread, so
+// they are atomic; the samples are only touched by the stats timer and INFO.
+type stats struct {
+	totalCommands atomic.Int64
+
+	mu              sync.Mutex
+	lastSampleTime  time.Time
+	lastSampleCount int64
+	opsSamples      [statsMetricSamples]int64
+	opsSampleIdx    int
+}
+
+// sample records the command rate since the previous sample, the same way
+// Redis tracks instantaneous_ops_per_sec.
+func (st *stats) sample(now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	count := st.totalCommands.Load()
+	if !st.lastSampleTime.IsZero() {
+		elapsed := now.Sub(st.lastSampleTime).Milliseconds()
+		if elapsed > 0 {
+			st.opsSamples[st.opsSampleIdx] = (count - st.lastSampleCount) * 1000 / elapsed
+			st.opsSampleIdx = (st.opsSampleIdx + 1) % statsMetricSamples
+		}
+	}
+	st.lastSampleTime = now
+	st.lastSampleCount = count
+}
+
+func (st *stats) instantaneousOps() int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var sum int64
+	for _, v := range st.opsSamples {
+		sum += v
+	}
+	return sum / statsMetricSamples
+}
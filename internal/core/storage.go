@@ -1,17 +1,45 @@
 package core
 
-import "github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+import (
+	"container/list"
+	"sync/atomic"
 
-var dictStore *data_structure.Dict
-var setStore map[string]*data_structure.SimpleSet
-var zsetStore map[string]*data_structure.SortedSet
-var cmsStore map[string]*data_structure.CMS
-var bloomStore map[string]*data_structure.Bloom
+	"github.com/thaison199py/multi-threaded-redis/internal/data_structure"
+)
 
-func init() {
-	dictStore = data_structure.CreateDict()
-	setStore = make(map[string]*data_structure.SimpleSet)
-	zsetStore = make(map[string]*data_structure.SortedSet)
-	cmsStore = make(map[string]*data_structure.CMS)
-	bloomStore = make(map[string]*data_structure.Bloom)
+// Storage is one partition of the keyspace. Every shard owns exactly one
+// Storage and only the shard's worker goroutine may touch it, so the command
+// handlers defined on it need no locking.
+type Storage struct {
+	// dictStore is the keyspace. Values of every type live in it, tagged
+	// with their data_structure.ObjType, so a key can only hold one of them.
+	dictStore *data_structure.Dict
+
+	// dirty counts the changes made to this storage; every write handler
+	// adds what it changed. It is only written by the owning worker but read
+	// by the snapshot timer, hence atomic.
+	dirty atomic.Int64
+	// aof, when not nil, is where successful write commands are logged.
+	aof *appendOnlyFile
+	// blocking queues, per key, the clients blocked until it holds a list,
+	// in the order they blocked.
+	blocking map[string]*list.List
+	// readyKeys are the keys clients block on that got a list since they
+	// were last served, in the order they got it; readyKeySet dedups them.
+	readyKeys   []string
+	readyKeySet map[string]struct{}
+	// hashFieldExpiries is the set of keys of hashes that have fields with
+	// a TTL, sampled by the active expiry cycle. It may still name keys that
+	// have been deleted or overwritten since; the cycle drops those.
+	hashFieldExpiries map[string]struct{}
+}
+
+func NewStorage() *Storage {
+	return &Storage{
+		dictStore: data_structure.CreateDict(),
+		blocking:  make(map[string]*list.List),
+
+		readyKeySet:       make(map[string]struct{}),
+		hashFieldExpiries: make(map[string]struct{}),
+	}
 }
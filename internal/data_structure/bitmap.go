@@ -0,0 +1,102 @@
+package data_structure
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Bitmaps are plain byte slices addressed as in Redis: bit 0 is the most
+// significant bit of the first byte, so the string "\x80" has only bit 0 set.
+// Reads past the end of the slice see zero bits; callers grow the slice before
+// writing.
+
+// GetBit returns the bit at offset, 0 past the end of b.
+func GetBit(b []byte, offset uint64) int {
+	bytePos := offset >> 3 // div 8
+	if bytePos >= uint64(len(b)) {
+		return 0
+	}
+	return int(b[bytePos]>>(7-offset%8)) & 1
+}
+
+// SetBit sets the bit at offset to value and returns its previous value. The
+// offset must be within b.
+func SetBit(b []byte, offset uint64, value int) int {
+	bytePos := offset >> 3
+	mask := byte(1) << (7 - offset%8)
+	old := 0
+	if b[bytePos]&mask != 0 {
+		old = 1
+	}
+	if value == 1 {
+		b[bytePos] |= mask
+	} else {
+		b[bytePos] &^= mask
+	}
+	return old
+}
+
+// popCount counts the set bits of b a word at a time.
+func popCount(b []byte) int64 {
+	var n int
+	for len(b) >= 8 {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(b))
+		b = b[8:]
+	}
+	for _, c := range b {
+		n += bits.OnesCount8(c)
+	}
+	return int64(n)
+}
+
+// BitCount counts the set bits between the bit offsets start and end, both
+// inclusive and within b.
+func BitCount(b []byte, start, end uint64) int64 {
+	first, last := start>>3, end>>3
+	head := byte(0xff) >> (start % 8)
+	tail := byte(0xff) << (7 - end%8)
+	if first == last {
+		return int64(bits.OnesCount8(b[first] & head & tail))
+	}
+	n := int64(bits.OnesCount8(b[first]&head) + bits.OnesCount8(b[last]&tail))
+	return n + popCount(b[first+1:last])
+}
+
+// BitPos returns the offset of the first bit equal to bit between the bit
+// offsets start and end, both inclusive and within b, or -1 if there is none.
+func BitPos(b []byte, bit int, start, end uint64) int64 {
+	// Whole bytes without the bit we look for are skipped at once.
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for i := start; i <= end; {
+		if i%8 == 0 && i+7 <= end && b[i>>3] == skip {
+			i += 8
+			continue
+		}
+		if GetBit(b, i) == bit {
+			return int64(i)
+		}
+		i++
+	}
+	return -1
+}
+
+// GetBitfield reads the width bits starting at offset as an unsigned
+// integer, most significant bit first. width is at most 64.
+func GetBitfield(b []byte, offset uint64, width uint) uint64 {
+	var v uint64
+	for i := uint64(0); i < uint64(width); i++ {
+		v = v<<1 | uint64(GetBit(b, offset+i))
+	}
+	return v
+}
+
+// SetBitfield writes the low width bits of v starting at offset, most
+// significant bit first. The bits must be within b.
+func SetBitfield(b []byte, offset uint64, width uint, v uint64) {
+	for i := uint64(0); i < uint64(width); i++ {
+		SetBit(b, offset+i, int(v>>(uint64(width)-1-i))&1)
+	}
+}
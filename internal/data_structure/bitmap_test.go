@@ -0,0 +1,64 @@
+package data_structure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAndSetBit(t *testing.T) {
+	b := make([]byte, 2)
+	assert.Equal(t, 0, SetBit(b, 0, 1))
+	assert.Equal(t, 0, SetBit(b, 15, 1))
+	assert.Equal(t, []byte{0x80, 0x01}, b)
+	assert.Equal(t, 1, SetBit(b, 15, 0))
+	assert.Equal(t, []byte{0x80, 0x00}, b)
+
+	assert.Equal(t, 1, GetBit(b, 0))
+	assert.Equal(t, 0, GetBit(b, 1))
+	// Reading past the end sees zeros.
+	assert.Equal(t, 0, GetBit(b, 1000))
+}
+
+func TestBitCount(t *testing.T) {
+	b := []byte("foobar")
+	assert.EqualValues(t, 26, BitCount(b, 0, 47))
+	assert.EqualValues(t, 4, BitCount(b, 0, 7))
+	assert.EqualValues(t, 6, BitCount(b, 8, 15))
+	assert.EqualValues(t, 17, BitCount(b, 5, 30))
+	assert.EqualValues(t, 1, BitCount(b, 2, 2))
+
+	long := make([]byte, 100)
+	for i := range long {
+		long[i] = 0xff
+	}
+	assert.EqualValues(t, 800, BitCount(long, 0, 799))
+	assert.EqualValues(t, 789, BitCount(long, 3, 791))
+}
+
+func TestBitPos(t *testing.T) {
+	assert.EqualValues(t, 12, BitPos([]byte{0xff, 0xf0, 0x00}, 0, 0, 23))
+	assert.EqualValues(t, 8, BitPos([]byte{0x00, 0xff, 0xf0}, 1, 0, 23))
+	assert.EqualValues(t, 16, BitPos([]byte{0x00, 0xff, 0xf0}, 1, 16, 23))
+	assert.EqualValues(t, 9, BitPos([]byte{0x00, 0xff, 0xf0}, 1, 9, 23))
+	assert.EqualValues(t, -1, BitPos([]byte{0x00, 0x00, 0x00}, 1, 0, 23))
+	assert.EqualValues(t, -1, BitPos([]byte{0xff, 0xff}, 0, 0, 15))
+	assert.EqualValues(t, -1, BitPos([]byte{0x00, 0x01}, 1, 0, 14))
+}
+
+func TestBitfield(t *testing.T) {
+	b := make([]byte, 3)
+	SetBitfield(b, 4, 12, 0xabc)
+	assert.Equal(t, []byte{0x0a, 0xbc, 0x00}, b)
+	assert.EqualValues(t, 0xabc, GetBitfield(b, 4, 12))
+	assert.EqualValues(t, 0xb, GetBitfield(b, 8, 4))
+	// Only the low width bits are written.
+	SetBitfield(b, 16, 4, 0xff)
+	assert.Equal(t, byte(0xf0), b[2])
+	// Reading past the end sees zeros.
+	assert.EqualValues(t, 0xf00, GetBitfield(b, 16, 12))
+
+	full := make([]byte, 8)
+	SetBitfield(full, 0, 64, 0x0123456789abcdef)
+	assert.EqualValues(t, uint64(0x0123456789abcdef), GetBitfield(full, 0, 64))
+}
@@ -1,6 +1,8 @@
 package data_structure
 
 import (
+	"encoding/binary"
+	"errors"
 	"github.com/spaolacci/murmur3"
 	"math"
 )
@@ -106,3 +108,29 @@ func (b *Bloom) ExistHash(initHash HashValue) bool {
 	}
 	return true
 }
+
+// MarshalBinary encodes the filter parameters followed by its bit array. The
+// remaining fields are derived from the parameters when the filter is restored.
+func (b *Bloom) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 16+len(b.bf))
+	binary.LittleEndian.PutUint64(data[0:], b.Entries)
+	binary.LittleEndian.PutUint64(data[8:], math.Float64bits(b.Error))
+	copy(data[16:], b.bf)
+	return data, nil
+}
+
+// UnmarshalBinary restores a filter produced by MarshalBinary.
+func (b *Bloom) UnmarshalBinary(data []byte) error {
+	if len(data) < 16 {
+		return errors.New("bloom: truncated data")
+	}
+	entries := binary.LittleEndian.Uint64(data[0:])
+	errRate := math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))
+	restored := CreateBloomFilter(entries, errRate)
+	if len(restored.bf) != len(data)-16 {
+		return errors.New("bloom: bit array size does not match parameters")
+	}
+	copy(restored.bf, data[16:])
+	*b = *restored
+	return nil
+}
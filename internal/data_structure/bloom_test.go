@@ -46,3 +46,23 @@ func TestBloom_CreateBloomFilter(t *testing.T) {
 	assert.EqualValues(t, 120, b.bytes)
 	assert.EqualValues(t, 7, b.Hashes) // hashes = bitPerEntry * ln(2) = 9.58496 * 0.693 = 6.639 -> ceil(6.639) = 7
 }
+
+func TestBloom_MarshalBinary(t *testing.T) {
+	b := CreateBloomFilter(100, 0.01)
+	b.Add("a")
+	b.Add("b")
+
+	data, err := b.MarshalBinary()
+	assert.NoError(t, err)
+
+	var restored Bloom
+	assert.NoError(t, restored.UnmarshalBinary(data))
+	assert.EqualValues(t, b.Entries, restored.Entries)
+	assert.EqualValues(t, b.Error, restored.Error)
+	assert.Equal(t, b.Hashes, restored.Hashes)
+	assert.Equal(t, b.bf, restored.bf)
+	assert.True(t, restored.Exist("a"))
+	assert.True(t, restored.Exist("b"))
+
+	assert.Error(t, restored.UnmarshalBinary(data[:len(data)-8]))
+}
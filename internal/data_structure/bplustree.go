@@ -28,6 +28,8 @@ type Node struct {
 	IsLeaf   bool    // True if it's a leaf node
 	Parent   *Node   // Pointer to the parent node
 	Next     *Node   // For leaf nodes, a pointer to the next leaf in the sequence
+	Prev     *Node   // For leaf nodes, a pointer to the previous leaf in the sequence
+	Size     int     // The number of items in the leaves of the subtree, for ranks
 }
 
 type BPlusTree struct {
@@ -42,59 +44,38 @@ func NewBPlusTree(degree int) *BPlusTree {
 	}
 }
 
-func (t *BPlusTree) Score(member string) (float64, bool) {
-	node := t.Root
-	// Traverse to the first leaf node.
-	// We have to search all leaf nodes since we don't know the score.
-	for !node.IsLeaf {
-		node = node.Children[0] // Always go to the leftmost child
-	}
-
-	// Iterate through all leaf nodes using the 'Next' pointer
-	for node != nil {
-		// Iterate through all items in the current leaf node
-		for _, item := range node.Items {
-			if item.Member == member {
-				return item.Score, true
-			}
-		}
-		node = node.Next
-	}
-
-	return 0, false // Member not found
-}
-
+// Add inserts the item with the given score and member and returns 1, or 0
+// when the tree already holds it. The tree knows nothing of the other scores
+// of member, so changing the score of a member means removing the item with
+// the old score first; SortedSet takes care of it.
 func (t *BPlusTree) Add(score float64, member string) int {
 	item := &Item{Score: score, Member: member}
 
-	if len(member) == 0 {
-		return 0
-	}
 	// Find the correct leaf to insert into
+	// Items are ordered by score, then member, so that members with the same
+	// score come in lexicographical order like in Redis.
 	node := t.Root
 	for !node.IsLeaf {
-		// Find the correct child based on the score
+		// Find the correct child based on the score and member
 		i := 0
-		for i < len(node.Items) && score >= node.Items[i].Score {
+		for i < len(node.Items) && item.CompareTo(node.Items[i]) >= 0 {
 			i++
 		}
 		node = node.Children[i]
 	}
 
-	// Check if the member already exists in the leaf node.
-	for i, existingItem := range node.Items {
-		if existingItem.Member == member {
-			node.Items[i].Score = score
-			return 1
-		}
-	}
-
-	// Member does not exist, insert it into the sorted position.
+	// Insert it into the sorted position, unless it is already there.
 	i := 0
-	for i < len(node.Items) && score >= node.Items[i].Score {
+	for i < len(node.Items) && item.CompareTo(node.Items[i]) >= 0 {
 		i++
 	}
+	if i > 0 && item.CompareTo(node.Items[i-1]) == 0 {
+		return 0
+	}
 	node.Items = append(node.Items[:i], append([]*Item{item}, node.Items[i:]...)...)
+	for n := node; n != nil; n = n.Parent {
+		n.Size++
+	}
 
 	// Split the node if it's over capacity.
 	if len(node.Items) > t.Degree-1 {
@@ -127,12 +108,18 @@ func (t *BPlusTree) splitLeaf(node *Node) {
 		IsLeaf: true,
 		Parent: node.Parent,
 		Next:   node.Next,
+		Prev:   node,
 	}
 
 	// Move the second half of the items to the new leaf.
 	newLeaf.Items = append(newLeaf.Items, node.Items[medianIndex:]...)
 	node.Items = node.Items[:medianIndex]
-	// Update the 'Next' pointer for sequential traversal.
+	newLeaf.Size = len(newLeaf.Items)
+	node.Size = len(node.Items)
+	// Update the 'Next' and 'Prev' pointers for sequential traversal.
+	if node.Next != nil {
+		node.Next.Prev = newLeaf
+	}
 	node.Next = newLeaf
 
 	// Promote the first key of the new leaf to the parent.
@@ -178,10 +165,12 @@ func (t *BPlusTree) splitInternal(node *Node) {
 	node.Items = node.Items[:medianIndex]
 	node.Children = node.Children[:medianIndex+1]
 
-	// Update parent pointers for the new children.
+	// Update parent pointers and sizes for the new children.
 	for _, child := range newInternal.Children {
 		child.Parent = newInternal
+		newInternal.Size += child.Size
 	}
+	node.Size -= newInternal.Size
 
 	// Now, insert the promoted key and the new node into the parent.
 	parent := node.Parent
@@ -206,7 +195,7 @@ func (t *BPlusTree) splitInternal(node *Node) {
 
 func (t *BPlusTree) splitRoot() {
 	oldRoot := t.Root
-	newRoot := &Node{}
+	newRoot := &Node{Size: oldRoot.Size}
 
 	// Create a new root and set the old root as its first child.
 	t.Root = newRoot
@@ -221,26 +210,398 @@ func (t *BPlusTree) splitRoot() {
 	}
 }
 
-func (t *BPlusTree) GetRank(member string) int {
+// Remove deletes the item with the given score and member and reports
+// whether it was there.
+//
+// A node left with fewer than minItems items borrows one from a sibling that
+// can spare it or, when neither can, is merged with one, which takes a
+// separator away from the parent, whose own shortage is handled the same
+// way up to the root. The root loses a level once it has a single child.
+// Separators of internal nodes may outlive the items they were copied from;
+// they still split the items between the children correctly.
+func (t *BPlusTree) Remove(score float64, member string) bool {
+	item := &Item{Score: score, Member: member}
+	node := t.Root
+	for !node.IsLeaf {
+		i := 0
+		for i < len(node.Items) && item.CompareTo(node.Items[i]) >= 0 {
+			i++
+		}
+		node = node.Children[i]
+	}
+
+	i := 0
+	for i < len(node.Items) && item.CompareTo(node.Items[i]) > 0 {
+		i++
+	}
+	if i == len(node.Items) || item.CompareTo(node.Items[i]) != 0 {
+		return false
+	}
+	node.Items = append(node.Items[:i], node.Items[i+1:]...)
+	for n := node; n != nil; n = n.Parent {
+		n.Size--
+	}
+
+	if node != t.Root && len(node.Items) < t.minItems(node) {
+		t.rebalance(node)
+	}
+	return true
+}
+
+// minItems is the fewest items a node other than the root holds, which is
+// what the smaller half of a split gets.
+func (t *BPlusTree) minItems(node *Node) int {
+	if node.IsLeaf {
+		return t.Degree / 2
+	}
+	return (t.Degree - 1) / 2
+}
+
+// childIndex returns the position of node among the children of its parent.
+func childIndex(node *Node) int {
+	parent := node.Parent
+	for i, child := range parent.Children {
+		if child == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// rebalance brings node, which isn't the root and is short of items, back to
+// at least minItems.
+func (t *BPlusTree) rebalance(node *Node) {
+	parent := node.Parent
+	index := childIndex(node)
+
+	if index > 0 {
+		if left := parent.Children[index-1]; len(left.Items) > t.minItems(left) {
+			t.borrowFromLeft(node, left, index-1)
+			return
+		}
+	}
+	if index < len(parent.Children)-1 {
+		if right := parent.Children[index+1]; len(right.Items) > t.minItems(right) {
+			t.borrowFromRight(node, right, index)
+			return
+		}
+	}
+
+	if index > 0 {
+		t.merge(parent.Children[index-1], node, index-1)
+	} else {
+		t.merge(node, parent.Children[index+1], index)
+	}
+
+	if parent == t.Root {
+		if len(parent.Items) == 0 {
+			t.Root = parent.Children[0]
+			t.Root.Parent = nil
+		}
+	} else if len(parent.Items) < t.minItems(parent) {
+		t.rebalance(parent)
+	}
+}
+
+// borrowFromLeft moves the last item of left, the sibling before node, to
+// node; separator is the position in the parent of the separator between
+// them.
+func (t *BPlusTree) borrowFromLeft(node, left *Node, separator int) {
+	parent := node.Parent
+	last := len(left.Items) - 1
+	if node.IsLeaf {
+		node.Items = append([]*Item{left.Items[last]}, node.Items...)
+		left.Items = left.Items[:last]
+		node.Size++
+		left.Size--
+		parent.Items[separator] = node.Items[0]
+		return
+	}
+
+	// The separator comes down in front of node and the last item of left
+	// goes up in its place, along with the last child of left.
+	child := left.Children[len(left.Children)-1]
+	node.Items = append([]*Item{parent.Items[separator]}, node.Items...)
+	node.Children = append([]*Node{child}, node.Children...)
+	child.Parent = node
+	node.Size += child.Size
+	left.Size -= child.Size
+	parent.Items[separator] = left.Items[last]
+	left.Items = left.Items[:last]
+	left.Children = left.Children[:len(left.Children)-1]
+}
+
+// borrowFromRight is borrowFromLeft the other way round.
+func (t *BPlusTree) borrowFromRight(node, right *Node, separator int) {
+	parent := node.Parent
+	if node.IsLeaf {
+		node.Items = append(node.Items, right.Items[0])
+		right.Items = right.Items[1:]
+		node.Size++
+		right.Size--
+		parent.Items[separator] = right.Items[0]
+		return
+	}
+
+	child := right.Children[0]
+	node.Items = append(node.Items, parent.Items[separator])
+	node.Children = append(node.Children, child)
+	child.Parent = node
+	node.Size += child.Size
+	right.Size -= child.Size
+	parent.Items[separator] = right.Items[0]
+	right.Items = right.Items[1:]
+	right.Children = right.Children[1:]
+}
+
+// merge moves everything in right into left, its sibling before it, and
+// removes right and the separator between them from the parent.
+func (t *BPlusTree) merge(left, right *Node, separator int) {
+	parent := left.Parent
+	if left.IsLeaf {
+		left.Items = append(left.Items, right.Items...)
+		left.Next = right.Next
+		if right.Next != nil {
+			right.Next.Prev = left
+		}
+	} else {
+		left.Items = append(append(left.Items, parent.Items[separator]), right.Items...)
+		for _, child := range right.Children {
+			child.Parent = left
+		}
+		left.Children = append(left.Children, right.Children...)
+	}
+	left.Size += right.Size
+	parent.Items = append(parent.Items[:separator], parent.Items[separator+1:]...)
+	parent.Children = append(parent.Children[:separator+1], parent.Children[separator+2:]...)
+}
+
+// Len returns the number of items in the tree.
+func (t *BPlusTree) Len() int {
+	return t.Root.Size
+}
+
+// Rank returns the rank of the item with the given score and member, the
+// lowest item having rank 0, or -1 when there is no such item. The sizes of
+// the children left of the path to the item add up to the items before it,
+// so this is O(log n).
+func (t *BPlusTree) Rank(score float64, member string) int {
+	item := &Item{Score: score, Member: member}
 	rank := 0
+	node := t.Root
+	for !node.IsLeaf {
+		i := 0
+		for i < len(node.Items) && item.CompareTo(node.Items[i]) >= 0 {
+			rank += node.Children[i].Size
+			i++
+		}
+		node = node.Children[i]
+	}
+	for i, existing := range node.Items {
+		if item.CompareTo(existing) == 0 {
+			return rank + i
+		}
+	}
+	return -1
+}
+
+// ScoreBound is one end of a range of scores. -inf and +inf are plain
+// infinite values.
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+// ScoreRange is the range of scores from Min to Max.
+type ScoreRange struct {
+	Min, Max ScoreBound
+}
+
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.Min.Exclusive {
+		return score > r.Min.Value
+	}
+	return score >= r.Min.Value
+}
 
-	// Find the first leaf node
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.Max.Exclusive {
+		return score < r.Max.Value
+	}
+	return score <= r.Max.Value
+}
+
+// LexBound is one end of a range of members. Inf is -1 for the bound below
+// every member and 1 for the one above every member, in which case Value
+// and Exclusive don't matter.
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	Inf       int
+}
+
+// LexRange is the range of members from Min to Max. Like in Redis, it only
+// makes sense when every member has the same score.
+type LexRange struct {
+	Min, Max LexBound
+}
+
+func (r LexRange) aboveMin(member string) bool {
+	switch {
+	case r.Min.Inf != 0:
+		return r.Min.Inf < 0
+	case r.Min.Exclusive:
+		return member > r.Min.Value
+	default:
+		return member >= r.Min.Value
+	}
+}
+
+func (r LexRange) belowMax(member string) bool {
+	switch {
+	case r.Max.Inf != 0:
+		return r.Max.Inf > 0
+	case r.Max.Exclusive:
+		return member < r.Max.Value
+	default:
+		return member <= r.Max.Value
+	}
+}
+
+// cursor is a position among the items of the leaves; node is nil once it
+// has moved past either end.
+type cursor struct {
+	node *Node
+	i    int
+}
+
+func (c *cursor) item() *Item {
+	if c.node == nil {
+		return nil
+	}
+	return c.node.Items[c.i]
+}
+
+func (c *cursor) next() {
+	c.i++
+	for c.node != nil && c.i >= len(c.node.Items) {
+		c.node = c.node.Next
+		c.i = 0
+	}
+}
+
+func (c *cursor) prev() {
+	c.i--
+	for c.node != nil && c.i < 0 {
+		c.node = c.node.Prev
+		if c.node != nil {
+			c.i = len(c.node.Items) - 1
+		}
+	}
+}
+
+// seekFirst returns the cursor at the first item for which after holds,
+// where after is false up to some item and true from there on.
+//
+// Every item of the subtree right of a separator is at least the separator,
+// and every item left of it is below it, so the descent skips the children
+// left of the separators after rejects. The first item may still be further
+// right than the leaf reached, when the separators have been kept from items
+// that are gone, hence the walk along the leaves.
+func (t *BPlusTree) seekFirst(after func(*Item) bool) cursor {
 	node := t.Root
 	for !node.IsLeaf {
-		node = node.Children[0] // Always go to the leftmost child
+		i := 0
+		for i < len(node.Items) && !after(node.Items[i]) {
+			i++
+		}
+		node = node.Children[i]
+	}
+	c := cursor{node: node, i: -1}
+	for c.next(); c.node != nil && !after(c.item()); c.next() {
 	}
+	return c
+}
 
-	// Traverse all leaf nodes from the beginning
-	for node != nil {
-		for _, item := range node.Items {
-			// Check if we have found the member
-			if item.Member == member {
-				return rank // Return the current rank
-			}
-			rank++
+// seekLast returns the cursor at the last item for which before holds, where
+// before is true up to some item and false from there on.
+func (t *BPlusTree) seekLast(before func(*Item) bool) cursor {
+	node := t.Root
+	for !node.IsLeaf {
+		i := 0
+		for i < len(node.Items) && before(node.Items[i]) {
+			i++
 		}
-		node = node.Next
+		node = node.Children[i]
+	}
+	c := cursor{node: node, i: len(node.Items)}
+	for c.prev(); c.node != nil && !before(c.item()); c.prev() {
 	}
+	return c
+}
 
-	return -1 // Member not found
+// collect walks from c, backwards when reverse, while in holds, skipping
+// the first offset items and returning at most count of the others; a
+// negative count returns them all.
+func collect(c cursor, in func(*Item) bool, offset, count int, reverse bool) []*Item {
+	var items []*Item
+	for ; c.node != nil && count != 0 && in(c.item()); offset-- {
+		if offset <= 0 {
+			items = append(items, c.item())
+			count--
+		}
+		if reverse {
+			c.prev()
+		} else {
+			c.next()
+		}
+	}
+	return items
+}
+
+// RangeByScore returns the items with a score in r by ascending order, or
+// descending when reverse, skipping the first offset and keeping at most
+// count of them; a negative count keeps them all.
+func (t *BPlusTree) RangeByScore(r ScoreRange, offset, count int, reverse bool) []*Item {
+	if reverse {
+		c := t.seekLast(func(item *Item) bool { return r.belowMax(item.Score) })
+		return collect(c, func(item *Item) bool { return r.aboveMin(item.Score) }, offset, count, true)
+	}
+	c := t.seekFirst(func(item *Item) bool { return r.aboveMin(item.Score) })
+	return collect(c, func(item *Item) bool { return r.belowMax(item.Score) }, offset, count, false)
+}
+
+// RangeByLex is RangeByScore for a range of members.
+func (t *BPlusTree) RangeByLex(r LexRange, offset, count int, reverse bool) []*Item {
+	if reverse {
+		c := t.seekLast(func(item *Item) bool { return r.belowMax(item.Member) })
+		return collect(c, func(item *Item) bool { return r.aboveMin(item.Member) }, offset, count, true)
+	}
+	c := t.seekFirst(func(item *Item) bool { return r.aboveMin(item.Member) })
+	return collect(c, func(item *Item) bool { return r.belowMax(item.Member) }, offset, count, false)
+}
+
+// RangeByRank returns the items from rank start to rank stop included, where
+// the lowest item has rank 0. The ranks must be in range.
+func (t *BPlusTree) RangeByRank(start, stop int) []*Item {
+	all := func(*Item) bool { return true }
+	return collect(t.seekRank(start), all, 0, stop-start+1, false)
+}
+
+// seekRank returns the cursor at the item of the given rank, going down the
+// child whose subtree holds it at each level.
+func (t *BPlusTree) seekRank(rank int) cursor {
+	if rank < 0 || rank >= t.Len() {
+		return cursor{}
+	}
+	node := t.Root
+	for !node.IsLeaf {
+		i := 0
+		for rank >= node.Children[i].Size {
+			rank -= node.Children[i].Size
+			i++
+		}
+		node = node.Children[i]
+	}
+	return cursor{node: node, i: rank}
 }
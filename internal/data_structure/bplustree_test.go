@@ -1,6 +1,9 @@
 package data_structure
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -18,45 +21,277 @@ func TestNewBPlusTree(t *testing.T) {
 	assert.Len(t, bt.Root.Children, 0)
 }
 
-func TestBPlusTree_AddAndScore(t *testing.T) {
+func TestBPlusTree_AddAndRank(t *testing.T) {
 	degree := 3
 	bt := NewBPlusTree(degree)
 
-	bt.Add(10.0, "member1")
-	bt.Add(20.0, "member2")
-	bt.Add(5.0, "member3")
+	bt.Add(10.0, "memberA")
+	bt.Add(20.0, "memberB")
+	bt.Add(5.0, "memberC")
+	bt.Add(15.0, "memberD")
 
-	score, found := bt.Score("member1")
-	assert.True(t, found)
-	assert.Equal(t, 10.0, score)
+	// memberC (5.0), memberA (10.0), memberD (15.0), memberB (20.0)
+	assert.Equal(t, 4, bt.Len())
+	assert.Equal(t, 0, bt.Rank(5.0, "memberC"))
+	assert.Equal(t, 1, bt.Rank(10.0, "memberA"))
+	assert.Equal(t, 2, bt.Rank(15.0, "memberD"))
+	assert.Equal(t, 3, bt.Rank(20.0, "memberB"))
+	assert.Equal(t, -1, bt.Rank(10.0, "non_existent_member"))
+	assert.Equal(t, -1, bt.Rank(11.0, "memberA"))
+}
+
+// members returns the members of items in order.
+func members(items []*Item) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.Member)
+	}
+	return out
+}
 
-	score, found = bt.Score("member2")
-	assert.True(t, found)
-	assert.Equal(t, 20.0, score)
+func TestBPlusTree_orderWithEqualScores(t *testing.T) {
+	bt := NewBPlusTree(3)
+	for _, m := range []string{"d", "b", "e", "a", "c"} {
+		bt.Add(1, m)
+	}
+	bt.Add(0, "z")
+	assert.Equal(t, 0, bt.Add(1, "c"))
+	assert.Equal(t, []string{"z", "a", "b", "c", "d", "e"}, members(bt.RangeByRank(0, 5)))
+}
 
-	score, found = bt.Score("member3")
-	assert.True(t, found)
-	assert.Equal(t, 5.0, score)
+func TestBPlusTree_RangeByScore(t *testing.T) {
+	bt := NewBPlusTree(3)
+	// Scores 0, 0.5, 1, ..., 49.5, added out of order.
+	var all []string
+	for i := 0; i < 100; i++ {
+		all = append(all, fmt.Sprintf("m%03d", i))
+	}
+	for _, i := range rand.New(rand.NewSource(1)).Perm(100) {
+		bt.Add(float64(i)/2, all[i])
+	}
 
-	_, found = bt.Score("non_existent_member")
-	assert.False(t, found)
+	inf := math.Inf(1)
+	testCases := []struct {
+		name          string
+		r             ScoreRange
+		offset, count int
+		reverse       bool
+		want          []string
+	}{
+		{"everything", ScoreRange{ScoreBound{Value: -inf}, ScoreBound{Value: inf}}, 0, -1, false, all},
+		{"inclusive", ScoreRange{ScoreBound{Value: 10}, ScoreBound{Value: 12}}, 0, -1, false, all[20:25]},
+		{"exclusive", ScoreRange{ScoreBound{10, true}, ScoreBound{12, true}}, 0, -1, false, all[21:24]},
+		{"between scores", ScoreRange{ScoreBound{Value: 10.2}, ScoreBound{Value: 11.2}}, 0, -1, false, all[21:23]},
+		{"limit", ScoreRange{ScoreBound{Value: 10}, ScoreBound{Value: inf}}, 3, 4, false, all[23:27]},
+		{"limit past the end", ScoreRange{ScoreBound{Value: 49}, ScoreBound{Value: inf}}, 1, 10, false, all[99:]},
+		{"empty", ScoreRange{ScoreBound{Value: 12}, ScoreBound{Value: 10}}, 0, -1, false, []string{}},
+		{"above everything", ScoreRange{ScoreBound{Value: 50}, ScoreBound{Value: inf}}, 0, -1, false, []string{}},
+		{"reverse", ScoreRange{ScoreBound{10, true}, ScoreBound{Value: 12}}, 0, -1, true, []string{"m024", "m023", "m022", "m021"}},
+		{"reverse limit", ScoreRange{ScoreBound{Value: -inf}, ScoreBound{Value: inf}}, 1, 2, true, []string{"m098", "m097"}},
+		{"reverse below everything", ScoreRange{ScoreBound{Value: -inf}, ScoreBound{0, true}}, 0, -1, true, []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, members(bt.RangeByScore(tc.r, tc.offset, tc.count, tc.reverse)))
+		})
+	}
 }
 
-func TestBPlusTree_GetRank(t *testing.T) {
-	degree := 3
-	bt := NewBPlusTree(degree)
+func TestBPlusTree_RangeByLex(t *testing.T) {
+	bt := NewBPlusTree(3)
+	for _, m := range []string{"g", "c", "a", "f", "b", "e", "d"} {
+		bt.Add(0, m)
+	}
+	all := LexRange{LexBound{Inf: -1}, LexBound{Inf: 1}}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f", "g"}, members(bt.RangeByLex(all, 0, -1, false)))
+	assert.Equal(t, []string{"f", "e"}, members(bt.RangeByLex(all, 1, 2, true)))
+	assert.Equal(t, []string{"b", "c", "d"},
+		members(bt.RangeByLex(LexRange{LexBound{Value: "b"}, LexBound{Value: "d"}}, 0, -1, false)))
+	assert.Equal(t, []string{"c"},
+		members(bt.RangeByLex(LexRange{LexBound{Value: "b", Exclusive: true}, LexBound{Value: "d", Exclusive: true}}, 0, -1, false)))
+	assert.Equal(t, []string{"g", "f"},
+		members(bt.RangeByLex(LexRange{LexBound{Value: "ea"}, LexBound{Inf: 1}}, 0, -1, true)))
+}
 
-	bt.Add(10.0, "memberA")
-	bt.Add(20.0, "memberB")
-	bt.Add(5.0, "memberC")
-	bt.Add(15.0, "memberD")
+func TestBPlusTree_RangeByRank(t *testing.T) {
+	bt := NewBPlusTree(3)
+	for i := 0; i < 20; i++ {
+		bt.Add(float64(i), fmt.Sprint(i))
+	}
+	assert.Equal(t, []string{"0"}, members(bt.RangeByRank(0, 0)))
+	assert.Equal(t, []string{"7", "8", "9", "10"}, members(bt.RangeByRank(7, 10)))
+	assert.Equal(t, []string{"18", "19"}, members(bt.RangeByRank(18, 19)))
+}
 
-	// The ranks depend on the order in which elements are stored internally.
-	// For a simple B+ tree without explicit rank tracking, we'll assume a sorted order for verification.
-	// memberC (5.0), memberA (10.0), memberD (15.0), memberB (20.0)
-	assert.Equal(t, 0, bt.GetRank("memberC"))
-	assert.Equal(t, 1, bt.GetRank("memberA"))
-	assert.Equal(t, 2, bt.GetRank("memberD"))
-	assert.Equal(t, 3, bt.GetRank("memberB"))
-	assert.Equal(t, -1, bt.GetRank("non_existent_member"))
+// checkTree fails t unless every structural invariant of bt holds, and
+// returns its items in the order of the leaves.
+func checkTree(t *testing.T, bt *BPlusTree) []*Item {
+	t.Helper()
+	leafDepth := -1
+	var check func(node *Node, depth int, low, high *Item)
+	check = func(node *Node, depth int, low, high *Item) {
+		if node != bt.Root {
+			assert.GreaterOrEqual(t, len(node.Items), bt.minItems(node), "underfull node")
+		}
+		assert.LessOrEqual(t, len(node.Items), bt.Degree-1, "overfull node")
+		for i, item := range node.Items {
+			if i > 0 {
+				assert.Negative(t, node.Items[i-1].CompareTo(item), "items out of order")
+			}
+			if low != nil {
+				assert.GreaterOrEqual(t, item.CompareTo(low), 0, "item below its separator")
+			}
+			if high != nil {
+				assert.Negative(t, item.CompareTo(high), "item above its separator")
+			}
+		}
+		if node.IsLeaf {
+			assert.Equal(t, len(node.Items), node.Size, "wrong leaf size")
+			if leafDepth < 0 {
+				leafDepth = depth
+			}
+			assert.Equal(t, leafDepth, depth, "leaves at different depths")
+			return
+		}
+		assert.Len(t, node.Children, len(node.Items)+1)
+		size := 0
+		for _, child := range node.Children {
+			size += child.Size
+		}
+		assert.Equal(t, size, node.Size, "wrong subtree size")
+		for i, child := range node.Children {
+			assert.Same(t, node, child.Parent)
+			childLow, childHigh := low, high
+			if i > 0 {
+				childLow = node.Items[i-1]
+			}
+			if i < len(node.Items) {
+				childHigh = node.Items[i]
+			}
+			check(child, depth+1, childLow, childHigh)
+		}
+	}
+	check(bt.Root, 0, nil, nil)
+
+	node := bt.Root
+	for !node.IsLeaf {
+		node = node.Children[0]
+	}
+	assert.Nil(t, node.Prev)
+	var items []*Item
+	for ; node != nil; node = node.Next {
+		if node.Next != nil {
+			assert.Same(t, node, node.Next.Prev)
+		}
+		items = append(items, node.Items...)
+	}
+	return items
+}
+
+func TestBPlusTree_Remove(t *testing.T) {
+	for _, degree := range []int{3, 4, 5, 8} {
+		t.Run(fmt.Sprint(degree), func(t *testing.T) {
+			bt := NewBPlusTree(degree)
+			rng := rand.New(rand.NewSource(int64(degree)))
+			present := make(map[string]float64)
+			for step := 0; step < 3000; step++ {
+				member := fmt.Sprint(rng.Intn(300))
+				if score, ok := present[member]; ok {
+					assert.True(t, bt.Remove(score, member))
+					delete(present, member)
+				} else {
+					score := float64(rng.Intn(50))
+					assert.False(t, bt.Remove(score, member))
+					bt.Add(score, member)
+					present[member] = score
+				}
+			}
+			items := checkTree(t, bt)
+			assert.Len(t, items, len(present))
+			assert.Equal(t, len(present), bt.Len())
+			for rank, item := range items {
+				assert.Equal(t, present[item.Member], item.Score)
+				assert.Equal(t, rank, bt.Rank(item.Score, item.Member))
+				assert.Equal(t, []*Item{item}, bt.RangeByRank(rank, rank))
+			}
+			assert.Equal(t, -1, bt.Rank(-1, "0"))
+
+			// Removing everything leaves an empty leaf as the root.
+			for member, score := range present {
+				assert.True(t, bt.Remove(score, member))
+			}
+			assert.Empty(t, checkTree(t, bt))
+			assert.True(t, bt.Root.IsLeaf)
+		})
+	}
+}
+
+func TestBPlusTree_RemoveKeepsRanges(t *testing.T) {
+	bt := NewBPlusTree(3)
+	for i := 0; i < 40; i++ {
+		bt.Add(float64(i), fmt.Sprintf("m%02d", i))
+	}
+	// Removing the first items of leaves leaves separators behind that no
+	// longer match an item.
+	for i := 0; i < 40; i += 3 {
+		assert.True(t, bt.Remove(float64(i), fmt.Sprintf("m%02d", i)))
+	}
+	checkTree(t, bt)
+	r := ScoreRange{ScoreBound{Value: 9}, ScoreBound{Value: 15}}
+	assert.Equal(t, []string{"m10", "m11", "m13", "m14"}, members(bt.RangeByScore(r, 0, -1, false)))
+	assert.Equal(t, []string{"m14", "m13", "m11", "m10"}, members(bt.RangeByScore(r, 0, -1, true)))
+	assert.Equal(t, []string{"m01", "m02", "m04"}, members(bt.RangeByRank(0, 2)))
+}
+
+// benchTree returns a tree of n members with distinct scores, added in random
+// order, and its items in that order.
+func benchTree(n int) (*BPlusTree, []Item) {
+	bt := NewBPlusTree(4)
+	items := make([]Item, n)
+	for i, j := range rand.New(rand.NewSource(1)).Perm(n) {
+		items[i] = Item{Score: float64(j), Member: fmt.Sprint("member", j)}
+		bt.Add(items[i].Score, items[i].Member)
+	}
+	return bt, items
+}
+
+var benchSizes = []int{1_000, 100_000, 1_000_000}
+
+func BenchmarkBPlusTree_Add(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			bt, _ := benchTree(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				score := float64(i%n) + 0.5
+				bt.Add(score, "extra")
+				bt.Remove(score, "extra")
+			}
+		})
+	}
+}
+
+func BenchmarkBPlusTree_Rank(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			bt, items := benchTree(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bt.Rank(items[i%n].Score, items[i%n].Member)
+			}
+		})
+	}
+}
+
+func BenchmarkBPlusTree_RangeByRank(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			bt, _ := benchTree(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := i % (n - 10)
+				bt.RangeByRank(start, start+9)
+			}
+		})
+	}
 }
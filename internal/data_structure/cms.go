@@ -1,6 +1,8 @@
 package data_structure
 
 import (
+	"encoding/binary"
+	"errors"
 	"github.com/spaolacci/murmur3"
 	"math"
 )
@@ -95,3 +97,40 @@ func (c *CMS) Count(item string) uint32 {
 	}
 	return minCount
 }
+
+// MarshalBinary encodes the sketch dimensions followed by every counter,
+// row by row, so it can be persisted and restored bit for bit.
+func (c *CMS) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 8+4*int(c.width)*int(c.depth))
+	binary.LittleEndian.PutUint32(data[0:], c.width)
+	binary.LittleEndian.PutUint32(data[4:], c.depth)
+	pos := 8
+	for i := uint32(0); i < c.depth; i++ {
+		for j := uint32(0); j < c.width; j++ {
+			binary.LittleEndian.PutUint32(data[pos:], c.counter[i][j])
+			pos += 4
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores a sketch produced by MarshalBinary.
+func (c *CMS) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return errors.New("cms: truncated data")
+	}
+	w := binary.LittleEndian.Uint32(data[0:])
+	d := binary.LittleEndian.Uint32(data[4:])
+	if uint64(len(data)) != 8+4*uint64(w)*uint64(d) {
+		return errors.New("cms: data length does not match dimensions")
+	}
+	*c = *CreateCMS(w, d)
+	pos := 8
+	for i := uint32(0); i < d; i++ {
+		for j := uint32(0); j < w; j++ {
+			c.counter[i][j] = binary.LittleEndian.Uint32(data[pos:])
+			pos += 4
+		}
+	}
+	return nil
+}
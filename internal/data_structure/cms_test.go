@@ -59,3 +59,21 @@ func TestCMS_IncrByAndCount(t *testing.T) {
 	}
 	assert.True(t, cms.Count("another_item") >= 1000)
 }
+
+func TestCMS_MarshalBinary(t *testing.T) {
+	cms := CreateCMS(50, 4)
+	cms.IncrBy("a", 7)
+	cms.IncrBy("b", 3)
+
+	data, err := cms.MarshalBinary()
+	assert.NoError(t, err)
+
+	var restored CMS
+	assert.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, cms.width, restored.width)
+	assert.Equal(t, cms.depth, restored.depth)
+	assert.Equal(t, cms.counter, restored.counter)
+	assert.Equal(t, cms.Count("a"), restored.Count("a"))
+
+	assert.Error(t, restored.UnmarshalBinary(data[:len(data)-1]))
+}
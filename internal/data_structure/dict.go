@@ -2,8 +2,73 @@ package data_structure
 
 import "time"
 
+// ObjType is the kind of value a key holds, as reported by TYPE.
+type ObjType uint8
+
+const (
+	ObjTypeString ObjType = iota
+	ObjTypeSet
+	ObjTypeZSet
+	ObjTypeCMS
+	ObjTypeBloom
+	ObjTypeList
+	ObjTypeHash
+)
+
+func (t ObjType) String() string {
+	switch t {
+	case ObjTypeString:
+		return "string"
+	case ObjTypeSet:
+		return "set"
+	case ObjTypeZSet:
+		return "zset"
+	case ObjTypeCMS:
+		return "CMSk-TYPE"
+	case ObjTypeBloom:
+		return "MBbloom--"
+	case ObjTypeList:
+		return "list"
+	case ObjTypeHash:
+		return "hash"
+	}
+	return "unknown"
+}
+
+// ObjEncoding is how a value is represented in memory. Strings holding a
+// 64-bit integer are kept as an int64 rather than as their digits, and
+// strings used as bitmaps as a []byte so bits can be changed in place.
+type ObjEncoding uint8
+
+const (
+	ObjEncodingRaw ObjEncoding = iota
+	ObjEncodingInt
+	ObjEncodingBytes
+)
+
 type Obj struct {
-	Value interface{}
+	Type     ObjType
+	Encoding ObjEncoding
+	Value    interface{}
+}
+
+// objTypeOf infers the type tag from the Go type of a value.
+func objTypeOf(value interface{}) ObjType {
+	switch value.(type) {
+	case *SimpleSet:
+		return ObjTypeSet
+	case *SortedSet:
+		return ObjTypeZSet
+	case *CMS:
+		return ObjTypeCMS
+	case *Bloom:
+		return ObjTypeBloom
+	case *Quicklist:
+		return ObjTypeList
+	case *Hash:
+		return ObjTypeHash
+	}
+	return ObjTypeString
 }
 
 type Dict struct {
@@ -19,14 +84,25 @@ func CreateDict() *Dict {
 	return &res
 }
 
+func (d *Dict) GetDictStore() map[string]*Obj {
+	return d.dictStore
+}
+
 func (d *Dict) GetExpireDictStore() map[string]uint64 {
 	return d.expiredDictStore
 }
 
 func (d *Dict) NewObj(key string, value interface{}, ttlMs int64) *Obj {
 	obj := &Obj{
+		Type:  objTypeOf(value),
 		Value: value,
 	}
+	switch value.(type) {
+	case int64:
+		obj.Encoding = ObjEncodingInt
+	case []byte:
+		obj.Encoding = ObjEncodingBytes
+	}
 	if ttlMs > 0 {
 		d.SetExpiry(key, ttlMs)
 	}
@@ -42,6 +118,18 @@ func (d *Dict) SetExpiry(key string, ttlMs int64) {
 	d.expiredDictStore[key] = uint64(time.Now().UnixMilli()) + uint64(ttlMs)
 }
 
+// SetExpiryAt sets an absolute expiry time in unix milliseconds.
+func (d *Dict) SetExpiryAt(key string, unixMs uint64) {
+	d.expiredDictStore[key] = unixMs
+}
+
+// DelExpiry makes key persistent. It reports whether it had an expiry.
+func (d *Dict) DelExpiry(key string) bool {
+	_, exist := d.expiredDictStore[key]
+	delete(d.expiredDictStore, key)
+	return exist
+}
+
 func (d *Dict) HasExpired(key string) bool {
 	exp, exist := d.expiredDictStore[key]
 	if !exist {
@@ -65,11 +153,12 @@ func (d *Dict) Set(k string, obj *Obj) {
 	d.dictStore[k] = obj
 }
 
+// Del removes k and its expiry. It reports whether a live key was deleted;
+// a key that had already expired counts as missing.
 func (d *Dict) Del(k string) bool {
-	if _, exist := d.dictStore[k]; exist {
-		delete(d.dictStore, k)
-		delete(d.expiredDictStore, k)
-		return true
-	}
-	return false
+	_, exist := d.dictStore[k]
+	live := exist && !d.HasExpired(k)
+	delete(d.dictStore, k)
+	delete(d.expiredDictStore, k)
+	return live
 }
@@ -0,0 +1,273 @@
+package data_structure
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// A Hash starts out compact, as a flat slice of field, value pairs searched
+// linearly, which is both smaller and faster than a map for a handful of
+// fields. It converts to a map for good once it has more than
+// hashCompactMaxEntries fields or a field or value longer than
+// hashCompactMaxValue bytes, like the listpack encoding of Redis.
+const (
+	hashCompactMaxEntries = 128
+	hashCompactMaxValue   = 64
+)
+
+// hashMinBuckets is the smallest size of the scan index of a map encoded
+// hash, whose fields are more than hashCompactMaxEntries anyway.
+const hashMinBuckets = 128
+
+var hashScanSeed = maphash.MakeSeed()
+
+type Hash struct {
+	// pairs holds field0, value0, field1, value1, ... while the hash is
+	// compact; dict is nil until then.
+	pairs []string
+	dict  map[string]string
+
+	// buckets groups the fields of dict by their hash, the way the table of
+	// a Redis dict does, so that Scan can resume from a bucket. Its length is
+	// a power of two, at least the number of fields and, above
+	// hashMinBuckets, at most eight times that.
+	buckets [][]string
+
+	// expires holds the deadline, in unix ms, of the fields that have one,
+	// whatever the encoding; it is nil while none has. nextExpiry is at most
+	// the earliest of them, so that most calls to DeleteExpired find out
+	// there is nothing to do in O(1).
+	expires    map[string]uint64
+	nextExpiry uint64
+}
+
+func NewHash() *Hash {
+	return &Hash{}
+}
+
+// IsCompact reports whether the hash still uses the compact encoding.
+func (h *Hash) IsCompact() bool {
+	return h.dict == nil
+}
+
+func (h *Hash) Len() int {
+	if h.dict != nil {
+		return len(h.dict)
+	}
+	return len(h.pairs) / 2
+}
+
+// find returns the position of field in pairs, or -1.
+func (h *Hash) find(field string) int {
+	for i := 0; i < len(h.pairs); i += 2 {
+		if h.pairs[i] == field {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *Hash) Get(field string) (string, bool) {
+	if h.dict != nil {
+		v, ok := h.dict[field]
+		return v, ok
+	}
+	if i := h.find(field); i >= 0 {
+		return h.pairs[i+1], true
+	}
+	return "", false
+}
+
+// Set sets field to value and reports whether the field is new. Like a new
+// value of a key, it clears the deadline the field had.
+func (h *Hash) Set(field, value string) bool {
+	h.Persist(field)
+	return h.Update(field, value)
+}
+
+// Update is Set keeping the deadline of the field, for changes that derive
+// the new value from the old one.
+func (h *Hash) Update(field, value string) bool {
+	if h.dict == nil && (len(field) > hashCompactMaxValue || len(value) > hashCompactMaxValue) {
+		h.convert()
+	}
+	if h.dict != nil {
+		_, exists := h.dict[field]
+		h.dict[field] = value
+		if !exists {
+			h.index(field)
+		}
+		return !exists
+	}
+	if i := h.find(field); i >= 0 {
+		h.pairs[i+1] = value
+		return false
+	}
+	h.pairs = append(h.pairs, field, value)
+	if len(h.pairs)/2 > hashCompactMaxEntries {
+		h.convert()
+	}
+	return true
+}
+
+// convert switches to the map encoding.
+func (h *Hash) convert() {
+	h.dict = make(map[string]string, len(h.pairs))
+	for i := 0; i < len(h.pairs); i += 2 {
+		h.dict[h.pairs[i]] = h.pairs[i+1]
+	}
+	h.pairs = nil
+	h.rehash(hashMinBuckets)
+}
+
+func (h *Hash) bucketOf(field string) uint64 {
+	return maphash.String(hashScanSeed, field) & uint64(len(h.buckets)-1)
+}
+
+// index adds field, just added to dict, to the buckets, doubling them when
+// there are more fields than buckets.
+func (h *Hash) index(field string) {
+	if len(h.dict) > len(h.buckets) {
+		h.rehash(2 * len(h.buckets))
+		return
+	}
+	b := h.bucketOf(field)
+	h.buckets[b] = append(h.buckets[b], field)
+}
+
+// unindex removes field, just deleted from dict, from the buckets, halving
+// them when they are mostly empty.
+func (h *Hash) unindex(field string) {
+	b := h.bucketOf(field)
+	bucket := h.buckets[b]
+	i := slices.Index(bucket, field)
+	bucket[i] = bucket[len(bucket)-1]
+	h.buckets[b] = bucket[:len(bucket)-1]
+	if len(h.buckets) > hashMinBuckets && len(h.dict) < len(h.buckets)/8 {
+		h.rehash(len(h.buckets) / 2)
+	}
+}
+
+// rehash rebuilds the buckets with n of them.
+func (h *Hash) rehash(n int) {
+	h.buckets = make([][]string, n)
+	for field := range h.dict {
+		b := h.bucketOf(field)
+		h.buckets[b] = append(h.buckets[b], field)
+	}
+}
+
+// Del removes field and reports whether it was there.
+func (h *Hash) Del(field string) bool {
+	h.Persist(field)
+	if h.dict != nil {
+		_, exists := h.dict[field]
+		if exists {
+			delete(h.dict, field)
+			h.unindex(field)
+		}
+		return exists
+	}
+	i := h.find(field)
+	if i < 0 {
+		return false
+	}
+	h.pairs = slices.Delete(h.pairs, i, i+2)
+	return true
+}
+
+// Pairs returns every field followed by its value, in no particular order.
+func (h *Hash) Pairs() []string {
+	if h.dict == nil {
+		return slices.Clone(h.pairs)
+	}
+	pairs := make([]string, 0, 2*len(h.dict))
+	for field, value := range h.dict {
+		pairs = append(pairs, field, value)
+	}
+	return pairs
+}
+
+// Scan returns about count field, value pairs starting at cursor, and the
+// cursor to continue from, 0 once the scan is over. A compact hash is
+// returned whole at once.
+//
+// The cursor is a bucket number with its bits reversed and is incremented
+// from the high bit down, like in Redis dictScan: when the number of buckets
+// doubles or halves between calls, the buckets already visited still map to
+// cursors below the current one. A field present during the whole scan is
+// therefore returned, and only a halving can make it come twice.
+func (h *Hash) Scan(cursor uint64, count int) (uint64, []string) {
+	if h.dict == nil {
+		return 0, slices.Clone(h.pairs)
+	}
+	mask := uint64(len(h.buckets) - 1)
+	var pairs []string
+	for {
+		for _, field := range h.buckets[cursor&mask] {
+			pairs = append(pairs, field, h.dict[field])
+		}
+		// Set the bits above the mask so that incrementing the reversed
+		// cursor carries into the bits that address the buckets.
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || len(pairs) >= 2*max(count, 1) {
+			return cursor, pairs
+		}
+	}
+}
+
+// HasExpiries reports whether some field has a deadline.
+func (h *Hash) HasExpiries() bool {
+	return len(h.expires) > 0
+}
+
+// Expiry returns the deadline of field in unix ms, if it has one.
+func (h *Hash) Expiry(field string) (uint64, bool) {
+	at, ok := h.expires[field]
+	return at, ok
+}
+
+// SetExpiry gives field, which must exist, a deadline in unix ms.
+func (h *Hash) SetExpiry(field string, unixMs uint64) {
+	if h.expires == nil {
+		h.expires = make(map[string]uint64)
+		h.nextExpiry = unixMs
+	}
+	h.expires[field] = unixMs
+	h.nextExpiry = min(h.nextExpiry, unixMs)
+}
+
+// Persist removes the deadline of field and reports whether it had one.
+func (h *Hash) Persist(field string) bool {
+	if _, ok := h.expires[field]; !ok {
+		return false
+	}
+	delete(h.expires, field)
+	if len(h.expires) == 0 {
+		h.expires = nil
+	}
+	return true
+}
+
+// DeleteExpired deletes the fields whose deadline is at or before nowMs and
+// returns how many it deleted.
+func (h *Hash) DeleteExpired(nowMs uint64) int {
+	if h.expires == nil || nowMs < h.nextExpiry {
+		return 0
+	}
+	deleted := 0
+	next := uint64(math.MaxUint64)
+	for field, at := range h.expires {
+		if at > nowMs {
+			next = min(next, at)
+			continue
+		}
+		h.Del(field)
+		deleted++
+	}
+	h.nextExpiry = next
+	return deleted
+}
@@ -0,0 +1,170 @@
+package data_structure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash_setGetDel(t *testing.T) {
+	h := NewHash()
+	assert.True(t, h.Set("a", "1"))
+	assert.True(t, h.Set("b", "2"))
+	assert.False(t, h.Set("a", "3"))
+	v, ok := h.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "3", v)
+	_, ok = h.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 2, h.Len())
+	assert.ElementsMatch(t, []string{"a", "3", "b", "2"}, h.Pairs())
+
+	assert.True(t, h.Del("a"))
+	assert.False(t, h.Del("a"))
+	assert.Equal(t, []string{"b", "2"}, h.Pairs())
+	assert.True(t, h.IsCompact())
+}
+
+func TestHash_convertsPastThresholds(t *testing.T) {
+	h := NewHash()
+	for i := 0; i < hashCompactMaxEntries; i++ {
+		h.Set("f"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	assert.True(t, h.IsCompact())
+	h.Set("one-more", "x")
+	assert.False(t, h.IsCompact())
+	assert.Equal(t, hashCompactMaxEntries+1, h.Len())
+	v, _ := h.Get("f42")
+	assert.Equal(t, "42", v)
+
+	h = NewHash()
+	h.Set("short", "x")
+	h.Set("long", strings.Repeat("x", hashCompactMaxValue+1))
+	assert.False(t, h.IsCompact())
+	v, _ = h.Get("short")
+	assert.Equal(t, "x", v)
+}
+
+func TestHash_scan(t *testing.T) {
+	h := NewHash()
+	h.Set("a", "1")
+	cursor, pairs := h.Scan(0, 1)
+	assert.Equal(t, uint64(0), cursor)
+	assert.Equal(t, []string{"a", "1"}, pairs)
+
+	for i := 0; i < 1000; i++ {
+		h.Set("f"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	// Fields deleted and added halfway don't make the others be missed or
+	// returned twice.
+	seen := map[string]int{}
+	calls := 0
+	for cursor = 0; ; {
+		cursor, pairs = h.Scan(cursor, 10)
+		for i := 0; i < len(pairs); i += 2 {
+			seen[pairs[i]]++
+			v, _ := h.Get(pairs[i])
+			assert.Equal(t, v, pairs[i+1])
+		}
+		if calls++; calls == 50 {
+			for i := 0; i < 100; i++ {
+				h.Del("f" + strconv.Itoa(i))
+				h.Set("new"+strconv.Itoa(i), "x")
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	assert.Greater(t, calls, 50)
+	for i := 100; i < 1000; i++ {
+		assert.Equal(t, 1, seen["f"+strconv.Itoa(i)], i)
+	}
+	assert.Equal(t, 1, seen["a"])
+}
+
+func TestHash_ScanWhileResizing(t *testing.T) {
+	h := NewHash()
+	for i := 0; i < 1000; i++ {
+		h.Set("f"+strconv.Itoa(i), "v")
+	}
+	scan := func(resize func(call int)) map[string]int {
+		seen := map[string]int{}
+		cursor, pairs := h.Scan(0, 20)
+		for call := 1; ; call++ {
+			for i := 0; i < len(pairs); i += 2 {
+				seen[pairs[i]]++
+			}
+			if cursor == 0 {
+				return seen
+			}
+			resize(call)
+			cursor, pairs = h.Scan(cursor, 20)
+		}
+	}
+
+	// The buckets double during the scan.
+	seen := scan(func(call int) {
+		if call > 20 {
+			return
+		}
+		for i := 0; i < 200; i++ {
+			h.Set(fmt.Sprintf("g%d-%d", call, i), "v")
+		}
+	})
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, 1, seen["f"+strconv.Itoa(i)], i)
+	}
+
+	// And then halve.
+	before := len(h.buckets)
+	seen = scan(func(call int) {
+		for i := 0; i < 200; i++ {
+			h.Del(fmt.Sprintf("g%d-%d", call, i))
+		}
+	})
+	assert.Less(t, len(h.buckets), before)
+	for i := 0; i < 1000; i++ {
+		assert.GreaterOrEqual(t, seen["f"+strconv.Itoa(i)], 1, i)
+	}
+}
+
+func TestHash_fieldExpiry(t *testing.T) {
+	h := NewHash()
+	h.Set("token", "t")
+	h.Set("counter", "1")
+	h.Set("name", "ada")
+	assert.False(t, h.HasExpiries())
+	h.SetExpiry("token", 100)
+	h.SetExpiry("counter", 200)
+	at, ok := h.Expiry("token")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(100), at)
+	_, ok = h.Expiry("name")
+	assert.False(t, ok)
+
+	// Update keeps the deadline, Set clears it.
+	h.Update("counter", "2")
+	_, ok = h.Expiry("counter")
+	assert.True(t, ok)
+	assert.Equal(t, 0, h.DeleteExpired(99))
+	assert.Equal(t, 1, h.DeleteExpired(100))
+	_, ok = h.Get("token")
+	assert.False(t, ok)
+	h.Set("counter", "3")
+	_, ok = h.Expiry("counter")
+	assert.False(t, ok)
+	assert.False(t, h.HasExpiries())
+	assert.Equal(t, 0, h.DeleteExpired(1000))
+	assert.Equal(t, 2, h.Len())
+
+	h.SetExpiry("name", 300)
+	assert.True(t, h.Persist("name"))
+	assert.False(t, h.Persist("name"))
+	h.SetExpiry("name", 300)
+	h.Del("name")
+	assert.False(t, h.HasExpiries())
+}
@@ -0,0 +1,264 @@
+package data_structure
+
+import "slices"
+
+// quicklistFill is the most elements a node of a Quicklist holds.
+const quicklistFill = 128
+
+type quicklistNode struct {
+	prev, next *quicklistNode
+	entries    []string
+}
+
+// Quicklist is the list type: a doubly linked list of nodes that each pack up
+// to quicklistFill elements in one slice. Pushing and popping at either end
+// is O(1), and indexing only walks nodes, not elements, from the closer end.
+//
+// Indexes taken by the methods are 0 based from the head and must be within
+// the list; resolving negative or out of range indexes is left to callers.
+type Quicklist struct {
+	head, tail *quicklistNode
+	count      int
+}
+
+func NewQuicklist() *Quicklist {
+	return &Quicklist{}
+}
+
+func (l *Quicklist) Len() int {
+	return l.count
+}
+
+// insertNode links node after prev, or at the head when prev is nil.
+func (l *Quicklist) insertNode(prev, node *quicklistNode) {
+	node.prev = prev
+	if prev == nil {
+		node.next = l.head
+		l.head = node
+	} else {
+		node.next = prev.next
+		prev.next = node
+	}
+	if node.next == nil {
+		l.tail = node
+	} else {
+		node.next.prev = node
+	}
+}
+
+func (l *Quicklist) unlink(node *quicklistNode) {
+	if node.prev == nil {
+		l.head = node.next
+	} else {
+		node.prev.next = node.next
+	}
+	if node.next == nil {
+		l.tail = node.prev
+	} else {
+		node.next.prev = node.prev
+	}
+	node.prev, node.next = nil, nil
+}
+
+// PushHead adds values at the head one after the other, so the last one ends
+// up first, as with LPUSH.
+func (l *Quicklist) PushHead(values ...string) {
+	for _, v := range values {
+		if l.head == nil || len(l.head.entries) == quicklistFill {
+			l.insertNode(nil, &quicklistNode{entries: make([]string, 0, 8)})
+		}
+		l.head.entries = slices.Insert(l.head.entries, 0, v)
+		l.count++
+	}
+}
+
+// PushTail adds values at the tail in order.
+func (l *Quicklist) PushTail(values ...string) {
+	for _, v := range values {
+		if l.tail == nil || len(l.tail.entries) == quicklistFill {
+			l.insertNode(l.tail, &quicklistNode{entries: make([]string, 0, 8)})
+		}
+		l.tail.entries = append(l.tail.entries, v)
+		l.count++
+	}
+}
+
+func (l *Quicklist) PopHead() (string, bool) {
+	if l.head == nil {
+		return "", false
+	}
+	v := l.head.entries[0]
+	l.deleteAt(l.head, 0)
+	return v, true
+}
+
+func (l *Quicklist) PopTail() (string, bool) {
+	if l.tail == nil {
+		return "", false
+	}
+	v := l.tail.entries[len(l.tail.entries)-1]
+	l.deleteAt(l.tail, len(l.tail.entries)-1)
+	return v, true
+}
+
+// locate returns the node holding the element at index i and its offset in
+// the node, walking from whichever end is closer.
+func (l *Quicklist) locate(i int) (*quicklistNode, int) {
+	if i < l.count/2 {
+		node := l.head
+		for i >= len(node.entries) {
+			i -= len(node.entries)
+			node = node.next
+		}
+		return node, i
+	}
+	node := l.tail
+	i = l.count - 1 - i // offset from the end
+	for i >= len(node.entries) {
+		i -= len(node.entries)
+		node = node.prev
+	}
+	return node, len(node.entries) - 1 - i
+}
+
+// Index returns the element at index i.
+func (l *Quicklist) Index(i int) string {
+	node, off := l.locate(i)
+	return node.entries[off]
+}
+
+// Set replaces the element at index i.
+func (l *Quicklist) Set(i int, value string) {
+	node, off := l.locate(i)
+	node.entries[off] = value
+}
+
+// Range returns the elements from start to end, both inclusive.
+func (l *Quicklist) Range(start, end int) []string {
+	if start > end {
+		return []string{}
+	}
+	res := make([]string, 0, end-start+1)
+	node, off := l.locate(start)
+	for len(res) < cap(res) {
+		n := min(len(node.entries)-off, cap(res)-len(res))
+		res = append(res, node.entries[off:off+n]...)
+		node, off = node.next, 0
+	}
+	return res
+}
+
+// insertAt inserts value so that it ends up at offset off of node, splitting
+// the node first when it is full.
+func (l *Quicklist) insertAt(node *quicklistNode, off int, value string) {
+	if len(node.entries) == quicklistFill {
+		half := quicklistFill / 2
+		second := &quicklistNode{entries: slices.Clone(node.entries[half:])}
+		clear(node.entries[half:])
+		node.entries = node.entries[:half]
+		l.insertNode(node, second)
+		if off > half {
+			node, off = second, off-half
+		}
+	}
+	node.entries = slices.Insert(node.entries, off, value)
+	l.count++
+}
+
+// deleteAt removes the element at offset off of node, dropping the node once
+// it is empty.
+func (l *Quicklist) deleteAt(node *quicklistNode, off int) {
+	node.entries = slices.Delete(node.entries, off, off+1)
+	l.count--
+	if len(node.entries) == 0 {
+		l.unlink(node)
+	}
+}
+
+// Insert adds value before or, with after, after the first element equal to
+// pivot. It reports whether pivot was found.
+func (l *Quicklist) Insert(pivot, value string, after bool) bool {
+	for node := l.head; node != nil; node = node.next {
+		if off := slices.Index(node.entries, pivot); off >= 0 {
+			if after {
+				off++
+			}
+			l.insertAt(node, off, value)
+			return true
+		}
+	}
+	return false
+}
+
+// Remove deletes elements equal to value and returns how many it deleted:
+// up to count of them from the head when count is positive, up to -count
+// from the tail when it is negative, and all of them when it is 0.
+func (l *Quicklist) Remove(value string, count int) int {
+	removed := 0
+	limit := count
+	if count < 0 {
+		limit = -count
+	}
+	if count >= 0 {
+		for node := l.head; node != nil && (limit == 0 || removed < limit); {
+			next := node.next
+			for off := 0; off < len(node.entries) && (limit == 0 || removed < limit); {
+				if node.entries[off] != value {
+					off++
+					continue
+				}
+				l.deleteAt(node, off)
+				removed++
+			}
+			node = next
+		}
+		return removed
+	}
+	for node := l.tail; node != nil && removed < limit; {
+		prev := node.prev
+		for off := len(node.entries) - 1; off >= 0 && removed < limit; off-- {
+			if node.entries[off] == value {
+				l.deleteAt(node, off)
+				removed++
+			}
+		}
+		node = prev
+	}
+	return removed
+}
+
+// deleteRange removes n elements starting at index start.
+func (l *Quicklist) deleteRange(start, n int) {
+	if n <= 0 {
+		return
+	}
+	node, off := l.locate(start)
+	for n > 0 {
+		next := node.next
+		k := min(n, len(node.entries)-off)
+		if k == len(node.entries) {
+			l.unlink(node)
+		} else {
+			node.entries = slices.Delete(node.entries, off, off+k)
+		}
+		l.count -= k
+		n -= k
+		node, off = next, 0
+	}
+}
+
+// Trim keeps only the elements from start to end, both inclusive. A start
+// past end empties the list.
+func (l *Quicklist) Trim(start, end int) {
+	if start > end {
+		l.head, l.tail, l.count = nil, nil, 0
+		return
+	}
+	l.deleteRange(end+1, l.count-end-1)
+	l.deleteRange(0, start)
+}
+
+// Values returns every element from head to tail.
+func (l *Quicklist) Values() []string {
+	return l.Range(0, l.count-1)
+}
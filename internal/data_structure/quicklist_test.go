@@ -0,0 +1,127 @@
+package data_structure
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuicklist_pushAndPop(t *testing.T) {
+	l := NewQuicklist()
+	l.PushTail("b", "c")
+	l.PushHead("a", "z")
+	assert.Equal(t, 4, l.Len())
+	assert.Equal(t, []string{"z", "a", "b", "c"}, l.Values())
+
+	v, ok := l.PopHead()
+	assert.True(t, ok)
+	assert.Equal(t, "z", v)
+	v, _ = l.PopTail()
+	assert.Equal(t, "c", v)
+	l.PopTail()
+	l.PopTail()
+	_, ok = l.PopHead()
+	assert.False(t, ok)
+	assert.Equal(t, 0, l.Len())
+	assert.Nil(t, l.head)
+	assert.Nil(t, l.tail)
+}
+
+func TestQuicklist_splitsIntoNodes(t *testing.T) {
+	l := NewQuicklist()
+	for i := 0; i < 3*quicklistFill; i++ {
+		l.PushTail(strconv.Itoa(i))
+	}
+	nodes := 0
+	for node := l.head; node != nil; node = node.next {
+		assert.LessOrEqual(t, len(node.entries), quicklistFill)
+		nodes++
+	}
+	assert.Equal(t, 3, nodes)
+	assert.Equal(t, "200", l.Index(200))
+	assert.Equal(t, []string{"127", "128", "129"}, l.Range(127, 129))
+
+	// Inserting into a full node splits it.
+	assert.True(t, l.Insert("5", "x", true))
+	assert.Equal(t, "x", l.Index(6))
+	assert.Equal(t, "6", l.Index(7))
+	assert.Equal(t, 3*quicklistFill+1, l.Len())
+}
+
+func TestQuicklist_removeAndTrim(t *testing.T) {
+	l := NewQuicklist()
+	l.PushTail("a", "b", "a", "c", "a")
+	assert.Equal(t, 1, l.Remove("a", -1))
+	assert.Equal(t, []string{"a", "b", "a", "c"}, l.Values())
+	assert.Equal(t, 1, l.Remove("a", 1))
+	assert.Equal(t, []string{"b", "a", "c"}, l.Values())
+	assert.Equal(t, 0, l.Remove("missing", 0))
+	assert.Equal(t, 1, l.Remove("a", 0))
+
+	l.PushTail("d", "e")
+	l.Trim(1, 2)
+	assert.Equal(t, []string{"c", "d"}, l.Values())
+	l.Trim(1, 0)
+	assert.Equal(t, 0, l.Len())
+	assert.Equal(t, []string{}, l.Values())
+}
+
+// TestQuicklist_matchesSlice runs random operations on a list and on a plain
+// slice and checks they always hold the same elements.
+func TestQuicklist_matchesSlice(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	l := NewQuicklist()
+	var want []string
+	for i := 0; i < 20000; i++ {
+		v := strconv.Itoa(rng.Intn(50))
+		switch op := rng.Intn(10); {
+		case op < 3:
+			l.PushTail(v)
+			want = append(want, v)
+		case op < 5:
+			l.PushHead(v)
+			want = slices.Insert(want, 0, v)
+		case op == 5 && len(want) > 0:
+			got, _ := l.PopHead()
+			assert.Equal(t, want[0], got)
+			want = want[1:]
+		case op == 6 && len(want) > 0:
+			got, _ := l.PopTail()
+			assert.Equal(t, want[len(want)-1], got)
+			want = want[:len(want)-1]
+		case op == 7:
+			pivot := strconv.Itoa(rng.Intn(50))
+			if off := slices.Index(want, pivot); off >= 0 {
+				assert.True(t, l.Insert(pivot, v, false))
+				want = slices.Insert(want, off, v)
+			} else {
+				assert.False(t, l.Insert(pivot, v, false))
+			}
+		case op == 8 && len(want) > 0:
+			idx := rng.Intn(len(want))
+			l.Set(idx, v)
+			want[idx] = v
+		case op == 9 && rng.Intn(20) == 0:
+			removed := 0
+			want = slices.DeleteFunc(want, func(s string) bool {
+				if s == v {
+					removed++
+					return true
+				}
+				return false
+			})
+			assert.Equal(t, removed, l.Remove(v, 0))
+		}
+		if i%500 == 0 {
+			assert.Equal(t, len(want), l.Len())
+			assert.Equal(t, append([]string{}, want...), l.Values())
+			if len(want) > 0 {
+				idx := rng.Intn(len(want))
+				assert.Equal(t, want[idx], l.Index(idx))
+			}
+		}
+	}
+}
@@ -49,3 +49,7 @@ func (s *SimpleSet) Members() []string {
 	}
 	return m
 }
+
+func (s *SimpleSet) Len() int {
+	return len(s.dict)
+}
@@ -12,20 +12,64 @@ func NewSortedSet(degree int) *SortedSet {
 	}
 }
 
+// Add sets the score of member and returns 1 when member is new, 0 when it
+// only got a new score or already had that one. A new score is a new place in
+// the tree, so the item with the old score is removed before the new one is
+// inserted.
 func (ss *SortedSet) Add(score float64, member string) int {
-	// Update the BPlusTree
-	added := ss.Tree.Add(score, member)
-
-	// Update the MemberScores map
+	old, exists := ss.MemberScores[member]
+	if exists {
+		if old == score {
+			return 0
+		}
+		ss.Tree.Remove(old, member)
+	}
+	ss.Tree.Add(score, member)
 	ss.MemberScores[member] = score
-
-	return added
+	if exists {
+		return 0
+	}
+	return 1
 }
 
 func (ss *SortedSet) GetScore(member string) (float64, bool) {
-	return ss.Tree.Score(member)
+	score, ok := ss.MemberScores[member]
+	return score, ok
 }
 
+// GetRank returns the rank of member, or -1. Its score tells the tree where
+// to find it.
 func (ss *SortedSet) GetRank(member string) int {
-	return ss.Tree.GetRank(member)
+	score, ok := ss.MemberScores[member]
+	if !ok {
+		return -1
+	}
+	return ss.Tree.Rank(score, member)
+}
+
+func (ss *SortedSet) Len() int {
+	return len(ss.MemberScores)
+}
+
+func (ss *SortedSet) RangeByScore(r ScoreRange, offset, count int, reverse bool) []*Item {
+	return ss.Tree.RangeByScore(r, offset, count, reverse)
+}
+
+func (ss *SortedSet) RangeByLex(r LexRange, offset, count int, reverse bool) []*Item {
+	return ss.Tree.RangeByLex(r, offset, count, reverse)
+}
+
+func (ss *SortedSet) RangeByRank(start, stop int) []*Item {
+	return ss.Tree.RangeByRank(start, stop)
+}
+
+// Remove deletes member and reports whether it was there.
+func (ss *SortedSet) Remove(member string) bool {
+	score, ok := ss.MemberScores[member]
+	if !ok {
+		return false
+	}
+	ss.Tree.Remove(score, member)
+	delete(ss.MemberScores, member)
+	return true
 }
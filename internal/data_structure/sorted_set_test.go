@@ -1,6 +1,7 @@
 package data_structure
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -32,13 +33,33 @@ func TestSortedSet_Add(t *testing.T) {
 
 	// Update an existing member's score
 	added = ss.Add(15.0, "memberA")
-	assert.Equal(t, 1, added)
+	assert.Equal(t, 0, added)
 	assert.Equal(t, 15.0, ss.MemberScores["memberA"])
 
-	// Check tree size (indirectly)
-	score, found := ss.Tree.Score("memberA")
-	assert.True(t, found)
-	assert.Equal(t, 15.0, score)
+	// The tree holds the member once, with its new score.
+	assert.Equal(t, 0, ss.Tree.Rank(15.0, "memberA"))
+	assert.Equal(t, -1, ss.Tree.Rank(10.0, "memberA"))
+	assert.Equal(t, 2, ss.Tree.Len())
+}
+
+func TestSortedSet_AddMovesRescoredMembers(t *testing.T) {
+	ss := NewSortedSet(3)
+	for i := 0; i < 30; i++ {
+		ss.Add(float64(i), fmt.Sprint(i))
+	}
+	// Each new score belongs in another leaf than the old one.
+	assert.Equal(t, 0, ss.Add(100, "0"))
+	assert.Equal(t, 0, ss.Add(-1, "29"))
+	assert.Equal(t, 0, ss.Add(-1, "29"))
+
+	assert.Equal(t, 30, ss.Tree.Len())
+	assert.Equal(t, 0, ss.GetRank("29"))
+	assert.Equal(t, 1, ss.GetRank("1"))
+	assert.Equal(t, 29, ss.GetRank("0"))
+	ranked := ss.RangeByRank(0, 29)
+	for i := 1; i < len(ranked); i++ {
+		assert.Negative(t, ranked[i-1].CompareTo(ranked[i]))
+	}
 }
 
 func TestSortedSet_GetScore(t *testing.T) {
@@ -77,3 +98,18 @@ func TestSortedSet_GetRank(t *testing.T) {
 	assert.Equal(t, 3, ss.GetRank("memberB"))
 	assert.Equal(t, -1, ss.GetRank("non_existent_member"))
 }
+
+func TestSortedSet_Remove(t *testing.T) {
+	ss := NewSortedSet(3)
+	for i, member := range []string{"a", "b", "c", "d", "e"} {
+		ss.Add(float64(i), member)
+	}
+
+	assert.True(t, ss.Remove("b"))
+	assert.False(t, ss.Remove("b"))
+	assert.False(t, ss.Remove("missing"))
+	assert.Equal(t, 4, ss.Len())
+	_, found := ss.GetScore("b")
+	assert.False(t, found)
+	assert.Equal(t, 1, ss.GetRank("c"))
+}
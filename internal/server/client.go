@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+	"github.com/thaison199py/multi-threaded-redis/internal/core"
+	"github.com/thaison199py/multi-threaded-redis/internal/core/io_multiplexing"
+)
+
+// readChunkSize is the minimum free space kept in the query buffer before
+// each read, so a single syscall can pull in a reasonably large chunk.
+const readChunkSize = 16 * 1024
+
+var errQueryBufferLimit = errors.New("query buffer limit exceeded")
+
+// Client holds the state of one connection. The query buffer accumulates
+// bytes read from the socket until they form complete RESP frames, so a
+// command split across several TCP reads is reassembled before execution.
+// The reply buffer holds output the socket has not accepted yet.
+type Client struct {
+	fd       int
+	queryBuf []byte
+	// qbPos is where the next frame starts in queryBuf; the frames before it
+	// have been decoded and are dropped by compactQuery. mbState is how far
+	// the decoding of the frame at qbPos got, when it is a partial array.
+	qbPos    int
+	mbState  core.MultiBulkState
+	replyBuf []byte
+	sentLen  int // bytes of replyBuf already written to the socket
+	interest io_multiplexing.Operation
+
+	// blockID is non-zero while the client waits for the reply to a blocking
+	// command; the delivery carrying the same id ends the wait. blocked is nil
+	// when the command failed before blocking, and blockTimer is the timeout
+	// timer, 0 without one.
+	blockID    int64
+	blocked    *core.BlockedClient
+	blockTimer int64
+
+	lastInteraction time.Time
+}
+
+func newClient(fd int) *Client {
+	return &Client{fd: fd, interest: io_multiplexing.OpRead, lastInteraction: time.Now()}
+}
+
+// readQuery appends whatever the socket currently has to the query buffer.
+func (c *Client) readQuery() error {
+	if cap(c.queryBuf)-len(c.queryBuf) < readChunkSize {
+		grown := make([]byte, len(c.queryBuf), 2*cap(c.queryBuf)+readChunkSize)
+		copy(grown, c.queryBuf)
+		c.queryBuf = grown
+	}
+	n, err := syscall.Read(c.fd, c.queryBuf[len(c.queryBuf):cap(c.queryBuf)])
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return io.EOF
+	}
+	c.queryBuf = c.queryBuf[:len(c.queryBuf)+n]
+	if len(c.queryBuf) > config.MaxQueryBufferSize {
+		return errQueryBufferLimit
+	}
+	return nil
+}
+
+// nextCommand decodes the frame at qbPos and moves past it. It returns a nil
+// command when the buffer only holds a partial frame.
+func (c *Client) nextCommand() (*core.Command, error) {
+	value, n, err := core.DecodeFrame(c.queryBuf[c.qbPos:], &c.mbState)
+	if err == core.ErrIncompleteFrame {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.qbPos += n
+	return core.NewCommand(value)
+}
+
+// compactQuery drops the decoded frames from the query buffer. It runs once
+// per batch of commands rather than once per command, so that a read holding
+// many pipelined commands doesn't copy the rest of the buffer for each.
+func (c *Client) compactQuery() {
+	if c.qbPos == 0 {
+		return
+	}
+	remain := copy(c.queryBuf, c.queryBuf[c.qbPos:])
+	c.queryBuf = c.queryBuf[:remain]
+	c.qbPos = 0
+	// Give back the memory of a buffer that grew for one huge command.
+	if remain == 0 && cap(c.queryBuf) > 4*readChunkSize {
+		c.queryBuf = nil
+	}
+}
+
+// Write queues a reply for the client. It never touches the socket, so it is
+// safe to use as the io.Writer passed to core.ExecuteAndResponse.
+func (c *Client) Write(p []byte) (int, error) {
+	c.replyBuf = append(c.replyBuf, p...)
+	return len(p), nil
+}
+
+func (c *Client) hasPendingReplies() bool {
+	return c.sentLen < len(c.replyBuf)
+}
+
+// flushReplies writes as much of the reply buffer as the socket accepts
+// without blocking. Whatever is left waits for the next writable event.
+func (c *Client) flushReplies() error {
+	for c.hasPendingReplies() {
+		n, err := syscall.Write(c.fd, c.replyBuf[c.sentLen:])
+		if err == syscall.EAGAIN {
+			return nil
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.sentLen += n
+	}
+	c.sentLen = 0
+	c.replyBuf = c.replyBuf[:0]
+	if cap(c.replyBuf) > 4*readChunkSize {
+		c.replyBuf = nil
+	}
+	return nil
+}
+
+func (c *Client) close() error {
+	return syscall.Close(c.fd)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thaison199py/multi-threaded-redis/internal/core"
+)
+
+func TestClient_nextCommand(t *testing.T) {
+	c := newClient(-1)
+	c.queryBuf = []byte("*1\r\n$4\r\nPING\r\n*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n*2\r\n$3\r\nGET\r\n$1")
+
+	// Pipelined frames are decoded in place; only the offset moves.
+	cmd, err := c.nextCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, &core.Command{Cmd: "PING", Args: []string{}}, cmd)
+	cmd, err = c.nextCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, "ECHO", cmd.Cmd)
+	cmd, err = c.nextCommand()
+	assert.NoError(t, err)
+	assert.Nil(t, cmd)
+	assert.Equal(t, 36, c.qbPos)
+
+	// The partial frame moves to the front and keeps its progress.
+	c.compactQuery()
+	assert.Equal(t, 0, c.qbPos)
+	assert.Equal(t, "*2\r\n$3\r\nGET\r\n$1", string(c.queryBuf))
+	c.queryBuf = append(c.queryBuf, "\r\nk\r\n"...)
+	cmd, err = c.nextCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, &core.Command{Cmd: "GET", Args: []string{"k"}}, cmd)
+	c.compactQuery()
+	assert.Empty(t, c.queryBuf)
+}
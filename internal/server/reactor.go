@@ -0,0 +1,318 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"syscall"
+	"time"
+
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+	"github.com/thaison199py/multi-threaded-redis/internal/constant"
+	"github.com/thaison199py/multi-threaded-redis/internal/core"
+	"github.com/thaison199py/multi-threaded-redis/internal/core/io_multiplexing"
+)
+
+// reactor is one event loop. It owns a listening socket, an ioMultiplexer and
+// the clients accepted on that socket, and hands their commands to the shared
+// dispatcher. Several reactors can run side by side, one per goroutine.
+type reactor struct {
+	id            int
+	serverFd      int
+	ioMultiplexer io_multiplexing.IOMultiplexer
+	dispatcher    *core.Dispatcher
+	clients       map[int]*Client
+	timers        *timers
+	wakeup        *wakeup
+	// lastBlockID numbers the waits of blocked clients.
+	lastBlockID int64
+}
+
+func newReactor(id int, serverFd int, dispatcher *core.Dispatcher) (*reactor, error) {
+	// Create an ioMultiplexer instance (epoll in Linux, kqueue in MacOS)
+	ioMultiplexer, err := io_multiplexing.CreateIOMultiplexer()
+	if err != nil {
+		return nil, err
+	}
+
+	// Monitor "read" events on the Server FD
+	if err = ioMultiplexer.Monitor(io_multiplexing.Event{
+		Fd: serverFd,
+		Op: io_multiplexing.OpRead,
+	}); err != nil {
+		_ = ioMultiplexer.Close()
+		return nil, err
+	}
+
+	wakeup, err := newWakeup()
+	if err != nil {
+		_ = ioMultiplexer.Close()
+		return nil, err
+	}
+	if err = ioMultiplexer.Monitor(io_multiplexing.Event{
+		Fd: wakeup.readFd,
+		Op: io_multiplexing.OpRead,
+	}); err != nil {
+		_ = wakeup.close()
+		_ = ioMultiplexer.Close()
+		return nil, err
+	}
+
+	r := &reactor{
+		id:            id,
+		serverFd:      serverFd,
+		ioMultiplexer: ioMultiplexer,
+		dispatcher:    dispatcher,
+		clients:       make(map[int]*Client),
+		timers:        newTimers(),
+		wakeup:        wakeup,
+	}
+	// Shards are shared, so one reactor is enough to drive the server wide
+	// jobs; every reactor looks after its own clients.
+	if id == 0 {
+		r.timers.add(constant.ActiveExpireFrequency, r.activeExpireCron)
+		r.timers.add(constant.StatsSampleFrequency, r.statsCron)
+		r.timers.add(constant.SaveCronFrequency, r.saveCron)
+		r.timers.add(constant.AofCronFrequency, r.aofCron)
+	}
+	r.timers.add(constant.ClientsCronFrequency, r.clientsCron)
+	return r, nil
+}
+
+func (r *reactor) run() {
+	defer r.ioMultiplexer.Close()
+	defer r.wakeup.close()
+
+	for {
+		// wait for file descriptors in the monitoring list to be ready for I/O,
+		// but no longer than until the next timer is due.
+		events, err := r.ioMultiplexer.Wait(r.timers.nextTimeout(time.Now()))
+		if err != nil {
+			events = nil
+		}
+
+		for i := 0; i < len(events); i++ {
+			if events[i].Fd == r.serverFd {
+				r.acceptClient()
+				continue
+			}
+			if events[i].Fd == r.wakeup.readFd {
+				r.handleDeliveries()
+				continue
+			}
+			client, ok := r.clients[events[i].Fd]
+			if !ok {
+				continue
+			}
+			if events[i].Op == io_multiplexing.OpWrite {
+				if err := r.sendReplies(client); err != nil {
+					log.Println("err write:", err)
+					r.closeClient(client)
+				}
+				continue
+			}
+			r.handleReadable(client)
+		}
+		r.timers.process(time.Now())
+	}
+}
+
+func (r *reactor) activeExpireCron(now time.Time) time.Duration {
+	r.dispatcher.ActiveDeleteExpiredKeys()
+	return constant.ActiveExpireFrequency
+}
+
+func (r *reactor) statsCron(now time.Time) time.Duration {
+	r.dispatcher.SampleStats(now)
+	return constant.StatsSampleFrequency
+}
+
+func (r *reactor) saveCron(now time.Time) time.Duration {
+	r.dispatcher.SaveCron(now)
+	return constant.SaveCronFrequency
+}
+
+func (r *reactor) aofCron(now time.Time) time.Duration {
+	r.dispatcher.AofCron()
+	return constant.AofCronFrequency
+}
+
+// clientsCron closes connections that have been idle for longer than
+// config.ClientIdleTimeout. Clients waiting on a blocking command aren't idle.
+func (r *reactor) clientsCron(now time.Time) time.Duration {
+	if config.ClientIdleTimeout > 0 {
+		for _, client := range r.clients {
+			if client.blockID == 0 && now.Sub(client.lastInteraction) > config.ClientIdleTimeout {
+				log.Println("closing idle client")
+				r.closeClient(client)
+			}
+		}
+	}
+	return constant.ClientsCronFrequency
+}
+
+func (r *reactor) acceptClient() {
+	log.Printf("new client is trying to connect")
+	// set up new connection
+	connFd, _, err := syscall.Accept(r.serverFd)
+	if err != nil {
+		// Another reactor's socket can't steal the connection, but the peer
+		// may have given up before we got to it.
+		if err != syscall.EAGAIN {
+			log.Println("err", err)
+		}
+		return
+	}
+	log.Printf("set up a new connection on reactor %d", r.id)
+	if err = syscall.SetNonblock(connFd, true); err != nil {
+		log.Println("err", err)
+		_ = syscall.Close(connFd)
+		return
+	}
+	// ask epoll to monitor this connection
+	if err = r.ioMultiplexer.Monitor(io_multiplexing.Event{
+		Fd: connFd,
+		Op: io_multiplexing.OpRead,
+	}); err != nil {
+		log.Println("err", err)
+		_ = syscall.Close(connFd)
+		return
+	}
+	r.clients[connFd] = newClient(connFd)
+}
+
+func (r *reactor) handleReadable(client *Client) {
+	client.lastInteraction = time.Now()
+	if err := client.readQuery(); err != nil {
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			return
+		}
+		if err == io.EOF || err == syscall.ECONNRESET {
+			log.Println("client disconnected")
+		} else {
+			log.Println("read error:", err)
+		}
+		r.closeClient(client)
+		return
+	}
+	r.processAndReply(client)
+}
+
+// processAndReply runs the commands in the client's query buffer and sends
+// the replies.
+func (r *reactor) processAndReply(client *Client) {
+	if err := r.processQuery(client); err != nil {
+		// The stream can't be resynchronised after a malformed frame.
+		log.Println("protocol error:", err)
+		_ = client.flushReplies()
+		r.closeClient(client)
+		return
+	}
+	if err := r.sendReplies(client); err != nil {
+		log.Println("err write:", err)
+		r.closeClient(client)
+	}
+}
+
+// processQuery hands every complete command in the client's query buffer to
+// the shards, then gathers the replies in order into the client's reply
+// buffer. A trailing partial frame stays buffered until the rest arrives.
+//
+// A blocking command stops the processing: the commands behind it stay
+// buffered until its reply has been delivered.
+func (r *reactor) processQuery(client *Client) error {
+	defer client.compactQuery()
+	var pending []*core.PendingReply
+	var err error
+	for client.blockID == 0 {
+		var cmd *core.Command
+		cmd, err = client.nextCommand()
+		if err != nil || cmd == nil {
+			break
+		}
+		if core.IsBlockingCommand(cmd.Cmd) {
+			// Its reply comes later, after those of the commands before it.
+			for _, p := range pending {
+				_, _ = client.Write(p.Wait())
+			}
+			pending = nil
+			r.block(client, cmd)
+			continue
+		}
+		pending = append(pending, r.dispatcher.Submit(cmd))
+	}
+	for _, p := range pending {
+		_, _ = client.Write(p.Wait())
+	}
+	if err != nil {
+		_, _ = client.Write([]byte(fmt.Sprintf("-%s\r\n", err)))
+	}
+	return err
+}
+
+// sendReplies flushes the client's reply buffer without blocking. If the
+// socket can't take everything, the client is switched to write interest and
+// isn't read from again until its backlog has drained.
+func (r *reactor) sendReplies(client *Client) error {
+	if err := client.flushReplies(); err != nil {
+		return err
+	}
+	var op io_multiplexing.Operation = io_multiplexing.OpRead
+	if client.hasPendingReplies() {
+		op = io_multiplexing.OpWrite
+	}
+	if op == client.interest {
+		return nil
+	}
+	client.interest = op
+	return r.ioMultiplexer.Modify(io_multiplexing.Event{
+		Fd: client.fd,
+		Op: op,
+	})
+}
+
+// block runs a blocking command for the client, which then waits until the
+// reply is posted to the reactor's wakeup. The reactor enforces the timeout.
+func (r *reactor) block(client *Client, cmd *core.Command) {
+	r.lastBlockID++
+	id := r.lastBlockID
+	client.blockID = id
+	client.blocked = r.dispatcher.Block(cmd, func(reply []byte) {
+		r.wakeup.post(delivery{client: client, blockID: id, reply: reply})
+	})
+	if b := client.blocked; b != nil && b.Timeout() > 0 {
+		client.blockTimer = r.timers.add(b.Timeout(), func(now time.Time) time.Duration {
+			client.blockTimer = 0
+			r.dispatcher.Unblock(b)
+			return noMore
+		})
+	}
+}
+
+// handleDeliveries hands the replies posted for blocked clients to them and
+// resumes the processing of their query buffers.
+func (r *reactor) handleDeliveries() {
+	for _, d := range r.wakeup.take() {
+		client := d.client
+		// The client may have been closed while the reply was on its way.
+		if r.clients[client.fd] != client || client.blockID != d.blockID {
+			continue
+		}
+		r.timers.remove(client.blockTimer)
+		client.blockID, client.blocked, client.blockTimer = 0, nil, 0
+		client.lastInteraction = time.Now()
+		_, _ = client.Write(d.reply)
+		r.processAndReply(client)
+	}
+}
+
+func (r *reactor) closeClient(client *Client) {
+	if client.blocked != nil {
+		r.timers.remove(client.blockTimer)
+		r.dispatcher.Unblock(client.blocked)
+		client.blockID, client.blocked, client.blockTimer = 0, nil, 0
+	}
+	_ = r.ioMultiplexer.Remove(client.fd)
+	_ = client.close()
+	delete(r.clients, client.fd)
+}
@@ -0,0 +1,6 @@
+//go:build linux
+
+package server
+
+// soReusePort is SO_REUSEPORT, which the syscall package doesn't define on Linux.
+const soReusePort = 0xf
@@ -1,118 +1,91 @@
 package server
 
 import (
-	"github.com/thaison199py/multi-threaded-redis/internal/config"
-	"github.com/thaison199py/multi-threaded-redis/internal/constant"
-	"github.com/thaison199py/multi-threaded-redis/internal/core"
-	"github.com/thaison199py/multi-threaded-redis/internal/core/io_multiplexing"
-	"io"
+	"context"
 	"log"
 	"net"
+	"os"
+	"sync"
 	"syscall"
-	"time"
-)
 
-func readCommand(fd int) (*core.Command, error) {
-	var buf = make([]byte, 512)
-	n, err := syscall.Read(fd, buf)
-	if err != nil {
-		return nil, err
-	}
-	if n == 0 {
-		return nil, io.EOF
-	}
-	return core.ParseCmd(buf)
-}
+	"github.com/thaison199py/multi-threaded-redis/internal/config"
+	"github.com/thaison199py/multi-threaded-redis/internal/core"
+)
 
-func respond(data string, fd int) error {
-	if _, err := syscall.Write(fd, []byte(data)); err != nil {
-		return err
+// listen opens a non-blocking listening socket on config.Port. SO_REUSEPORT
+// lets every reactor bind its own socket to the same port; the kernel then
+// spreads incoming connections across them.
+func listen() (*os.File, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
 	}
-	return nil
-}
-
-func RunIoMultiplexingServer() {
-	log.Println("starting an I/O Multiplexing TCP server on", config.Port)
-	listener, err := net.Listen(config.Protocol, config.Port)
+	listener, err := lc.Listen(context.Background(), config.Protocol, config.Port)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	// The listener itself is no longer needed once we hold a dup of its fd.
 	defer listener.Close()
 
 	// Get the file descriptor from the listener
 	tcpListener, ok := listener.(*net.TCPListener)
 	if !ok {
-		log.Fatal("listener is not a TCPListener")
+		return nil, syscall.EINVAL
 	}
 	listenerFile, err := tcpListener.File()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer listenerFile.Close()
-
-	serverFd := int(listenerFile.Fd())
-
-	// Create an ioMultiplexer instance (epoll in Linux, kqueue in MacOS)
-	ioMultiplexer, err := io_multiplexing.CreateIOMultiplexer()
-	if err != nil {
-		log.Fatal(err)
+	if err = syscall.SetNonblock(int(listenerFile.Fd()), true); err != nil {
+		listenerFile.Close()
+		return nil, err
 	}
-	defer ioMultiplexer.Close()
+	return listenerFile, nil
+}
 
-	// Monitor "read" events on the Server FD
-	if err = ioMultiplexer.Monitor(io_multiplexing.Event{
-		Fd: serverFd,
-		Op: io_multiplexing.OpRead,
-	}); err != nil {
-		log.Fatal(err)
-	}
+func RunIoMultiplexingServer() {
+	log.Printf("starting an I/O Multiplexing TCP server on %s with %d reactor(s) and %d shard(s)",
+		config.Port, config.NumReactors, config.NumShards)
 
-	var events = make([]io_multiplexing.Event, config.MaxConnection)
-	var lastActiveExpireExecTime = time.Now()
-	for {
-		if time.Now().After(lastActiveExpireExecTime.Add(constant.ActiveExpireFrequency)) {
-			core.ActiveDeleteExpiredKeys()
-			lastActiveExpireExecTime = time.Now()
+	dispatcher := core.NewDispatcher(config.NumShards)
+	defer dispatcher.Close()
+	// The AOF is the more complete of the two, so it wins when enabled.
+	if config.AppendOnly {
+		if err := dispatcher.LoadAppendOnly(); err != nil {
+			log.Fatal("failed loading append only file: ", err)
 		}
-		// wait for file descriptors in the monitoring list to be ready for I/O
-		// it is a blocking call.
-		events, err = ioMultiplexer.Wait()
+		if err := dispatcher.OpenAppendOnly(); err != nil {
+			log.Fatal("failed opening append only file: ", err)
+		}
+	} else if err := dispatcher.LoadSnapshot(); err != nil {
+		log.Fatal("failed loading snapshot: ", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(config.NumReactors, 1); i++ {
+		listenerFile, err := listen()
 		if err != nil {
-			continue
+			log.Fatal(err)
 		}
+		defer listenerFile.Close()
 
-		for i := 0; i < len(events); i++ {
-			if events[i].Fd == serverFd {
-				log.Printf("new client is trying to connect")
-				// set up new connection
-				connFd, _, err := syscall.Accept(serverFd)
-				if err != nil {
-					log.Println("err", err)
-					continue
-				}
-				log.Printf("set up a new connection")
-				// ask epoll to monitor this connection
-				if err = ioMultiplexer.Monitor(io_multiplexing.Event{
-					Fd: connFd,
-					Op: io_multiplexing.OpRead,
-				}); err != nil {
-					log.Fatal(err)
-				}
-			} else {
-				cmd, err := readCommand(events[i].Fd)
-				if err != nil {
-					if err == io.EOF || err == syscall.ECONNRESET {
-						log.Println("client disconnected")
-						_ = syscall.Close(events[i].Fd)
-						continue
-					}
-					log.Println("read error:", err)
-					continue
-				}
-				if err = core.ExecuteAndResponse(cmd, events[i].Fd); err != nil {
-					log.Println("err write:", err)
-				}
-			}
+		r, err := newReactor(i, int(listenerFile.Fd()), dispatcher)
+		if err != nil {
+			log.Fatal(err)
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.run()
+		}()
 	}
+	wg.Wait()
 }
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"container/heap"
+	"time"
+)
+
+// noMore is returned by a timer callback that should not run again.
+const noMore time.Duration = -1
+
+// timeEvent is a callback the event loop runs once its deadline has passed,
+// like the time events behind Redis' serverCron. The callback returns the
+// delay until its next run, or noMore to be dropped.
+type timeEvent struct {
+	id    int64
+	when  time.Time
+	proc  func(now time.Time) time.Duration
+	index int // position in the heap, maintained by timerHeap
+}
+
+type timerHeap []*timeEvent
+
+func (h timerHeap) Len() int           { return len(h) }
+func (h timerHeap) Less(i, j int) bool { return h[i].when.Before(h[j].when) }
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	te := x.(*timeEvent)
+	te.index = len(*h)
+	*h = append(*h, te)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	te := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	te.index = -1
+	return te
+}
+
+// timers is the time event list of one event loop. It is not safe for
+// concurrent use; only the owning reactor touches it.
+type timers struct {
+	events timerHeap
+	byID   map[int64]*timeEvent
+	nextID int64
+}
+
+func newTimers() *timers {
+	return &timers{byID: make(map[int64]*timeEvent)}
+}
+
+// add schedules proc to run after delay and returns an id for remove.
+func (t *timers) add(delay time.Duration, proc func(now time.Time) time.Duration) int64 {
+	t.nextID++
+	te := &timeEvent{id: t.nextID, when: time.Now().Add(delay), proc: proc}
+	heap.Push(&t.events, te)
+	t.byID[te.id] = te
+	return te.id
+}
+
+// remove cancels a timer. Removing an unknown or already fired id is a no-op.
+func (t *timers) remove(id int64) {
+	te, ok := t.byID[id]
+	if !ok {
+		return
+	}
+	heap.Remove(&t.events, te.index)
+	delete(t.byID, id)
+}
+
+// nextTimeout is how long the event loop may block before the earliest timer
+// is due. It is negative when there are no timers.
+func (t *timers) nextTimeout(now time.Time) time.Duration {
+	if len(t.events) == 0 {
+		return -1
+	}
+	return max(t.events[0].when.Sub(now), 0)
+}
+
+// process runs every timer due at now and reschedules the periodic ones.
+func (t *timers) process(now time.Time) {
+	for len(t.events) > 0 && !t.events[0].when.After(now) {
+		te := t.events[0]
+		next := te.proc(now)
+		// proc may have removed its own timer.
+		if _, ok := t.byID[te.id]; !ok {
+			continue
+		}
+		if next < 0 {
+			heap.Remove(&t.events, te.index)
+			delete(t.byID, te.id)
+			continue
+		}
+		// A zero delay would make the timer due again within this same pass.
+		te.when = now.Add(max(next, time.Millisecond))
+		heap.Fix(&t.events, te.index)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimers_nextTimeout(t *testing.T) {
+	tm := newTimers()
+	assert.Less(t, tm.nextTimeout(time.Now()), time.Duration(0))
+
+	tm.add(time.Hour, func(time.Time) time.Duration { return noMore })
+	tm.add(50*time.Millisecond, func(time.Time) time.Duration { return noMore })
+	now := time.Now()
+	timeout := tm.nextTimeout(now)
+	assert.Greater(t, timeout, time.Duration(0))
+	assert.LessOrEqual(t, timeout, 50*time.Millisecond)
+
+	// An overdue timer means the event loop must not block at all.
+	assert.Equal(t, time.Duration(0), tm.nextTimeout(now.Add(time.Minute)))
+}
+
+func TestTimers_process(t *testing.T) {
+	tm := newTimers()
+	var periodic, oneShot, removed int
+	tm.add(0, func(time.Time) time.Duration {
+		periodic++
+		return 10 * time.Millisecond
+	})
+	tm.add(0, func(time.Time) time.Duration {
+		oneShot++
+		return noMore
+	})
+	id := tm.add(0, func(time.Time) time.Duration {
+		removed++
+		return noMore
+	})
+	tm.remove(id)
+	tm.remove(id)
+
+	now := time.Now().Add(time.Millisecond)
+	tm.process(now)
+	assert.Equal(t, 1, periodic)
+	assert.Equal(t, 1, oneShot)
+	assert.Equal(t, 0, removed)
+
+	// Only the periodic timer is left, due 10ms after the last run.
+	tm.process(now.Add(5 * time.Millisecond))
+	assert.Equal(t, 1, periodic)
+	tm.process(now.Add(10 * time.Millisecond))
+	assert.Equal(t, 2, periodic)
+	assert.Equal(t, 1, oneShot)
+	assert.Len(t, tm.events, 1)
+}
+
+func TestTimers_procRemovesItself(t *testing.T) {
+	tm := newTimers()
+	var id int64
+	id = tm.add(0, func(time.Time) time.Duration {
+		tm.remove(id)
+		return time.Millisecond
+	})
+	tm.process(time.Now().Add(time.Millisecond))
+	assert.Len(t, tm.events, 0)
+	assert.Less(t, tm.nextTimeout(time.Now()), time.Duration(0))
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"sync"
+	"syscall"
+)
+
+// delivery is the reply to the blocking command a client is waiting on.
+type delivery struct {
+	client  *Client
+	blockID int64
+	reply   []byte
+}
+
+// wakeup hands the replies of blocked clients from the shard workers back to
+// a reactor. Posting also writes a byte to a pipe the reactor monitors, so a
+// reactor sleeping in Wait notices it has something to send.
+type wakeup struct {
+	readFd, writeFd int
+
+	mu         sync.Mutex
+	deliveries []delivery
+}
+
+func newWakeup() (*wakeup, error) {
+	var fds [2]int
+	if err := syscall.Pipe(fds[:]); err != nil {
+		return nil, err
+	}
+	w := &wakeup{readFd: fds[0], writeFd: fds[1]}
+	for _, fd := range fds {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			_ = w.close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// post queues d and wakes the reactor. It is safe for concurrent use and
+// never blocks: a full pipe already holds a wake up.
+func (w *wakeup) post(d delivery) {
+	w.mu.Lock()
+	w.deliveries = append(w.deliveries, d)
+	w.mu.Unlock()
+	_, _ = syscall.Write(w.writeFd, []byte{0})
+}
+
+// take empties the pipe and returns what was posted since the last call, in
+// the order it was posted.
+func (w *wakeup) take() []delivery {
+	var buf [64]byte
+	for {
+		if n, err := syscall.Read(w.readFd, buf[:]); n <= 0 || err != nil {
+			break
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	deliveries := w.deliveries
+	w.deliveries = nil
+	return deliveries
+}
+
+func (w *wakeup) close() error {
+	_ = syscall.Close(w.writeFd)
+	return syscall.Close(w.readFd)
+}
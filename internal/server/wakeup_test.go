@@ -0,0 +1,38 @@
+package server
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWakeup_take(t *testing.T) {
+	w, err := newWakeup()
+	assert.NoError(t, err)
+	defer w.close()
+	assert.Empty(t, w.take())
+
+	// Many posts never block on the pipe and keep their order per poster.
+	var wg sync.WaitGroup
+	for poster := 0; poster < 4; poster++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int64(1); i <= 10000; i++ {
+				w.post(delivery{blockID: int64(poster)<<32 | i})
+			}
+		}()
+	}
+	wg.Wait()
+
+	last := map[int64]int64{}
+	deliveries := w.take()
+	assert.Len(t, deliveries, 40000)
+	for _, d := range deliveries {
+		poster, i := d.blockID>>32, d.blockID&(1<<32-1)
+		assert.Equal(t, last[poster]+1, i)
+		last[poster] = i
+	}
+	assert.Empty(t, w.take())
+}